@@ -8,7 +8,9 @@ import (
 )
 
 var (
-	errKeyNotFound   = errors.New("cache: key not found")
+	// ErrKeyNotFound is returned by local caches if key does not exist or has expired,
+	// RedisCache returns redis.Nil instead
+	ErrKeyNotFound   = errors.New("cache: key not found")
 	errAlreadyClosed = errors.New("cache: already closed")
 )
 
@@ -81,7 +83,7 @@ func (b *BuildInMapCache) Get(_ context.Context, k string) (any, error) {
 	itm, ok := b.data[k]
 	b.mutex.RUnlock()
 	if !ok {
-		return nil, errKeyNotFound
+		return nil, ErrKeyNotFound
 	}
 	now := time.Now()
 	if itm.expired(now) {
@@ -89,11 +91,11 @@ func (b *BuildInMapCache) Get(_ context.Context, k string) (any, error) {
 		defer b.mutex.Unlock()
 		itm, ok = b.data[k]
 		if !ok {
-			return nil, errKeyNotFound
+			return nil, ErrKeyNotFound
 		}
 		if itm.expired(now) {
 			b.delete(k)
-			return nil, errKeyNotFound
+			return nil, ErrKeyNotFound
 		}
 	}
 	return itm.v, nil
@@ -111,7 +113,7 @@ func (b *BuildInMapCache) LoadAndDelete(_ context.Context, k string) (any, error
 	defer b.mutex.Unlock()
 	itm, ok := b.data[k]
 	if !ok {
-		return nil, errKeyNotFound
+		return nil, ErrKeyNotFound
 	}
 	delete(b.data, k)
 	b.onEvicted(k, itm.v)
@@ -37,7 +37,7 @@ func TestBuildInMapCache_Get(t *testing.T) {
 			cache: func() *BuildInMapCache {
 				return NewBuildInMapCache(10 * time.Second)
 			},
-			wantErr: errKeyNotFound,
+			wantErr: ErrKeyNotFound,
 		},
 		{
 			name: "expired",
@@ -49,7 +49,7 @@ func TestBuildInMapCache_Get(t *testing.T) {
 				require.NoError(t, err)
 				return res
 			},
-			wantErr: errKeyNotFound,
+			wantErr: ErrKeyNotFound,
 		},
 	}
 	for _, tc := range testCases {
@@ -22,7 +22,7 @@ type ReadThroughCache struct {
 // Get single flight
 func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 	v, err := r.Cache.Get(ctx, k)
-	if errors.Is(err, errKeyNotFound) {
+	if errors.Is(err, ErrKeyNotFound) {
 		v, err, _ = r.g.Do(k, func() (any, error) {
 			val, er := r.LoadFunc(ctx, k)
 			if er != nil {
@@ -40,7 +40,7 @@ func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 // Get semi asynchronous
 //func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 //	v, err := r.Cache.Get(ctx, k)
-//	if errors.Is(err, errKeyNotFound) {
+//	if errors.Is(err, ErrKeyNotFound) {
 //		v, err = r.LoadFunc(ctx, k)
 //		if err != nil {
 //			return v, err
@@ -55,7 +55,7 @@ func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 // Get asynchronous
 //func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 //	v, err := r.Cache.Get(ctx, k)
-//	if errors.Is(err, errKeyNotFound) {
+//	if errors.Is(err, ErrKeyNotFound) {
 //		go func() {
 //			v, err = r.LoadFunc(ctx, k)
 //			if err != nil {
@@ -70,7 +70,7 @@ func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 // Get synchronous
 //func (r *ReadThroughCache) Get(ctx context.Context, k string) (any, error) {
 //	v, err := r.Cache.Get(ctx, k)
-//	if errors.Is(err, errKeyNotFound) {
+//	if errors.Is(err, ErrKeyNotFound) {
 //		v, err = r.LoadFunc(ctx, k)
 //		if err != nil {
 //			return v, err
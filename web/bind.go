@@ -0,0 +1,253 @@
+package web
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// bindSources are tags of request parts in lookup order
+var bindSources = []string{"path", "query", "header", "cookie", "form"}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// Bind fills val, which must be a pointer to struct, and validates it,
+// body is decoded as JSON, XML or form by Content-Type first,
+// then fields tagged with path, query, header, cookie or form are overwritten by request parts,
+// untagged struct fields are filled recursively, time.Time is parsed by time_format tag or RFC3339,
+// 400 response with field errors is set if failed, error of misconfigured validate tag is recorded by SetError
+//
+//	type Req struct {
+//		ID    int64     `path:"id" validate:"min=1"`
+//		Tags  []string  `query:"tag"`
+//		Token *string   `header:"X-Token" validate:"required"`
+//		Since time.Time `query:"since" time_format:"2006-01-02"`
+//		Name  string    `json:"name" validate:"required,max=32"`
+//	}
+func (ctx *Context) Bind(val any) error {
+	err := ctx.bind(val)
+	if err == nil {
+		err = Validate(val)
+		var fieldErrs ValidationErrors
+		if err != nil && !errors.As(err, &fieldErrs) {
+			// reported as server error by errhandle
+			ctx.SetError(err)
+			return err
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	var fieldErrs ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		fieldErrs = ValidationErrors{{Message: err.Error()}}
+	}
+	data, _ := json.Marshal(map[string]any{"errors": fieldErrs})
+	ctx.Resp.Header().Set("Content-Type", "application/json")
+	ctx.RespCode = http.StatusBadRequest
+	ctx.RespData = data
+	return err
+}
+
+func (ctx *Context) bind(val any) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("web: bind target must be a non-nil pointer to struct")
+	}
+	if err := ctx.bindBody(val); err != nil {
+		return ValidationErrors{{Field: "body", Rule: "decode", Message: err.Error()}}
+	}
+	var errs ValidationErrors
+	ctx.bindFields(rv.Elem(), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (ctx *Context) bindBody(val any) error {
+	if ctx.Req.Body == nil || ctx.Req.Body == http.NoBody {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(ctx.Req.Header.Get("Content-Type"))
+	var err error
+	switch mediaType {
+	case "application/json":
+		err = json.NewDecoder(ctx.Req.Body).Decode(val)
+	case "application/xml", "text/xml":
+		err = xml.NewDecoder(ctx.Req.Body).Decode(val)
+	case "multipart/form-data":
+		// 32 MB in memory as http.Request.FormFile
+		err = ctx.Req.ParseMultipartForm(32 << 20)
+	case "application/x-www-form-urlencoded":
+		err = ctx.Req.ParseForm()
+	}
+	if errors.Is(err, io.EOF) {
+		// empty body
+		return nil
+	}
+	return err
+}
+
+func (ctx *Context) bindFields(v reflect.Value, prefix string, errs *ValidationErrors) {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldVal := v.Field(i)
+		source, name := bindSource(field)
+		if source == "" {
+			switch {
+			case field.Type.Kind() == reflect.Struct && field.Type != timeType:
+				ctx.bindFields(fieldVal, prefix+fieldName(field)+".", errs)
+			case field.Type.Kind() == reflect.Pointer && field.Type.Elem().Kind() == reflect.Struct &&
+				field.Type.Elem() != timeType && !fieldVal.IsNil():
+				ctx.bindFields(fieldVal.Elem(), prefix+fieldName(field)+".", errs)
+			}
+			continue
+		}
+		vals := ctx.bindValues(source, name)
+		if len(vals) == 0 {
+			continue
+		}
+		if err := setValue(fieldVal, vals, field); err != nil {
+			*errs = append(*errs, FieldError{
+				Field:   prefix + name,
+				Rule:    "type",
+				Message: err.Error(),
+			})
+		}
+	}
+}
+
+func (ctx *Context) bindValues(source string, name string) []string {
+	switch source {
+	case "path":
+		if param, ok := ctx.pathParam(name); ok {
+			return []string{param.val}
+		}
+	case "query":
+		if ctx.queryParams == nil {
+			ctx.queryParams = ctx.Req.URL.Query()
+		}
+		return ctx.queryParams[name]
+	case "header":
+		return ctx.Req.Header.Values(name)
+	case "cookie":
+		if c, err := ctx.Req.Cookie(name); err == nil {
+			return []string{c.Value}
+		}
+	case "form":
+		if ctx.Req.Form == nil {
+			_ = ctx.Req.ParseForm()
+		}
+		return ctx.Req.Form[name]
+	}
+	return nil
+}
+
+// bindSource returns the first request part tag of field
+func bindSource(field reflect.StructField) (string, string) {
+	for _, source := range bindSources {
+		if name, ok := field.Tag.Lookup(source); ok && name != "" && name != "-" {
+			return source, name
+		}
+	}
+	return "", ""
+}
+
+func setValue(v reflect.Value, vals []string, field reflect.StructField) error {
+	switch {
+	case v.Kind() == reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), vals, field); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), []string{val}, field); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setScalar(v, vals[0], field)
+}
+
+func setScalar(v reflect.Value, val string, field reflect.StructField) error {
+	switch v.Type() {
+	case timeType:
+		layout := field.Tag.Get("time_format")
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// []byte
+		v.SetBytes([]byte(val))
+	default:
+		return fmt.Errorf("web: unsupported bind type %s", v.Type())
+	}
+	return nil
+}
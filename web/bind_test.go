@@ -0,0 +1,132 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type bindReq struct {
+	ID      int64         `path:"id" validate:"min=1"`
+	Tags    []string      `query:"tag"`
+	Page    *int          `query:"page"`
+	Since   time.Time     `query:"since" time_format:"2006-01-02"`
+	Timeout time.Duration `query:"timeout"`
+	Token   string        `header:"X-Token" validate:"required"`
+	Session string        `cookie:"session"`
+	Name    string        `json:"name" form:"name" validate:"required,max=8"`
+	Address bindAddress   `json:"address"`
+}
+
+func TestContext_Bind(t *testing.T) {
+	page := 2
+	testCases := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		wantReq     bindReq
+		wantErrs    ValidationErrors
+	}{
+		{
+			name:        "json",
+			target:      "/users/12?tag=a&tag=b&page=2&since=2024-01-02&timeout=3s",
+			contentType: "application/json",
+			body:        `{"name":"tom","address":{"city":"paris"}}`,
+			wantReq: bindReq{
+				ID: 12, Tags: []string{"a", "b"}, Page: &page,
+				Since:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+				Timeout: 3 * time.Second, Token: "token", Session: "sess",
+				Name: "tom", Address: bindAddress{City: "paris"},
+			},
+		},
+		{
+			name:        "form",
+			target:      "/users/12",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=jerry",
+			wantErrs:    ValidationErrors{{Field: "address.city", Rule: "required", Message: "is required"}},
+		},
+		{
+			name:        "type error",
+			target:      "/users/abc?page=x",
+			contentType: "application/json",
+			body:        `{"name":"tom","address":{"city":"paris"}}`,
+			wantErrs: ValidationErrors{
+				{Field: "id", Rule: "type", Message: `strconv.ParseInt: parsing "abc": invalid syntax`},
+				{Field: "page", Rule: "type", Message: `strconv.ParseInt: parsing "x": invalid syntax`},
+			},
+		},
+		{
+			name:        "validation error",
+			target:      "/users/0",
+			contentType: "application/json",
+			body:        `{"name":"too long name"}`,
+			wantErrs: ValidationErrors{
+				{Field: "id", Rule: "min", Message: "must be at least 1"},
+				{Field: "name", Rule: "max", Message: "length must be at most 8"},
+				{Field: "address.city", Rule: "required", Message: "is required"},
+			},
+		},
+		{
+			name:        "invalid body",
+			target:      "/users/12",
+			contentType: "application/json",
+			body:        `{"name":`,
+			wantErrs:    ValidationErrors{{Field: "body", Rule: "decode", Message: "unexpected EOF"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req bindReq
+			var err error
+			h := NewHTTPServer()
+			h.Post("/users/:id", func(ctx *Context) {
+				err = ctx.Bind(&req)
+			})
+			httpReq := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			httpReq.Header.Set("Content-Type", tc.contentType)
+			httpReq.Header.Set("X-Token", "token")
+			httpReq.AddCookie(&http.Cookie{Name: "session", Value: "sess"})
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httpReq)
+			if tc.wantErrs != nil {
+				assert.Equal(t, tc.wantErrs, err)
+				assert.Equal(t, http.StatusBadRequest, recorder.Code)
+				var body struct {
+					Errors ValidationErrors `json:"errors"`
+				}
+				assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				assert.Equal(t, tc.wantErrs, body.Errors)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantReq, req)
+		})
+	}
+}
+
+func TestContext_BindInvalidTag(t *testing.T) {
+	var err, ctxErr error
+	h := NewHTTPServer()
+	h.Get("/", func(ctx *Context) {
+		var req struct {
+			Page int `query:"page" validate:"email"`
+		}
+		err = ctx.Bind(&req)
+		ctxErr = ctx.Err()
+	})
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?page=1", nil))
+	assert.ErrorContains(t, err, "email rule does not support int")
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, err, ctxErr)
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 )
 
+// Context is pooled and reused after ServeHTTP returns, do not retain it
 type Context struct {
 	Req *http.Request
 	// use Resp instead of RespData and RespCode
@@ -18,15 +19,37 @@ type Context struct {
 	RespData []byte
 	RespCode int
 
+	// committed means status and headers have been written by streaming,
+	// RespData is ignored after that
+	committed bool
+	// respSize is the number of body bytes written by streaming
+	respSize int
+	// err is recorded by SetError for errhandle middleware
+	err error
+
+	// MatchedRoute is the pattern of route, it is matched before server middlewares
 	MatchedRoute string
-	pathParams   map[string]string
-	queryParams  url.Values
+	// params keep capacity across requests
+	params      []pathParam
+	queryParams url.Values
+	// matched is the route matched before server middlewares
+	matched routeMatch
 
 	templateEngine TemplateEngine
+	encoders       []Encoder
 	// need init by user
 	UserValues map[string]any
 }
 
+// reset prepares pooled ctx for request
+func (ctx *Context) reset(resp http.ResponseWriter, req *http.Request) {
+	*ctx = Context{
+		Req:    req,
+		Resp:   resp,
+		params: ctx.params[:0],
+	}
+}
+
 func (ctx *Context) Render(templateName string, data any) error {
 	var err error
 	ctx.RespData, err = ctx.templateEngine.Render(ctx.Req.Context(), templateName, data)
@@ -52,8 +75,8 @@ func (ctx *Context) RespJSON(status int, val any) error {
 	if err != nil {
 		return err
 	}
-	// c.Resp.Header().Set("Content-Type", "application/json")
-	// c.Resp.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	// Content-Length is set when flushing response
+	ctx.Resp.Header().Set("Content-Type", JSONEncoder{}.ContentType())
 	ctx.RespCode = status
 	ctx.RespData = data
 	return err
@@ -102,15 +125,39 @@ func (ctx *Context) QueryValue(key string) *StringValue {
 }
 
 func (ctx *Context) PathValue(key string) *StringValue {
-	val, ok := ctx.pathParams[key]
+	param, ok := ctx.pathParam(key)
 	if !ok {
 		return &StringValue{
 			err: errors.New("web: key not found"),
 		}
 	}
 	return &StringValue{
-		val: val,
+		val: param.val,
+	}
+}
+
+// pathParam finds param by key, the last one wins if key is duplicate
+func (ctx *Context) pathParam(key string) (pathParam, bool) {
+	for i := len(ctx.params) - 1; i >= 0; i-- {
+		if ctx.params[i].key == key {
+			return ctx.params[i], true
+		}
+	}
+	return pathParam{}, false
+}
+
+// TypedPathValue returns parsed value of typed path param,
+// such as int64 of :id<int> and uuid.UUID of :id<uuid>,
+// value of other path params is returned as string
+func (ctx *Context) TypedPathValue(key string) (any, bool) {
+	param, ok := ctx.pathParam(key)
+	if !ok {
+		return nil, false
+	}
+	if param.typed != nil {
+		return param.typed, true
 	}
+	return param.val, true
 }
 
 type StringValue struct {
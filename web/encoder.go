@@ -0,0 +1,273 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/micro/rpc/serialize/proto"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrEncoderNotSupported is returned by Encoder if it can not encode the value,
+// Respond will try the next acceptable encoder
+var ErrEncoderNotSupported = errors.New("web: encoder does not support the value")
+
+// Encoder encodes response value to body of a media type
+type Encoder interface {
+	// ContentType returns value of Content-Type header,
+	// media type of it is matched with Accept header
+	ContentType() string
+	Encode(ctx *Context, val any) ([]byte, error)
+}
+
+// View is rendered by TemplateEngine when client accepts text/html
+type View struct {
+	Name string
+	Data any
+}
+
+// defaultEncoders are used in order when client accepts any media type
+var defaultEncoders = []Encoder{
+	JSONEncoder{},
+	XMLEncoder{},
+	ProtoEncoder{},
+	TextEncoder{},
+	TemplateEncoder{},
+}
+
+// ServerWithEncoders registers encoders for Respond,
+// encoder replaces the default one with the same media type, otherwise it is appended
+func ServerWithEncoders(encoders ...Encoder) HTTPServerOption {
+	return func(server *HTTPServer) {
+		for _, encoder := range encoders {
+			server.encoders = registerEncoder(server.encoders, encoder)
+		}
+	}
+}
+
+func registerEncoder(encoders []Encoder, encoder Encoder) []Encoder {
+	res := make([]Encoder, 0, len(encoders)+1)
+	replaced := false
+	for _, e := range encoders {
+		if mediaType(e.ContentType()) == mediaType(encoder.ContentType()) {
+			res = append(res, encoder)
+			replaced = true
+			continue
+		}
+		res = append(res, e)
+	}
+	if !replaced {
+		res = append(res, encoder)
+	}
+	return res
+}
+
+// Respond encodes val with the encoder negotiated by Accept header,
+// 406 response is set if no encoder acceptable
+func (ctx *Context) Respond(status int, val any) error {
+	encoders := ctx.encoders
+	if encoders == nil {
+		encoders = defaultEncoders
+	}
+	header := ctx.Resp.Header()
+	header.Add("Vary", "Accept")
+	ranges := parseAccept(ctx.Req.Header.Get("Accept"))
+	for _, accepted := range ranges {
+		if accepted.quality == 0 {
+			// the rest are not acceptable
+			break
+		}
+		for _, encoder := range encoders {
+			typ := mediaType(encoder.ContentType())
+			if !accepted.match(typ) || rejected(ranges, typ, accepted.specificity()) {
+				continue
+			}
+			data, err := encoder.Encode(ctx, val)
+			if errors.Is(err, ErrEncoderNotSupported) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			header.Set("Content-Type", encoder.ContentType())
+			ctx.RespCode = status
+			ctx.RespData = data
+			return nil
+		}
+	}
+	ctx.RespCode = http.StatusNotAcceptable
+	ctx.RespData = []byte("406 not acceptable")
+	return errors.New("web: no acceptable encoder")
+}
+
+// Accepts returns the first of offered media types preferred by Accept header,
+// empty string if none is acceptable
+func (ctx *Context) Accepts(offers ...string) string {
+	ranges := parseAccept(ctx.Req.Header.Get("Accept"))
+	for _, accepted := range ranges {
+		if accepted.quality == 0 {
+			break
+		}
+		for _, offer := range offers {
+			if accepted.match(offer) && !rejected(ranges, offer, accepted.specificity()) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+type JSONEncoder struct{}
+
+func (JSONEncoder) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (JSONEncoder) Encode(_ *Context, val any) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+type XMLEncoder struct{}
+
+func (XMLEncoder) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+func (XMLEncoder) Encode(_ *Context, val any) ([]byte, error) {
+	data, err := xml.Marshal(val)
+	if err != nil {
+		// such as map which can not be encoded
+		return nil, fmt.Errorf("%w: %w", ErrEncoderNotSupported, err)
+	}
+	return data, nil
+}
+
+// ProtoEncoder encodes proto.Message with the serializer of rpc
+type ProtoEncoder struct{}
+
+func (ProtoEncoder) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (ProtoEncoder) Encode(_ *Context, val any) ([]byte, error) {
+	data, err := proto.Serializer{}.Encode(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncoderNotSupported, err)
+	}
+	return data, nil
+}
+
+// TextEncoder encodes string, []byte, error and fmt.Stringer
+type TextEncoder struct{}
+
+func (TextEncoder) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (TextEncoder) Encode(_ *Context, val any) ([]byte, error) {
+	switch v := val.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case error:
+		return []byte(v.Error()), nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return nil, ErrEncoderNotSupported
+}
+
+// TemplateEncoder renders View with TemplateEngine of server
+type TemplateEncoder struct{}
+
+func (TemplateEncoder) ContentType() string {
+	return "text/html; charset=utf-8"
+}
+
+func (TemplateEncoder) Encode(ctx *Context, val any) ([]byte, error) {
+	view, ok := val.(View)
+	if !ok || ctx.templateEngine == nil {
+		return nil, ErrEncoderNotSupported
+	}
+	return ctx.templateEngine.Render(ctx.Req.Context(), view.Name, view.Data)
+}
+
+func mediaType(contentType string) string {
+	res, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return res
+}
+
+// acceptRange is a media range of Accept header
+type acceptRange struct {
+	typ     string
+	subtype string
+	quality float64
+}
+
+func (a acceptRange) match(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	return (a.typ == "*" || a.typ == typ) && (a.subtype == "*" || a.subtype == subtype)
+}
+
+func (a acceptRange) specificity() int {
+	switch {
+	case a.typ == "*":
+		return 0
+	case a.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// rejected reports whether media type is excluded by a more specific range with q=0,
+// such as application/json in "application/json;q=0, */*"
+func rejected(ranges []acceptRange, mediaType string, specificity int) bool {
+	for _, r := range ranges {
+		if r.quality == 0 && r.specificity() >= specificity && r.match(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAccept returns ranges in preference order with q=0 ranges at last,
+// empty header means any media type is acceptable
+func parseAccept(header string) []acceptRange {
+	if strings.TrimSpace(header) == "" {
+		return []acceptRange{{typ: "*", subtype: "*", quality: 1}}
+	}
+	var res []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		r := acceptRange{quality: 1}
+		r.typ, r.subtype, _ = strings.Cut(typ, "/")
+		if r.subtype == "" {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if r.quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		res = append(res, r)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].quality != res[j].quality {
+			return res[i].quality > res[j].quality
+		}
+		return res[i].specificity() > res[j].specificity()
+	})
+	return res
+}
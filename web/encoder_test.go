@@ -0,0 +1,124 @@
+package web
+
+import (
+	"bytes"
+	"github.com/CoucouMonEcho/go-framework/micro/rpc/proto/gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type csvEncoder struct{}
+
+func (csvEncoder) ContentType() string {
+	return "text/csv"
+}
+
+func (csvEncoder) Encode(_ *Context, val any) ([]byte, error) {
+	user, ok := val.(encoderUser)
+	if !ok {
+		return nil, ErrEncoderNotSupported
+	}
+	return []byte("name\n" + user.Name), nil
+}
+
+type encoderUser struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func TestContext_Respond(t *testing.T) {
+	tpl, err := template.New("user").Parse(`<p>{{.Name}}</p>`)
+	require.NoError(t, err)
+	h := NewHTTPServer(
+		ServerWithTemplateEngine(&GoTemplateEngine{T: tpl}),
+		ServerWithEncoders(csvEncoder{}),
+	)
+	h.Get("/user", func(ctx *Context) {
+		_ = ctx.Respond(http.StatusOK, encoderUser{Name: "Tom"})
+	})
+	h.Get("/view", func(ctx *Context) {
+		_ = ctx.Respond(http.StatusOK, View{Name: "user", Data: encoderUser{Name: "Tom"}})
+	})
+	h.Get("/proto", func(ctx *Context) {
+		_ = ctx.Respond(http.StatusCreated, &gen.GetByIdReq{Id: 12})
+	})
+	h.Get("/text", func(ctx *Context) {
+		_ = ctx.Respond(http.StatusOK, "hello")
+	})
+	protoData, err := proto.Marshal(&gen.GetByIdReq{Id: 12})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		path            string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        []byte
+	}{
+		{"no accept", "/user", "", http.StatusOK, "application/json; charset=utf-8", []byte(`{"name":"Tom"}`)},
+		{"xml", "/user", "application/xml", http.StatusOK, "application/xml; charset=utf-8", []byte(`<encoderUser><name>Tom</name></encoderUser>`)},
+		{"quality", "/user", "application/json;q=0.5, application/xml;q=0.9", http.StatusOK, "application/xml; charset=utf-8", []byte(`<encoderUser><name>Tom</name></encoderUser>`)},
+		{"rejected", "/user", "application/json;q=0, */*", http.StatusOK, "application/xml; charset=utf-8", []byte(`<encoderUser><name>Tom</name></encoderUser>`)},
+		{"custom encoder", "/user", "text/csv", http.StatusOK, "text/csv", []byte("name\nTom")},
+		{"not acceptable", "/user", "text/plain", http.StatusNotAcceptable, "", []byte("406 not acceptable")},
+		{"view", "/view", "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusOK, "text/html; charset=utf-8", []byte("<p>Tom</p>")},
+		{"view fallback", "/view", "application/json", http.StatusOK, "application/json; charset=utf-8", []byte(`{"Name":"user","Data":{"name":"Tom"}}`)},
+		{"proto", "/proto", "application/x-protobuf", http.StatusCreated, "application/x-protobuf", protoData},
+		{"text", "/text", "text/*", http.StatusOK, "text/plain; charset=utf-8", []byte("hello")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Accept", tc.accept)
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantContentType, recorder.Header().Get("Content-Type"))
+			assert.True(t, bytes.Equal(tc.wantBody, recorder.Body.Bytes()), recorder.Body.String())
+			assert.Equal(t, "Accept", recorder.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestContext_Accepts(t *testing.T) {
+	offers := []string{"application/problem+json", "application/json", "text/html"}
+	testCases := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{name: "no accept", accept: "", want: "application/problem+json"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8", want: "text/html"},
+		{name: "json", accept: "application/json", want: "application/json"},
+		{name: "quality", accept: "application/json;q=0.5, text/*", want: "text/html"},
+		{name: "rejected", accept: "application/*;q=0, */*", want: "text/html"},
+		{name: "not acceptable", accept: "image/png", want: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tc.accept)
+			ctx := &Context{Req: req}
+			assert.Equal(t, tc.want, ctx.Accepts(offers...))
+		})
+	}
+}
+
+func TestGoTemplateEngine_RenderView(t *testing.T) {
+	tpl, err := template.New("hello").Parse(`hello {{.}}`)
+	require.NoError(t, err)
+	data, err := TemplateEncoder{}.Encode(&Context{
+		Req:            httptest.NewRequest(http.MethodGet, "/", nil),
+		templateEngine: &GoTemplateEngine{T: tpl},
+	}, View{Name: "hello", Data: "world"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	// no template engine
+	_, err = TemplateEncoder{}.Encode(&Context{Req: httptest.NewRequest(http.MethodGet, "/", nil)}, View{})
+	assert.ErrorIs(t, err, ErrEncoderNotSupported)
+}
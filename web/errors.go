@@ -0,0 +1,90 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound is recorded if no route matches path
+	ErrNotFound = NewHTTPError(http.StatusNotFound, "")
+	// ErrMethodNotAllowed is recorded if routes of path do not allow method
+	ErrMethodNotAllowed = NewHTTPError(http.StatusMethodNotAllowed, "")
+	// ErrMalformedPath is recorded if path is not absolute or not clean
+	ErrMalformedPath = NewHTTPError(http.StatusBadRequest, "malformed path")
+)
+
+// HTTPError is an error carrying status and problem details of RFC 9457,
+// errhandle middleware renders it as application/problem+json or an HTML error page
+type HTTPError struct {
+	Status int
+	// Type is a URI identifying the problem, about:blank if empty
+	Type string
+	// Title is a short summary, status text if empty
+	Title string
+	// Detail is exposed to client, use Err for internal cause
+	Detail string
+	// Extensions are additional members of problem
+	Extensions map[string]any
+	// Err is the cause which is never exposed
+	Err error
+}
+
+func NewHTTPError(status int, detail string) *HTTPError {
+	return &HTTPError{Status: status, Detail: detail}
+}
+
+func (e *HTTPError) Error() string {
+	title := e.Title
+	if title == "" {
+		title = http.StatusText(e.Status)
+	}
+	parts := make([]string, 0, 3)
+	for _, part := range []string{title, e.Detail} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if e.Err != nil {
+		parts = append(parts, e.Err.Error())
+	}
+	return strings.Join(parts, ": ")
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusOf returns status of HTTPError in chain of err, 500 otherwise
+func StatusOf(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Status != 0 {
+		return httpErr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// HandleErr adapts handler returning error, error is recorded by Context.SetError:
+//
+//	server.Get("/users/:id", web.HandleErr(func(ctx *web.Context) error {
+//		return web.NewHTTPError(http.StatusNotFound, "user not found")
+//	}))
+func HandleErr(handler func(ctx *Context) error) Handler {
+	return func(ctx *Context) {
+		if err := handler(ctx); err != nil {
+			ctx.SetError(err)
+		}
+	}
+}
+
+// SetError records error of request and sets RespCode by StatusOf
+func (ctx *Context) SetError(err error) {
+	ctx.err = err
+	ctx.RespCode = StatusOf(err)
+}
+
+// Err returns error recorded by SetError
+func (ctx *Context) Err() error {
+	return ctx.err
+}
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	cause := errors.New("record not found")
+	testCases := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantMsg    string
+	}{
+		{name: "plain", err: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantMsg: "boom"},
+		{name: "http error", err: NewHTTPError(http.StatusNotFound, "user not found"),
+			wantStatus: http.StatusNotFound, wantMsg: "Not Found: user not found"},
+		{name: "wrapped", err: fmt.Errorf("load user: %w", &HTTPError{Status: http.StatusNotFound, Title: "User Missing", Err: cause}),
+			wantStatus: http.StatusNotFound, wantMsg: "load user: User Missing: record not found"},
+		{name: "no status", err: &HTTPError{Detail: "oops"}, wantStatus: http.StatusInternalServerError, wantMsg: "oops"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantStatus, StatusOf(tc.err))
+			assert.Equal(t, tc.wantMsg, tc.err.Error())
+		})
+	}
+	assert.ErrorIs(t, &HTTPError{Status: http.StatusNotFound, Err: cause}, cause)
+}
+
+func TestHandleErr(t *testing.T) {
+	var recorded error
+	h := NewHTTPServer(ServerWithMiddlewares(func(next Handler) Handler {
+		return func(ctx *Context) {
+			next(ctx)
+			recorded = ctx.Err()
+		}
+	}))
+	h.Get("/users/:id", HandleErr(func(ctx *Context) error {
+		return NewHTTPError(http.StatusNotFound, "user not found")
+	}))
+	h.Get("/ok", HandleErr(func(ctx *Context) error {
+		ctx.RespData = []byte("ok")
+		return nil
+	}))
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, http.StatusNotFound, StatusOf(recorded))
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+}
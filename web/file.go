@@ -1,77 +1,276 @@
 package web
 
 import (
-	lru "github.com/hashicorp/golang-lru/v2"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"github.com/CoucouMonEcho/go-framework/web/storage/local"
+	"github.com/google/uuid"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
-	"os"
+	"path"
 	"path/filepath"
-	"strconv"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// FileUploader normally use OSS
+// FileUploader stores files of multipart form into Storage, parts are streamed
+// so that limits are checked before files are fully received,
+// no file is kept if any of them fails, files are created by Storage.Create so that existing objects,
+// including those stored concurrently by other requests, are never overwritten or deleted
 type FileUploader struct {
-	FileField   string
+	// FileField is the form field of files, default "file"
+	FileField string
+	// Fields accepts files of several form fields, FileField is ignored if set
+	Fields []string
+	// DstPathFunc returns key of file in Storage, default file/upload/<uuid>/<filename>,
+	// Filename has been sanitized, Size is unknown because files are streamed,
+	// 409 is responded if the key exists or is returned for another file of the request
 	DstPathFunc func(file *multipart.FileHeader) string
+	// Storage saves files, default local disk of working directory, it is normally OSS
+	Storage storage.Storage
+	// MaxFileSize limits size of each file, unlimited if 0
+	MaxFileSize int64
+	// MaxTotalSize limits size of request body, unlimited if 0
+	MaxTotalSize int64
+	// MaxFiles limits count of files, unlimited if 0
+	MaxFiles int
+	// AllowedTypes are content types sniffed from content, such as image/png or image/*,
+	// any type is allowed if empty
+	AllowedTypes []string
 }
 
+// UploadedFile is the metadata of stored file
+type UploadedFile struct {
+	Field string `json:"field"`
+	// Filename is the sanitized name of client
+	Filename    string `json:"filename"`
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	// SHA256 is the hex checksum of content
+	SHA256 string `json:"sha256"`
+}
+
+// errFileTooLarge is returned by reader of file exceeding MaxFileSize
+var errFileTooLarge = errors.New("web: file too large")
+
+// Handle responds 201 with metadata of files as JSON,
+// errors are recorded by Context.SetError as HTTPError with status 400, 409, 413, 415 or 500
 func (fu *FileUploader) Handle() Handler {
-	// return handler
-	// do some check before handle
-	if fu.FileField == "" {
-		fu.FileField = "file"
-	}
-	if fu.DstPathFunc == nil {
-		fu.DstPathFunc = func(header *multipart.FileHeader) string {
-			return filepath.Join("file", "upload", header.Filename)
-		}
-	}
 	return func(ctx *Context) {
-		file, header, err := ctx.Req.FormFile(fu.FileField)
-		defer func() {
-			if file != nil {
-				err = file.Close()
-			}
-		}()
+		files, err := fu.Upload(ctx)
 		if err != nil {
-			ctx.RespCode = http.StatusInternalServerError
-			ctx.RespData = []byte(err.Error())
+			ctx.SetError(err)
 			return
 		}
-		// path decision left to user
-		dst := fu.DstPathFunc(header)
-		err = os.MkdirAll(dst, 0o666)
+		if err = ctx.RespJSON(http.StatusCreated, files); err != nil {
+			ctx.SetError(err)
+		}
+	}
+}
+
+// Upload stores files of request and returns their metadata for handlers responding by themselves
+func (fu *FileUploader) Upload(ctx *Context) ([]UploadedFile, error) {
+	if fu.MaxTotalSize > 0 {
+		ctx.Req.Body = http.MaxBytesReader(ctx.Resp, ctx.Req.Body, fu.MaxTotalSize)
+	}
+	reader, err := ctx.Req.MultipartReader()
+	if err != nil {
+		return nil, &HTTPError{Status: http.StatusBadRequest, Detail: "multipart form expected", Err: err}
+	}
+	var files []UploadedFile
+	keys := make(map[string]bool, 4)
+	for {
+		var part *multipart.Part
+		part, err = reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		}
 		if err != nil {
-			ctx.RespCode = http.StatusInternalServerError
-			ctx.RespData = []byte(err.Error())
-			return
+			err = requestError(err)
+			break
 		}
-		// O_WRONLY write
-		// O_TRUNC delete if exists
-		// O_CREATE create
-		dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o666)
-		defer func() {
-			if dstFile != nil {
-				err = dstFile.Close()
+		if part.FileName() == "" || !fu.accepts(part.FormName()) {
+			// drained and counted by MaxTotalSize
+			_, err = io.Copy(io.Discard, part)
+			if err != nil {
+				err = requestError(err)
+				break
 			}
-		}()
-		if err != nil {
-			ctx.RespCode = http.StatusInternalServerError
-			ctx.RespData = []byte(err.Error())
-			return
+			continue
+		}
+		if fu.MaxFiles > 0 && len(files) == fu.MaxFiles {
+			err = &HTTPError{Status: http.StatusRequestEntityTooLarge,
+				Detail: fmt.Sprintf("at most %d files are allowed", fu.MaxFiles)}
+			break
 		}
-		// buffer default 32 * 1024
-		// extension: reusable buffer
-		_, err = io.CopyBuffer(dstFile, file, nil)
+		var file UploadedFile
+		file, err = fu.store(ctx, part, keys)
 		if err != nil {
-			ctx.RespCode = http.StatusInternalServerError
-			ctx.RespData = []byte(err.Error())
-			return
+			break
+		}
+		files = append(files, file)
+	}
+	if err == nil && len(files) == 0 {
+		err = &HTTPError{Status: http.StatusBadRequest, Detail: "no file uploaded"}
+	}
+	if err != nil {
+		// only files created by this request are stored in files
+		for _, file := range files {
+			_ = fu.storage().Delete(context.WithoutCancel(ctx.Req.Context()), file.Key)
 		}
-		ctx.RespCode = http.StatusOK
+		return nil, err
+	}
+	return files, nil
+}
+
+// store puts part into storage, keys are used by previous files of the request
+func (fu *FileUploader) store(ctx *Context, part *multipart.Part, keys map[string]bool) (UploadedFile, error) {
+	file := UploadedFile{Field: part.FormName(), Filename: SanitizeFilename(part.FileName())}
+	header := &multipart.FileHeader{Filename: file.Filename, Header: part.Header}
+	if fu.DstPathFunc != nil {
+		file.Key = fu.DstPathFunc(header)
+	} else {
+		// files of the same name never collide
+		file.Key = path.Join("file", "upload", uuid.NewString(), file.Filename)
+	}
+	if !storage.ValidKey(file.Key) {
+		return file, &HTTPError{Status: http.StatusBadRequest, Detail: "invalid file path", Err: storage.ErrInvalidKey}
+	}
+	if keys[file.Key] {
+		return file, &HTTPError{Status: http.StatusConflict,
+			Detail: fmt.Sprintf("duplicate file path of %s", file.Filename)}
+	}
+	keys[file.Key] = true
+
+	// sniff by content rather than trusting Content-Type of client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return file, requestError(err)
+	}
+	head = head[:n]
+	file.ContentType = http.DetectContentType(head)
+	if !fu.allowed(file.ContentType) {
+		return file, &HTTPError{Status: http.StatusUnsupportedMediaType,
+			Detail: fmt.Sprintf("content type %s of %s is not allowed", file.ContentType, file.Filename)}
+	}
+
+	hash := sha256.New()
+	counter := &limitedReader{reader: io.MultiReader(bytes.NewReader(head), part), remaining: fu.MaxFileSize}
+	// concurrent requests of the same key are rejected by storage
+	err = fu.storage().Create(ctx.Req.Context(), file.Key, io.TeeReader(counter, hash), -1, file.ContentType)
+	switch {
+	case errors.Is(err, storage.ErrExists):
+		return file, &HTTPError{Status: http.StatusConflict, Detail: fmt.Sprintf("%s already exists", file.Filename), Err: err}
+	case errors.Is(err, errFileTooLarge):
+		return file, &HTTPError{Status: http.StatusRequestEntityTooLarge,
+			Detail: fmt.Sprintf("%s exceeds %d bytes", file.Filename, fu.MaxFileSize), Err: err}
+	case err != nil && counter.err != nil:
+		return file, requestError(counter.err)
+	case errors.Is(err, storage.ErrInvalidKey):
+		return file, &HTTPError{Status: http.StatusBadRequest, Detail: "invalid file path", Err: err}
+	case err != nil:
+		return file, err
+	}
+	file.Size = counter.read
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+func (fu *FileUploader) accepts(field string) bool {
+	if len(fu.Fields) > 0 {
+		return slices.Contains(fu.Fields, field)
+	}
+	if fu.FileField == "" {
+		return field == "file"
 	}
+	return field == fu.FileField
+}
+
+func (fu *FileUploader) allowed(contentType string) bool {
+	if len(fu.AllowedTypes) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, typ := range fu.AllowedTypes {
+		if typ == mediaType || strings.HasSuffix(typ, "/*") && strings.HasPrefix(mediaType, typ[:len(typ)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fu *FileUploader) storage() storage.Storage {
+	if fu.Storage == nil {
+		return defaultStorage
+	}
+	return fu.Storage
+}
+
+var defaultStorage = local.NewStorage(".")
+
+// requestError converts errors of reading request body
+func requestError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &HTTPError{Status: http.StatusRequestEntityTooLarge,
+			Detail: fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit), Err: err}
+	}
+	return &HTTPError{Status: http.StatusBadRequest, Detail: "malformed multipart form", Err: err}
+}
+
+// limitedReader counts bytes read and fails with errFileTooLarge after remaining exhausted,
+// it is unlimited if remaining is 0, err keeps error of reading request
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	read      int64
+	err       error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	l.read += int64(n)
+	if l.remaining > 0 && l.read > l.remaining {
+		return n, errFileTooLarge
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		l.err = err
+	}
+	return n, err
+}
+
+// SanitizeFilename keeps base name of client filename without path separators and control characters,
+// names such as .. are replaced with "file"
+func SanitizeFilename(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	for len(name) > 255 {
+		// keeps valid UTF-8
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
 }
 
 // option design for code practice
@@ -141,93 +340,3 @@ func (fd *FileDownloader) Handle() Handler {
 		http.ServeFile(ctx.Resp, ctx.Req, path)
 	}
 }
-
-type StaticResourceHandler struct {
-	dir                     string
-	pathPrefix              string
-	cache                   *lru.Cache[string, []byte]
-	extensionContentTypeMap map[string]string
-	maxSize                 int
-}
-
-type StaticResourceHandlerOption func(sh *StaticResourceHandler)
-
-func NewStaticResourceHandler(dir string, pathPrefix string, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
-	// key-value count <= 1000
-	c, err := lru.New[string, []byte](1000)
-	if err != nil {
-		return nil, err
-	}
-	res := &StaticResourceHandler{
-		dir:        dir,
-		pathPrefix: pathPrefix,
-		cache:      c,
-		extensionContentTypeMap: map[string]string{
-			"jpeg": "image/jpeg",
-			"jpe":  "image/jpeg",
-			"jpg":  "image/jpeg",
-			"png":  "image/png",
-			"pdf":  "image/pdf",
-		},
-		maxSize: 1024 * 1024 * 10,
-	}
-	for _, opt := range opts {
-		opt(res)
-	}
-	return res, nil
-}
-
-func StaticResourceHandlerWithMaxSize(maxSize int) StaticResourceHandlerOption {
-	return func(sh *StaticResourceHandler) {
-		sh.maxSize = maxSize
-	}
-}
-
-func StaticResourceHandlerWithCache(c *lru.Cache[string, []byte]) StaticResourceHandlerOption {
-	return func(sh *StaticResourceHandler) {
-		sh.cache = c
-	}
-}
-
-func StaticResourceHandlerWithMoreExtension(extMap map[string]string) StaticResourceHandlerOption {
-	return func(sh *StaticResourceHandler) {
-		for ext, contentType := range extMap {
-			sh.extensionContentTypeMap[ext] = contentType
-		}
-	}
-}
-
-func (sh *StaticResourceHandler) Handle(ctx *Context) {
-	req, err := ctx.PathValue("file").String()
-	if err != nil {
-		ctx.RespCode = http.StatusBadRequest
-		ctx.RespData = []byte(err.Error())
-		return
-	}
-	path := filepath.Join(sh.dir, sh.pathPrefix, filepath.Clean(req))
-	path, err = filepath.Abs(path)
-	if !strings.Contains(path, sh.dir) {
-		ctx.RespCode = http.StatusBadRequest
-		ctx.RespData = []byte("illegal path used")
-		return
-	}
-	var data []byte
-	var ok bool
-	if data, ok = sh.cache.Get(path); !ok {
-		data, err = os.ReadFile(path)
-		if err != nil {
-			ctx.RespCode = http.StatusInternalServerError
-			ctx.RespData = []byte(err.Error())
-			return
-		}
-		if len(data) <= sh.maxSize {
-			sh.cache.Add(path, data)
-		}
-	}
-	header := ctx.Resp.Header()
-	header.Set("Content-Type", sh.extensionContentTypeMap[filepath.Ext(path)[1:]])
-	header.Set("Content-Length", strconv.Itoa(len(data)))
-	ctx.RespCode = http.StatusOK
-	ctx.RespData = data
-	return
-}
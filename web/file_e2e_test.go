@@ -46,11 +46,12 @@ func TestFileDownloader_Handle(t *testing.T) {
 	h.Start(":8081")
 }
 
-func TestStaticResourceHandler_Handle(t *testing.T) {
+func TestStaticResourceHandler_HandleE2E(t *testing.T) {
 	h := NewHTTPServer()
-	s, err := NewStaticResourceHandler(filepath.Join("testdata", "static"), "js", StaticResourceHandlerWithMaxSize(), StaticResourceHandlerWithCache(), StaticResourceHandlerWithMoreExtension())
+	s, err := NewStaticResourceHandler(filepath.Join("testdata", "static"), "js",
+		StaticResourceHandlerWithMaxSize(1024*1024), StaticResourceHandlerWithPrecompressed())
 	require.NoError(t, err)
 	// localhost:8081/static/xxx.jpg
-	h.Get("/static/:file", s.Handle)
+	h.Get("/static/*", s.Handle)
 	h.Start(":8081")
 }
@@ -0,0 +1,314 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"github.com/CoucouMonEcho/go-framework/web/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFileUploader_HandleParts(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+	pngSum := sha256.Sum256(png)
+
+	type part struct {
+		field    string
+		filename string
+		data     []byte
+	}
+	testCases := []struct {
+		name     string
+		uploader FileUploader
+		parts    []part
+		wantCode int
+		// existing are keys stored before uploading
+		existing []string
+		// racing are keys stored by another request after they are checked
+		racing    []string
+		wantFiles []UploadedFile
+		// wantKeys are keys stored by uploading, uuid is replaced with <id>
+		wantKeys []string
+	}{
+		{
+			name:     "single",
+			uploader: FileUploader{},
+			parts:    []part{{field: "file", filename: "avatar.png", data: png}},
+			wantCode: http.StatusCreated,
+			wantFiles: []UploadedFile{{Field: "file", Filename: "avatar.png", Key: "file/upload/<id>/avatar.png",
+				Size: int64(len(png)), ContentType: "image/png", SHA256: hex.EncodeToString(pngSum[:])}},
+			wantKeys: []string{"file/upload/<id>/avatar.png"},
+		},
+		{
+			name:     "same filename",
+			uploader: FileUploader{},
+			parts: []part{
+				{field: "file", filename: "a.txt", data: []byte("a")},
+				{field: "file", filename: "a.txt", data: []byte("b")},
+			},
+			wantCode: http.StatusCreated,
+			wantKeys: []string{"file/upload/<id>/a.txt", "file/upload/<id>/a.txt"},
+		},
+		{
+			name: "duplicate key",
+			uploader: FileUploader{DstPathFunc: func(file *multipart.FileHeader) string {
+				return "users/1/" + file.Filename
+			}},
+			parts: []part{
+				{field: "file", filename: "a.txt", data: []byte("a")},
+				{field: "file", filename: "a.txt", data: []byte("b")},
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name: "existing key",
+			uploader: FileUploader{DstPathFunc: func(file *multipart.FileHeader) string {
+				return "users/1/" + file.Filename
+			}},
+			existing: []string{"users/1/b.txt"},
+			parts: []part{
+				{field: "file", filename: "a.txt", data: []byte("a")},
+				{field: "file", filename: "b.txt", data: []byte("b")},
+			},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name: "created concurrently",
+			uploader: FileUploader{DstPathFunc: func(file *multipart.FileHeader) string {
+				return "users/1/" + file.Filename
+			}},
+			racing:   []string{"users/1/a.txt"},
+			parts:    []part{{field: "file", filename: "a.txt", data: []byte("a")}},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "existing kept on failure",
+			uploader: FileUploader{MaxFiles: 1},
+			existing: []string{"file/upload/a.txt"},
+			parts: []part{
+				{field: "file", filename: "a.txt", data: []byte("a")},
+				{field: "file", filename: "b.txt", data: []byte("b")},
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "multiple fields",
+			uploader: FileUploader{
+				Fields: []string{"avatar", "docs"},
+				DstPathFunc: func(file *multipart.FileHeader) string {
+					return "users/1/" + file.Filename
+				},
+			},
+			parts: []part{
+				{field: "avatar", filename: "a.png", data: png},
+				{field: "title", data: []byte("ignored")},
+				{field: "other", filename: "ignored.txt", data: []byte("ignored")},
+				{field: "docs", filename: `C:\Users\tom\readme.txt`, data: []byte("hello")},
+				{field: "docs", filename: "../../etc/passwd", data: []byte("root")},
+			},
+			wantCode: http.StatusCreated,
+			wantKeys: []string{"users/1/a.png", "users/1/passwd", "users/1/readme.txt"},
+		},
+		{
+			name:     "type not allowed",
+			uploader: FileUploader{AllowedTypes: []string{"image/*"}},
+			parts: []part{
+				{field: "file", filename: "a.png", data: png},
+				{field: "file", filename: "a.txt", data: []byte("hello")},
+			},
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "file too large",
+			uploader: FileUploader{MaxFileSize: 16},
+			parts:    []part{{field: "file", filename: "a.png", data: png}},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "total too large",
+			uploader: FileUploader{MaxTotalSize: 512},
+			parts: []part{
+				{field: "file", filename: "a.txt", data: bytes.Repeat([]byte("a"), 200)},
+				{field: "file", filename: "b.txt", data: bytes.Repeat([]byte("b"), 400)},
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "too many files",
+			uploader: FileUploader{MaxFiles: 1},
+			parts: []part{
+				{field: "file", filename: "a.txt", data: []byte("a")},
+				{field: "file", filename: "b.txt", data: []byte("b")},
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "no file",
+			uploader: FileUploader{},
+			parts:    []part{{field: "title", data: []byte("hello")}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "invalid key",
+			uploader: FileUploader{DstPathFunc: func(file *multipart.FileHeader) string {
+				return "/" + file.Filename
+			}},
+			parts:    []part{{field: "file", filename: "a.txt", data: []byte("a")}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &recordingStorage{Storage: memory.NewStorage(), racing: tc.racing}
+			for _, key := range tc.existing {
+				require.NoError(t, store.Storage.Put(context.Background(), key, strings.NewReader("old"), 3, "text/plain"))
+			}
+			tc.uploader.Storage = store
+			h := NewHTTPServer()
+			h.Post("/upload", tc.uploader.Handle())
+
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			for _, p := range tc.parts {
+				var w io.Writer
+				var err error
+				if p.filename == "" {
+					w, err = writer.CreateFormField(p.field)
+				} else {
+					w, err = writer.CreateFormFile(p.field, p.filename)
+				}
+				require.NoError(t, err)
+				_, err = w.Write(p.data)
+				require.NoError(t, err)
+			}
+			require.NoError(t, writer.Close())
+			req := httptest.NewRequest(http.MethodPost, "/upload", body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+
+			var keys []string
+			for _, key := range store.keys {
+				if slices.Contains(tc.existing, key) || slices.Contains(tc.racing, key) {
+					continue
+				}
+				if _, err := store.Stat(context.Background(), key); err == nil {
+					keys = append(keys, uuidPattern.ReplaceAllString(key, "<id>"))
+				}
+			}
+			// nothing is kept on failure
+			slices.Sort(keys)
+			assert.Equal(t, tc.wantKeys, keys)
+			// existing objects are neither overwritten nor deleted
+			for _, key := range append(tc.existing, tc.racing...) {
+				reader, _, err := store.Get(context.Background(), key)
+				require.NoError(t, err)
+				data, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				assert.Equal(t, "old", string(data))
+			}
+			if tc.wantFiles != nil {
+				var files []UploadedFile
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &files))
+				for i := range files {
+					files[i].Key = uuidPattern.ReplaceAllString(files[i].Key, "<id>")
+				}
+				assert.Equal(t, tc.wantFiles, files)
+			}
+		})
+	}
+}
+
+func TestFileUploader_Upload(t *testing.T) {
+	store := memory.NewStorage()
+	fu := &FileUploader{Storage: store}
+	h := NewHTTPServer()
+	h.Post("/upload", func(ctx *Context) {
+		files, err := fu.Upload(ctx)
+		if err != nil {
+			ctx.SetError(err)
+			return
+		}
+		ctx.RespCode = http.StatusOK
+		ctx.RespData = []byte(files[0].Key)
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("not multipart")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	w, err := writer.CreateFormFile("file", "a.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	key := recorder.Body.String()
+	assert.Regexp(t, "^file/upload/"+uuidPattern.String()+"/a.txt$", key)
+	obj, err := store.Stat(context.Background(), key)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", obj.ContentType)
+	_, err = store.Stat(context.Background(), "a.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+var uuidPattern = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// recordingStorage records keys created by uploader,
+// racing keys are stored by "another request" right before they are created
+type recordingStorage struct {
+	storage.Storage
+	keys   []string
+	racing []string
+}
+
+func (r *recordingStorage) Create(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	r.keys = append(r.keys, key)
+	if slices.Contains(r.racing, key) {
+		if err := r.Storage.Put(ctx, key, strings.NewReader("old"), 3, "text/plain"); err != nil {
+			return err
+		}
+	}
+	return r.Storage.Create(ctx, key, reader, size, contentType)
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{name: "avatar.png", want: "avatar.png"},
+		{name: "../../etc/passwd", want: "passwd"},
+		{name: `C:\Users\tom\a.txt`, want: "a.txt"},
+		{name: "..", want: "file"},
+		{name: "", want: "file"},
+		{name: " .hidden. ", want: "hidden"},
+		{name: "a\x00b\nc<>:\"|?*.txt", want: "abc.txt"},
+		{name: "报告.pdf", want: "报告.pdf"},
+		{name: strings.Repeat("报", 100), want: strings.Repeat("报", 85)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, SanitizeFilename(tc.name))
+		})
+	}
+}
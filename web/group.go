@@ -0,0 +1,105 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouterGroup registers routes under a shared path prefix,
+// middlewares of the group only take effect on routes registered through it
+type RouterGroup struct {
+	prefix      string
+	middlewares []Middleware
+	router      *router
+	server      *HTTPServer
+}
+
+// Group creates a RouterGroup with prefix,
+// middlewares run after server middlewares and path middlewares registered by Use
+func (h *HTTPServer) Group(prefix string, middlewares ...Middleware) *RouterGroup {
+	return &RouterGroup{
+		prefix:      joinPath("/", prefix),
+		middlewares: middlewares,
+		router:      &h.router,
+		server:      h,
+	}
+}
+
+// Group creates a nested RouterGroup,
+// prefix is appended to the parent prefix and middlewares run after the parent middlewares
+func (g *RouterGroup) Group(prefix string, middlewares ...Middleware) *RouterGroup {
+	mws := make([]Middleware, 0, len(g.middlewares)+len(middlewares))
+	mws = append(mws, g.middlewares...)
+	mws = append(mws, middlewares...)
+	return &RouterGroup{
+		prefix:      joinPath(g.prefix, prefix),
+		middlewares: mws,
+		router:      g.router,
+		server:      g.server,
+	}
+}
+
+// Prefix returns the full path prefix of the group
+func (g *RouterGroup) Prefix() string {
+	return g.prefix
+}
+
+// Use registers middlewares on path under the group prefix,
+// same as HTTPServer.Use, group middlewares are not involved
+func (g *RouterGroup) Use(method string, path string, middlewares ...Middleware) {
+	g.router.addRoute(method, joinPath(g.prefix, path), nil, middlewares...)
+}
+
+func (g *RouterGroup) Get(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodGet, path, handler)
+}
+
+func (g *RouterGroup) Post(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodPost, path, handler)
+}
+
+func (g *RouterGroup) Put(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodPut, path, handler)
+}
+
+func (g *RouterGroup) Patch(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodPatch, path, handler)
+}
+
+func (g *RouterGroup) Delete(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodDelete, path, handler)
+}
+
+func (g *RouterGroup) Head(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodHead, path, handler)
+}
+
+func (g *RouterGroup) Options(path string, handler Handler) *Route {
+	return g.addRoute(http.MethodOptions, path, handler)
+}
+
+func (g *RouterGroup) Any(path string, handler Handler) *Route {
+	res := &Route{router: g.router, pattern: joinPath(g.prefix, path)}
+	for _, method := range anyMethods {
+		res.nodes = append(res.nodes, g.addRoute(method, path, handler).nodes...)
+	}
+	return res
+}
+
+func (g *RouterGroup) addRoute(method string, path string, handler Handler) *Route {
+	return g.router.addRoute(method, joinPath(g.prefix, path), handler, g.middlewares...)
+}
+
+// joinPath joins prefix and path, both of them must begin with '/'
+func joinPath(prefix string, path string) string {
+	if path == "" || path[0] != '/' {
+		panic("web: path must begin with '/'")
+	}
+	if path != "/" && path[len(path)-1] == '/' {
+		panic("web: path can not end with '/'")
+	}
+	if path == "/" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + path
+}
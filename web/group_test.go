@@ -0,0 +1,62 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterGroup(t *testing.T) {
+	var logs []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx *Context) {
+				logs = append(logs, name)
+				next(ctx)
+			}
+		}
+	}
+	h := NewHTTPServer(ServerWithMiddlewares(mark("server")))
+	h.Use(http.MethodGet, "/api", mark("use"))
+	v1 := h.Group("/api/v1", mark("v1"))
+	v1.Get("/", func(ctx *Context) {
+		logs = append(logs, "index")
+	})
+	users := v1.Group("/users", mark("users"))
+	users.Get("/:id", func(ctx *Context) {
+		logs = append(logs, "user "+ctx.PathValue("id").val)
+	})
+	h.Group("/").Get("/ping", func(ctx *Context) {
+		logs = append(logs, "ping")
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantLogs []string
+	}{
+		{"group root", "/api/v1", http.StatusOK, []string{"server", "use", "v1", "index"}},
+		{"nested group", "/api/v1/users/12", http.StatusOK, []string{"server", "use", "v1", "users", "user 12"}},
+		{"root group", "/ping", http.StatusOK, []string{"server", "ping"}},
+		{"not found", "/api/v2", http.StatusNotFound, []string{"server"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs = nil
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantLogs, logs)
+		})
+	}
+
+	assert.Equal(t, "/api/v1/users", users.Prefix())
+	assert.Panics(t, func() {
+		h.Group("api")
+	})
+	assert.Panics(t, func() {
+		v1.Group("/users/")
+	})
+}
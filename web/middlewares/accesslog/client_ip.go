@@ -0,0 +1,97 @@
+package accesslog
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP returns the real client ip of request,
+// X-Forwarded-For and Forwarded are only honoured if remote address is one of trusted proxies,
+// they are walked from right to left and the first untrusted address is the client,
+// Forwarded takes precedence over X-Forwarded-For
+func ClientIP(req *http.Request, trusted []netip.Prefix) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
+	chain := forwarded(req.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(value, ",") {
+				chain = append(chain, strings.TrimSpace(addr))
+			}
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(chain[i])
+		if !ok {
+			// forged or obfuscated entry, the hop before it can not be trusted
+			break
+		}
+		if !isTrusted(addr, trusted) || i == 0 {
+			return addr
+		}
+	}
+	return remote
+}
+
+// forwarded returns for= addresses of Forwarded by RFC 7239
+func forwarded(values []string) []string {
+	var res []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					res = append(res, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return res
+}
+
+// parseAddr strips port and brackets of address, such as [2001:db8::1]:4711
+func parseAddr(addr string) (string, bool) {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, err := netip.ParseAddr(strings.Trim(addr, "[]"))
+	if err != nil {
+		return "", false
+	}
+	return ip.Unmap().String(), true
+}
+
+func isTrusted(addr string, trusted []netip.Prefix) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses CIDR or single address
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap()
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
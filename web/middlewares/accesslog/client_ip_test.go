@@ -0,0 +1,54 @@
+package accesslog
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	testCases := []struct {
+		name    string
+		remote  string
+		header  http.Header
+		trusted []netip.Prefix
+		want    string
+	}{
+		{name: "remote", remote: "203.0.113.1:1234", want: "203.0.113.1"},
+		{name: "untrusted proxy", remote: "203.0.113.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, trusted: trusted, want: "203.0.113.1"},
+		{name: "no trusted proxies", remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: "10.0.0.1"},
+		{name: "forwarded for", remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, trusted: trusted, want: "198.51.100.1"},
+		{name: "spoofed left", remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.2"}}, trusted: trusted, want: "198.51.100.1"},
+		{name: "multiple headers", remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1", "10.0.0.3"}}, trusted: trusted, want: "198.51.100.1"},
+		{name: "all trusted", remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, trusted: trusted, want: "10.0.0.3"},
+		{name: "invalid entry", remote: "10.0.0.1:1234",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1, unknown"}}, trusted: trusted, want: "10.0.0.1"},
+		{name: "forwarded", remote: "10.0.0.1:1234",
+			header: http.Header{
+				"Forwarded":       {`for=198.51.100.2;proto=https, for="[2001:db8::1]:4711"`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			}, trusted: trusted, want: "198.51.100.2"},
+		{name: "ipv6 remote", remote: "[2001:db8::2]:1234",
+			header: http.Header{"Forwarded": {`for="[2001:db9::1]"`}}, trusted: trusted, want: "2001:db9::1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remote
+			req.Header = tc.header
+			assert.Equal(t, tc.want, ClientIP(req, tc.trusted))
+		})
+	}
+}
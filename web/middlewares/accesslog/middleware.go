@@ -1,49 +1,228 @@
 package accesslog
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/middlewares/requestid"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
 )
 
+// fields of access log
+const (
+	FieldHost      = "host"
+	FieldRoute     = "route"
+	FieldMethod    = "http_method"
+	FieldPath      = "path"
+	FieldQuery     = "query"
+	FieldProto     = "proto"
+	FieldStatus    = "status"
+	FieldLatency   = "latency"
+	FieldReqBytes  = "req_bytes"
+	FieldRespBytes = "resp_bytes"
+	FieldClientIP  = "client_ip"
+	FieldUserAgent = "user_agent"
+	FieldReferer   = "referer"
+	FieldRequestID = "request_id"
+	FieldTraceID   = "trace_id"
+	FieldSpanID    = "span_id"
+)
+
+// MiddlewareBuilder builds middleware logging every request by slog after it is handled,
+// level is Error for 5xx, Warn for 4xx and Info otherwise,
+// request id is read from requestid middleware and trace from opentelemetry middleware
 type MiddlewareBuilder struct {
-	logFunc func(log string)
+	logger  *slog.Logger
+	message string
+	fields  []string
+	trusted []netip.Prefix
+	rate    float64
+	redact  []string
 }
 
 func NewMiddlewareBuilder() *MiddlewareBuilder {
 	return &MiddlewareBuilder{
-		logFunc: func(log string) {
-			fmt.Println(log)
-		},
+		message: "access",
+		fields: []string{FieldHost, FieldRoute, FieldMethod, FieldPath, FieldQuery, FieldProto,
+			FieldStatus, FieldLatency, FieldReqBytes, FieldRespBytes, FieldClientIP, FieldUserAgent,
+			FieldReferer, FieldRequestID, FieldTraceID, FieldSpanID},
+		rate:   1,
+		redact: []string{"password", "token", "access_token", "secret", "api_key"},
 	}
 }
 
-func (m *MiddlewareBuilder) LogFunc(logFunc func(log string)) *MiddlewareBuilder {
-	m.logFunc = logFunc
+// Logger sets logger, default slog.Default
+func (m *MiddlewareBuilder) Logger(logger *slog.Logger) *MiddlewareBuilder {
+	m.logger = logger
+	return m
+}
+
+// Message sets message of records, default access
+func (m *MiddlewareBuilder) Message(message string) *MiddlewareBuilder {
+	m.message = message
+	return m
+}
+
+// Fields sets fields to log in order, default all, empty values are omitted
+func (m *MiddlewareBuilder) Fields(fields ...string) *MiddlewareBuilder {
+	m.fields = fields
+	return m
+}
+
+// TrustedProxies sets addresses or CIDRs of proxies whose X-Forwarded-For and Forwarded are trusted,
+// client ip is the remote address if none is set
+func (m *MiddlewareBuilder) TrustedProxies(proxies ...string) *MiddlewareBuilder {
+	m.trusted = make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			panic("accesslog: invalid trusted proxy " + proxy)
+		}
+		m.trusted = append(m.trusted, prefix)
+	}
+	return m
+}
+
+// Sample logs the given fraction of requests, responses of 4xx and 5xx are always logged
+func (m *MiddlewareBuilder) Sample(rate float64) *MiddlewareBuilder {
+	m.rate = rate
+	return m
+}
+
+// Redact sets query params whose values are replaced by REDACTED, names are case-insensitive,
+// default password, token, access_token, secret and api_key
+func (m *MiddlewareBuilder) Redact(params ...string) *MiddlewareBuilder {
+	m.redact = params
 	return m
 }
 
 func (m *MiddlewareBuilder) Build() web.Middleware {
 	return func(next web.Handler) web.Handler {
 		return func(ctx *web.Context) {
-			// finish route handler to get matched route
+			start := time.Now()
+			body := &countReader{ReadCloser: ctx.Req.Body}
+			if ctx.Req.Body != nil {
+				ctx.Req.Body = body
+			}
+			// finish route handler to get matched route and status
 			defer func() {
-				data, _ := json.Marshal(AccessLog{
-					Host:       ctx.Req.Host,
-					Route:      ctx.MatchedRoute,
-					HTTPMethod: ctx.Req.Method,
-					Path:       ctx.Req.URL.Path,
-				})
-				m.logFunc(string(data))
+				status := ctx.RespCode
+				if status == 0 {
+					status = http.StatusOK
+				}
+				if status < http.StatusBadRequest && m.rate < 1 && rand.Float64() >= m.rate {
+					return
+				}
+				logger := m.logger
+				if logger == nil {
+					logger = slog.Default()
+				}
+				level := slog.LevelInfo
+				if status >= http.StatusInternalServerError {
+					level = slog.LevelError
+				} else if status >= http.StatusBadRequest {
+					level = slog.LevelWarn
+				}
+				if !logger.Enabled(ctx.Req.Context(), level) {
+					return
+				}
+				attrs := make([]slog.Attr, 0, len(m.fields))
+				for _, field := range m.fields {
+					if attr, ok := m.attr(ctx, field, status, time.Since(start), body.n); ok {
+						attrs = append(attrs, attr)
+					}
+				}
+				logger.LogAttrs(context.WithoutCancel(ctx.Req.Context()), level, m.message, attrs...)
 			}()
 			next(ctx)
 		}
 	}
 }
 
-type AccessLog struct {
-	Host       string `json:"host,omitempty"`
-	Route      string `json:"route,omitempty"`
-	HTTPMethod string `json:"http_method,omitempty"`
-	Path       string `json:"path,omitempty"`
+// attr returns attribute of field, false if value is empty
+func (m *MiddlewareBuilder) attr(ctx *web.Context, field string, status int, latency time.Duration, reqBytes int64) (slog.Attr, bool) {
+	req := ctx.Req
+	var val string
+	switch field {
+	case FieldHost:
+		val = req.Host
+	case FieldRoute:
+		val = ctx.MatchedRoute
+	case FieldMethod:
+		val = req.Method
+	case FieldPath:
+		val = req.URL.Path
+	case FieldQuery:
+		val = redactQuery(req.URL.RawQuery, m.redact)
+	case FieldProto:
+		val = req.Proto
+	case FieldStatus:
+		return slog.Int(field, status), true
+	case FieldLatency:
+		return slog.Duration(field, latency), true
+	case FieldReqBytes:
+		return slog.Int64(field, reqBytes), true
+	case FieldRespBytes:
+		return slog.Int(field, ctx.RespSize()), true
+	case FieldClientIP:
+		val = ClientIP(req, m.trusted)
+	case FieldUserAgent:
+		val = req.UserAgent()
+	case FieldReferer:
+		val = req.Referer()
+	case FieldRequestID:
+		val, _ = requestid.FromContext(req.Context())
+	case FieldTraceID:
+		if sc := trace.SpanContextFromContext(req.Context()); sc.HasTraceID() {
+			val = sc.TraceID().String()
+		}
+	case FieldSpanID:
+		if sc := trace.SpanContextFromContext(req.Context()); sc.HasSpanID() {
+			val = sc.SpanID().String()
+		}
+	}
+	return slog.String(field, val), val != ""
+}
+
+// redactQuery replaces values of params in raw query, order of params is kept
+func redactQuery(query string, params []string) string {
+	if query == "" || len(params) == 0 {
+		return query
+	}
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		name, _, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if slices.ContainsFunc(params, func(param string) bool {
+			return strings.EqualFold(param, name)
+		}) {
+			parts[i] = part[:strings.IndexByte(part, '=')] + "=REDACTED"
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// countReader counts bytes of request body read by handler
+type countReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
 }
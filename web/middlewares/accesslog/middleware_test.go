@@ -1,28 +1,140 @@
 package accesslog
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/json"
 	"github.com/CoucouMonEcho/go-framework/web"
-	"log"
+	"github.com/CoucouMonEcho/go-framework/web/middlewares/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log/slog"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
-func TestMiddleBuilder_Build(t *testing.T) {
-	builder := NewMiddlewareBuilder()
-	builder.LogFunc(func(log string) {
-		fmt.Println(log)
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+	builder := NewMiddlewareBuilder().Logger(logger).TrustedProxies("10.0.0.0/8")
+	h := web.NewHTTPServer(web.ServerWithMiddlewares(
+		builder.Build(),
+		requestid.NewMiddlewareBuilder().Build()))
+	h.Post("/user/*", func(ctx *web.Context) {
+		data, _ := io.ReadAll(ctx.Req.Body)
+		ctx.RespData = data
 	})
-	h := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()), web.ServerWithLogger(func(msg string, args ...any) {
-		log.Println(msg, args)
-	}))
-	h.Get("/user/*", func(ctx *web.Context) {
-		fmt.Println("A")
+	h.Get("/error", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusInternalServerError
 	})
-	request := httptest.NewRequest("GET", "/user/login", nil)
-	h.ServeHTTP(nil, request)
-	//h.Get("/user/login", func(ctx *web.Context) {
-	//	ctx.Resp.Write([]byte("<h1>Hello World</h1>"))
-	//})
-	//h.Start(":8081")
+
+	testCases := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		header    http.Header
+		wantLevel string
+		want      map[string]any
+	}{
+		{
+			name:   "post",
+			method: http.MethodPost,
+			target: "/user/login?name=tom&Password=123",
+			body:   "hello",
+			header: http.Header{
+				"X-Request-Id":    {"req-1"},
+				"X-Forwarded-For": {"203.0.113.9, 10.0.0.2"},
+				"User-Agent":      {"test"},
+			},
+			wantLevel: "INFO",
+			want: map[string]any{
+				FieldHost:      "example.com",
+				FieldRoute:     "/user/*",
+				FieldMethod:    http.MethodPost,
+				FieldPath:      "/user/login",
+				FieldQuery:     "name=tom&Password=REDACTED",
+				FieldProto:     "HTTP/1.1",
+				FieldStatus:    float64(http.StatusOK),
+				FieldReqBytes:  float64(5),
+				FieldRespBytes: float64(5),
+				FieldClientIP:  "203.0.113.9",
+				FieldUserAgent: "test",
+				FieldRequestID: "req-1",
+			},
+		},
+		{
+			name:      "error",
+			method:    http.MethodGet,
+			target:    "/error",
+			wantLevel: "ERROR",
+			want: map[string]any{
+				FieldRoute:     "/error",
+				FieldStatus:    float64(http.StatusInternalServerError),
+				FieldReqBytes:  float64(0),
+				FieldRespBytes: float64(0),
+				FieldClientIP:  "10.0.0.1",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buffer.Reset()
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			req.RemoteAddr = "10.0.0.1:1234"
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			record := map[string]any{}
+			require.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+			assert.Equal(t, tc.wantLevel, record["level"])
+			assert.Equal(t, "access", record["msg"])
+			assert.Contains(t, record, FieldLatency)
+			for key, val := range tc.want {
+				assert.Equal(t, val, record[key], key)
+			}
+			if _, ok := tc.want[FieldRequestID]; !ok {
+				// generated by requestid middleware
+				assert.NotEmpty(t, record[FieldRequestID])
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Sample(t *testing.T) {
+	var buffer bytes.Buffer
+	builder := NewMiddlewareBuilder().Logger(slog.New(slog.NewTextHandler(&buffer, nil))).
+		Fields(FieldRoute, FieldStatus).Sample(0)
+	h := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()))
+	h.Get("/ok", func(ctx *web.Context) {})
+	h.Get("/bad", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusBadRequest
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Empty(t, buffer.String())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bad", nil))
+	assert.Contains(t, buffer.String(), "level=WARN msg=access route=/bad status=400\n")
+}
+
+func TestRedactQuery(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "", want: ""},
+		{name: "kept", query: "b=1&a=2", want: "b=1&a=2"},
+		{name: "redacted", query: "token=abc&a=1&TOKEN=def", want: "token=REDACTED&a=1&TOKEN=REDACTED"},
+		{name: "escaped name", query: "api%5Fkey=abc", want: "api%5Fkey=REDACTED"},
+		{name: "no value", query: "token", want: "token"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, redactQuery(tc.query, []string{"token", "api_key"}))
+		})
+	}
 }
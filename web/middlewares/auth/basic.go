@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"strconv"
+)
+
+// BasicChecker returns principal if username and password are valid
+type BasicChecker func(ctx context.Context, username string, password string) (*Principal, error)
+
+// BasicAuthenticator authenticates HTTP Basic credentials
+type BasicAuthenticator struct {
+	Realm string
+	Check BasicChecker
+}
+
+func (a BasicAuthenticator) Authenticate(ctx *web.Context) (*Principal, error) {
+	username, password, ok := ctx.Req.BasicAuth()
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	principal, err := a.Check(ctx.Req.Context(), username, password)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, ErrUnauthenticated
+	}
+	if principal.Scheme == "" {
+		principal.Scheme = "Basic"
+	}
+	return principal, nil
+}
+
+func (a BasicAuthenticator) Challenge(error) string {
+	return "Basic realm=" + strconv.Quote(a.Realm) + `, charset="UTF-8"`
+}
+
+// StaticCredentials checks username and password in accounts in constant time
+func StaticCredentials(accounts map[string]string) BasicChecker {
+	hashes := make(map[string][32]byte, len(accounts))
+	for username, password := range accounts {
+		hashes[username] = sha256.Sum256([]byte(password))
+	}
+	return func(_ context.Context, username string, password string) (*Principal, error) {
+		want, ok := hashes[username]
+		got := sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(want[:], got[:]) != 1 || !ok {
+			return nil, ErrUnauthenticated
+		}
+		return &Principal{Subject: username}, nil
+	}
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var (
+	ErrTokenMalformed    = errors.New("auth: malformed token")
+	ErrTokenUnverifiable = errors.New("auth: no key to verify token")
+	ErrSignatureInvalid  = errors.New("auth: invalid signature")
+	ErrTokenExpired      = errors.New("auth: token is expired")
+	ErrTokenNotValidYet  = errors.New("auth: token is not valid yet")
+	ErrIssuerInvalid     = errors.New("auth: invalid issuer")
+	ErrAudienceInvalid   = errors.New("auth: invalid audience")
+)
+
+// JWTKey verifies tokens signed by Algorithm,
+// Key is []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey of P-256 for ES256
+type JWTKey struct {
+	// ID is matched with kid of token header, key without ID verifies tokens without kid
+	ID        string
+	Algorithm string
+	Key       any
+}
+
+// Claims are payload of JWT, numbers are decoded as json.Number
+type Claims map[string]any
+
+// Subject returns sub claim
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Audience returns aud claim which could be a string or an array
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		res := make([]string, 0, len(aud))
+		for _, val := range aud {
+			if str, ok := val.(string); ok {
+				res = append(res, str)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// Time returns NumericDate claim, such as exp, nbf and iat
+func (c Claims) Time(name string) (time.Time, bool, error) {
+	val, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	num, ok := val.(json.Number)
+	if !ok {
+		return time.Time{}, true, fmt.Errorf("%w: %s is not a number", ErrTokenMalformed, name)
+	}
+	seconds, err := num.Float64()
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("%w: %s is not a number", ErrTokenMalformed, name)
+	}
+	sec, frac := int64(seconds), seconds-float64(int64(seconds))
+	return time.Unix(sec, int64(frac*float64(time.Second))), true, nil
+}
+
+// JWTVerifier verifies signature and registered claims of JWT,
+// keys could be rotated by SetKeys when verifying
+type JWTVerifier struct {
+	mutex    sync.RWMutex
+	keys     []JWTKey
+	issuer   string
+	audience string
+	skew     time.Duration
+	now      func() time.Time
+}
+
+func NewJWTVerifier(keys ...JWTKey) *JWTVerifier {
+	res := &JWTVerifier{now: time.Now}
+	res.SetKeys(keys...)
+	return res
+}
+
+// SetKeys replaces keys, it panics if key type does not match algorithm
+func (v *JWTVerifier) SetKeys(keys ...JWTKey) {
+	for _, key := range keys {
+		var ok bool
+		switch key.Algorithm {
+		case HS256:
+			_, ok = key.Key.([]byte)
+		case RS256:
+			_, ok = key.Key.(*rsa.PublicKey)
+		case ES256:
+			var pub *ecdsa.PublicKey
+			pub, ok = key.Key.(*ecdsa.PublicKey)
+			ok = ok && pub.Curve == elliptic.P256()
+		}
+		if !ok {
+			panic(fmt.Sprintf("auth: invalid %s key %s", key.Algorithm, key.ID))
+		}
+	}
+	v.mutex.Lock()
+	v.keys = slices.Clone(keys)
+	v.mutex.Unlock()
+}
+
+// Issuer requires iss claim equals issuer
+func (v *JWTVerifier) Issuer(issuer string) *JWTVerifier {
+	v.issuer = issuer
+	return v
+}
+
+// Audience requires aud claim contains audience
+func (v *JWTVerifier) Audience(audience string) *JWTVerifier {
+	v.audience = audience
+	return v
+}
+
+// Skew tolerates clock difference when checking exp and nbf
+func (v *JWTVerifier) Skew(skew time.Duration) *JWTVerifier {
+	v.skew = skew
+	return v
+}
+
+// Verify returns claims of token if its signature and claims are valid
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	key, ok := v.key(header.Kid, header.Alg)
+	if !ok {
+		return nil, ErrTokenUnverifiable
+	}
+	if err = verifySignature(key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, v.validate(claims)
+}
+
+// key returns key with kid, algorithm of key must be alg to avoid algorithm confusion
+func (v *JWTVerifier) key(kid string, alg string) (JWTKey, bool) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	for _, key := range v.keys {
+		if key.ID == kid && key.Algorithm == alg {
+			return key, true
+		}
+	}
+	return JWTKey{}, false
+}
+
+func (v *JWTVerifier) validate(claims Claims) error {
+	now := v.now()
+	exp, ok, err := claims.Time("exp")
+	if err != nil {
+		return err
+	}
+	if ok && !now.Before(exp.Add(v.skew)) {
+		return ErrTokenExpired
+	}
+	nbf, ok, err := claims.Time("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.skew).Before(nbf) {
+		return ErrTokenNotValidYet
+	}
+	if iss, _ := claims["iss"].(string); v.issuer != "" && iss != v.issuer {
+		return ErrIssuerInvalid
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience(), v.audience) {
+		return ErrAudienceInvalid
+	}
+	return nil
+}
+
+func decodeSegment(seg string, val any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(val); err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenMalformed, err)
+	}
+	return nil
+}
+
+func verifySignature(key JWTKey, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	var ok bool
+	switch key.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, key.Key.([]byte))
+		mac.Write([]byte(signed))
+		ok = hmac.Equal(sig, mac.Sum(nil))
+	case RS256:
+		ok = rsa.VerifyPKCS1v15(key.Key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		// r and s are 32 bytes big-endian integers
+		if len(sig) == 64 {
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(key.Key.(*ecdsa.PublicKey), digest[:], r, s)
+		}
+	}
+	if !ok {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// JWTAuthenticator authenticates bearer token of Authorization header
+type JWTAuthenticator struct {
+	Verifier *JWTVerifier
+	// Lookup returns token of request, default bearer token of Authorization header
+	Lookup func(ctx *web.Context) string
+}
+
+func (a JWTAuthenticator) Authenticate(ctx *web.Context) (*Principal, error) {
+	lookup := a.Lookup
+	if lookup == nil {
+		lookup = bearerToken
+	}
+	token := lookup(ctx)
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	claims, err := a.Verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: claims.Subject(), Scheme: "Bearer", Claims: claims}, nil
+}
+
+func (a JWTAuthenticator) Challenge(err error) string {
+	if errors.Is(err, ErrUnauthenticated) {
+		return "Bearer"
+	}
+	return `Bearer error="invalid_token"`
+}
+
+func bearerToken(ctx *web.Context) string {
+	scheme, token, ok := strings.Cut(ctx.Req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
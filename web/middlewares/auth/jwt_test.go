@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, alg string, kid string, key any, claims map[string]any) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerData, err := json.Marshal(header)
+	require.NoError(t, err)
+	claimsData, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(headerData) + "." + base64.RawURLEncoding.EncodeToString(claimsData)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case RS256:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case ES256:
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerifier_Verify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	verifier := NewJWTVerifier(
+		JWTKey{Algorithm: HS256, Key: secret},
+		JWTKey{ID: "rsa-1", Algorithm: RS256, Key: &rsaKey.PublicKey},
+		JWTKey{ID: "ec-1", Algorithm: ES256, Key: &ecKey.PublicKey},
+	).Issuer("framework").Audience("api").Skew(time.Minute)
+	verifier.now = func() time.Time {
+		return now
+	}
+	valid := map[string]any{
+		"sub": "tom",
+		"iss": "framework",
+		"aud": []string{"web", "api"},
+		"exp": now.Add(time.Hour).Unix(),
+		"nbf": now.Add(-time.Hour).Unix(),
+	}
+	with := func(key string, val any) map[string]any {
+		res := make(map[string]any, len(valid))
+		for k, v := range valid {
+			res[k] = v
+		}
+		if val == nil {
+			delete(res, key)
+		} else {
+			res[key] = val
+		}
+		return res
+	}
+
+	testCases := []struct {
+		name    string
+		token   string
+		wantSub string
+		wantErr error
+	}{
+		{name: "HS256", token: sign(t, HS256, "", secret, valid), wantSub: "tom"},
+		{name: "RS256", token: sign(t, RS256, "rsa-1", rsaKey, valid), wantSub: "tom"},
+		{name: "ES256", token: sign(t, ES256, "ec-1", ecKey, valid), wantSub: "tom"},
+		{name: "aud string", token: sign(t, HS256, "", secret, with("aud", "api")), wantSub: "tom"},
+		{name: "expired in skew", token: sign(t, HS256, "", secret, with("exp", now.Add(-30*time.Second).Unix())), wantSub: "tom"},
+		{name: "expired", token: sign(t, HS256, "", secret, with("exp", now.Add(-2*time.Minute).Unix())), wantErr: ErrTokenExpired},
+		{name: "not valid in skew", token: sign(t, HS256, "", secret, with("nbf", now.Add(30*time.Second).Unix())), wantSub: "tom"},
+		{name: "not valid yet", token: sign(t, HS256, "", secret, with("nbf", now.Add(2*time.Minute).Unix())), wantErr: ErrTokenNotValidYet},
+		{name: "exp not number", token: sign(t, HS256, "", secret, with("exp", "tomorrow")), wantErr: ErrTokenMalformed},
+		{name: "issuer", token: sign(t, HS256, "", secret, with("iss", "other")), wantErr: ErrIssuerInvalid},
+		{name: "no issuer", token: sign(t, HS256, "", secret, with("iss", nil)), wantErr: ErrIssuerInvalid},
+		{name: "audience", token: sign(t, HS256, "", secret, with("aud", "web")), wantErr: ErrAudienceInvalid},
+		{name: "wrong secret", token: sign(t, HS256, "", []byte("other"), valid), wantErr: ErrSignatureInvalid},
+		{name: "unknown kid", token: sign(t, RS256, "rsa-2", rsaKey, valid), wantErr: ErrTokenUnverifiable},
+		// public key of RS256 must not be used as HMAC secret
+		{name: "algorithm confusion", token: sign(t, HS256, "rsa-1", []byte("public key"), valid), wantErr: ErrTokenUnverifiable},
+		{name: "none", token: sign(t, "none", "", nil, valid), wantErr: ErrTokenUnverifiable},
+		{name: "malformed", token: "a.b", wantErr: ErrTokenMalformed},
+		{name: "bad base64", token: "a.b.c", wantErr: ErrTokenMalformed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tc.token)
+			assert.ErrorIs(t, err, tc.wantErr)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantSub, claims.Subject())
+		})
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		old := sign(t, RS256, "rsa-1", rsaKey, valid)
+		token := sign(t, RS256, "rsa-2", rotated, valid)
+		verifier.SetKeys(JWTKey{ID: "rsa-2", Algorithm: RS256, Key: &rotated.PublicKey})
+		_, err = verifier.Verify(token)
+		assert.NoError(t, err)
+		_, err = verifier.Verify(old)
+		assert.ErrorIs(t, err, ErrTokenUnverifiable)
+	})
+
+	assert.Panics(t, func() {
+		NewJWTVerifier(JWTKey{Algorithm: RS256, Key: secret})
+	})
+}
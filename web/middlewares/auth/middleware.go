@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"net/http"
+)
+
+// PrincipalKey is the key of principal in Context.UserValues
+const PrincipalKey = "auth.principal"
+
+var (
+	// ErrUnauthenticated is returned by Authenticator if request carries no credential
+	ErrUnauthenticated = errors.New("auth: unauthenticated")
+	// ErrForbidden is returned by Authenticator if principal is not allowed
+	ErrForbidden = errors.New("auth: forbidden")
+)
+
+// Principal is the authenticated subject of request
+type Principal struct {
+	Subject string
+	// Scheme is the authentication scheme, such as Bearer or Basic
+	Scheme string
+	// Claims are verified claims of JWT
+	Claims Claims
+}
+
+// Authenticator extracts principal from request,
+// 403 is responded if error is ErrForbidden, otherwise 401
+type Authenticator interface {
+	Authenticate(ctx *web.Context) (*Principal, error)
+	// Challenge returns value of WWW-Authenticate header for error
+	Challenge(err error) string
+}
+
+type principalKey struct{}
+
+// FromContext returns principal stored by middleware
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// PrincipalOf returns principal stored in ctx.UserValues by middleware
+func PrincipalOf(ctx *web.Context) (*Principal, bool) {
+	principal, ok := ctx.UserValues[PrincipalKey].(*Principal)
+	return principal, ok
+}
+
+// MiddlewareBuilder builds authentication middleware,
+// principal is stored in Context.UserValues and request context,
+// 401 and 403 are recorded by Context.SetError as web.HTTPError so that errhandle renders them,
+// cause of error is never exposed
+type MiddlewareBuilder struct {
+	authenticator Authenticator
+	skip          func(ctx *web.Context) bool
+	routes        map[string]bool
+	authorize     func(ctx *web.Context, principal *Principal) bool
+}
+
+func NewMiddlewareBuilder(authenticator Authenticator) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		authenticator: authenticator,
+		routes:        make(map[string]bool, 8),
+	}
+}
+
+// Skip opts out requests which skip returns true for
+func (m *MiddlewareBuilder) Skip(skip func(ctx *web.Context) bool) *MiddlewareBuilder {
+	m.skip = skip
+	return m
+}
+
+// SkipRoutes opts out routes by pattern, such as /users/:id,
+// request path is compared if no route matched
+func (m *MiddlewareBuilder) SkipRoutes(routes ...string) *MiddlewareBuilder {
+	for _, route := range routes {
+		m.routes[route] = true
+	}
+	return m
+}
+
+// Authorize responds 403 if authorize returns false for the authenticated principal
+func (m *MiddlewareBuilder) Authorize(authorize func(ctx *web.Context, principal *Principal) bool) *MiddlewareBuilder {
+	m.authorize = authorize
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return func(ctx *web.Context) {
+			if m.skipped(ctx) {
+				next(ctx)
+				return
+			}
+			principal, err := m.authenticator.Authenticate(ctx)
+			if err == nil && m.authorize != nil && !m.authorize(ctx, principal) {
+				err = ErrForbidden
+			}
+			if err != nil {
+				if errors.Is(err, ErrForbidden) {
+					ctx.SetError(&web.HTTPError{Status: http.StatusForbidden, Detail: "permission denied", Err: err})
+					return
+				}
+				if challenge := m.authenticator.Challenge(err); challenge != "" {
+					ctx.Resp.Header().Set("WWW-Authenticate", challenge)
+				}
+				ctx.SetError(&web.HTTPError{Status: http.StatusUnauthorized, Detail: "authentication required", Err: err})
+				return
+			}
+			if ctx.UserValues == nil {
+				ctx.UserValues = make(map[string]any, 4)
+			}
+			ctx.UserValues[PrincipalKey] = principal
+			ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), principalKey{}, principal))
+			next(ctx)
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) skipped(ctx *web.Context) bool {
+	if ctx.Req.Method == http.MethodOptions && ctx.MatchedRoute == "" &&
+		ctx.Req.Header.Get("Access-Control-Request-Method") != "" {
+		// preflight carries no credential, it is skipped only if answered by server automatically,
+		// handlers registered for OPTIONS explicitly are still protected
+		return true
+	}
+	route := ctx.MatchedRoute
+	if route == "" {
+		route = ctx.Req.URL.Path
+	}
+	return m.routes[route] || m.skip != nil && m.skip(ctx)
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"encoding/json"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/middlewares/errhandle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	secret := []byte("secret")
+	verifier := NewJWTVerifier(JWTKey{Algorithm: HS256, Key: secret})
+	jwtBuilder := NewMiddlewareBuilder(JWTAuthenticator{Verifier: verifier}).
+		SkipRoutes("/api/login").
+		Authorize(func(ctx *web.Context, principal *Principal) bool {
+			return ctx.MatchedRoute != "/api/admin" || principal.Claims["role"] == "admin"
+		})
+	basicBuilder := NewMiddlewareBuilder(BasicAuthenticator{
+		Realm: "internal",
+		Check: StaticCredentials(map[string]string{"ops": "pass"}),
+	})
+
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(
+		errhandle.NewMiddlewareBuilder().
+			RegisterError(http.StatusUnauthorized, []byte("login required")).
+			RegisterError(http.StatusForbidden, []byte("no permission")).
+			Build()))
+	whoami := func(ctx *web.Context) {
+		principal, ok := PrincipalOf(ctx)
+		if !ok {
+			ctx.RespData = []byte("anonymous")
+			return
+		}
+		fromCtx, _ := FromContext(ctx.Req.Context())
+		assert.Same(t, principal, fromCtx)
+		ctx.RespData = []byte(principal.Scheme + " " + principal.Subject)
+	}
+	api := server.Group("/api", jwtBuilder.Build())
+	api.Get("/me", whoami)
+	api.Get("/admin", whoami)
+	api.Post("/login", whoami)
+	api.Options("/files", whoami)
+	server.Group("/internal", basicBuilder.Build()).Get("/me", whoami)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	userToken := sign(t, HS256, "", secret, map[string]any{"sub": "tom", "exp": exp})
+	adminToken := sign(t, HS256, "", secret, map[string]any{"sub": "root", "role": "admin", "exp": exp})
+	expiredToken := sign(t, HS256, "", secret, map[string]any{"sub": "tom", "exp": time.Now().Add(-time.Hour).Unix()})
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		header        map[string]string
+		basic         []string
+		wantCode      int
+		wantBody      string
+		wantChallenge string
+	}{
+		{name: "bearer", path: "/api/me", header: map[string]string{"Authorization": "Bearer " + userToken},
+			wantCode: http.StatusOK, wantBody: "Bearer tom"},
+		{name: "no token", path: "/api/me",
+			wantCode: http.StatusUnauthorized, wantBody: "login required", wantChallenge: "Bearer"},
+		{name: "expired", path: "/api/me", header: map[string]string{"Authorization": "Bearer " + expiredToken},
+			wantCode: http.StatusUnauthorized, wantBody: "login required", wantChallenge: `Bearer error="invalid_token"`},
+		{name: "other scheme", path: "/api/me", header: map[string]string{"Authorization": "Token " + userToken},
+			wantCode: http.StatusUnauthorized, wantBody: "login required", wantChallenge: "Bearer"},
+		{name: "forbidden", path: "/api/admin", header: map[string]string{"Authorization": "Bearer " + userToken},
+			wantCode: http.StatusForbidden, wantBody: "no permission"},
+		{name: "authorized", path: "/api/admin", header: map[string]string{"Authorization": "Bearer " + adminToken},
+			wantCode: http.StatusOK, wantBody: "Bearer root"},
+		{name: "skip route", method: http.MethodPost, path: "/api/login",
+			wantCode: http.StatusOK, wantBody: "anonymous"},
+		{name: "skip preflight", method: http.MethodOptions, path: "/api/me",
+			header:   map[string]string{"Origin": "https://a.com", "Access-Control-Request-Method": "GET"},
+			wantCode: http.StatusNoContent},
+		{name: "explicit options", method: http.MethodOptions, path: "/api/files",
+			header:   map[string]string{"Origin": "https://a.com", "Access-Control-Request-Method": "PATCH"},
+			wantCode: http.StatusUnauthorized, wantBody: "login required", wantChallenge: "Bearer"},
+		{name: "basic", path: "/internal/me", basic: []string{"ops", "pass"},
+			wantCode: http.StatusOK, wantBody: "Basic ops"},
+		{name: "basic wrong password", path: "/internal/me", basic: []string{"ops", "wrong"},
+			wantCode: http.StatusUnauthorized, wantBody: "login required", wantChallenge: `Basic realm="internal", charset="UTF-8"`},
+		{name: "basic unknown user", path: "/internal/me", basic: []string{"dev", "pass"},
+			wantCode: http.StatusUnauthorized, wantBody: "login required", wantChallenge: `Basic realm="internal", charset="UTF-8"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			if tc.basic != nil {
+				req.SetBasicAuth(tc.basic[0], tc.basic[1])
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantChallenge, recorder.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Problem(t *testing.T) {
+	builder := NewMiddlewareBuilder(JWTAuthenticator{Verifier: NewJWTVerifier(JWTKey{Algorithm: HS256, Key: []byte("secret")})}).
+		Authorize(func(ctx *web.Context, principal *Principal) bool {
+			return false
+		})
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(errhandle.NewMiddlewareBuilder().Build(), builder.Build()))
+	server.Get("/me", func(ctx *web.Context) {
+		ctx.RespData = []byte("me")
+	})
+	token := sign(t, HS256, "", []byte("secret"), map[string]any{"sub": "tom", "exp": time.Now().Add(time.Hour).Unix()})
+
+	testCases := []struct {
+		name          string
+		token         string
+		wantCode      int
+		wantDetail    string
+		wantChallenge string
+	}{
+		{name: "unauthorized", token: "invalid", wantCode: http.StatusUnauthorized,
+			wantDetail: "authentication required", wantChallenge: `Bearer error="invalid_token"`},
+		{name: "forbidden", token: token, wantCode: http.StatusForbidden, wantDetail: "permission denied"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, "application/problem+json", recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantChallenge, recorder.Header().Get("WWW-Authenticate"))
+			var problem map[string]any
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(t, tc.wantDetail, problem["detail"])
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	Zstd    = "zstd"
+	Gzip    = "gzip"
+	Deflate = "deflate"
+)
+
+// MiddlewareBuilder builds middleware compressing RespData and streamed bodies,
+// encoding is negotiated by Accept-Encoding, ties are broken by order of Encodings
+type MiddlewareBuilder struct {
+	encodings []string
+	minSize   int
+	types     []string
+	pools     map[string]*sync.Pool
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		encodings: []string{Zstd, Gzip, Deflate},
+		minSize:   1024,
+		types: []string{
+			"text/",
+			"application/json",
+			"application/problem+json",
+			"application/javascript",
+			"application/xml",
+			"image/svg+xml",
+		},
+	}
+}
+
+// Encodings sets supported encodings in preference order, default zstd, gzip and deflate
+func (m *MiddlewareBuilder) Encodings(encodings ...string) *MiddlewareBuilder {
+	for _, encoding := range encodings {
+		if !slices.Contains([]string{Zstd, Gzip, Deflate}, encoding) {
+			panic(fmt.Sprintf("compress: unsupported encoding %s", encoding))
+		}
+	}
+	m.encodings = encodings
+	return m
+}
+
+// MinSize sets the minimum size of RespData to compress, default 1024,
+// streamed bodies are always compressed unless Content-Length is smaller
+func (m *MiddlewareBuilder) MinSize(size int) *MiddlewareBuilder {
+	m.minSize = size
+	return m
+}
+
+// Types sets media types to compress, type ends with '/' matches all subtypes,
+// default text/, application/json, application/problem+json, application/javascript,
+// application/xml and image/svg+xml
+func (m *MiddlewareBuilder) Types(types ...string) *MiddlewareBuilder {
+	m.types = types
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	m.pools = map[string]*sync.Pool{
+		Gzip: {New: func() any {
+			return gzip.NewWriter(io.Discard)
+		}},
+		Deflate: {New: func() any {
+			return zlib.NewWriter(io.Discard)
+		}},
+		Zstd: {New: func() any {
+			w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1))
+			return w
+		}},
+	}
+	return func(next web.Handler) web.Handler {
+		return func(ctx *web.Context) {
+			encoding := negotiate(ctx.Req.Header.Get("Accept-Encoding"), m.encodings)
+			if encoding == "" || ctx.Req.Header.Get("Upgrade") != "" {
+				next(ctx)
+				return
+			}
+			resp := ctx.Resp
+			writer := &responseWriter{ResponseWriter: resp, builder: m, encoding: encoding}
+			ctx.Resp = writer
+			defer func() {
+				ctx.Resp = resp
+				writer.close()
+			}()
+			next(ctx)
+			if ctx.Committed() {
+				return
+			}
+			if !m.compressible(resp.Header(), ctx.RespCode) || len(ctx.RespData) < m.minSize {
+				return
+			}
+			var buffer bytes.Buffer
+			encoder := m.encoder(encoding, &buffer)
+			_, err := encoder.Write(ctx.RespData)
+			if err == nil {
+				err = encoder.Close()
+			}
+			m.pools[encoding].Put(encoder)
+			if err != nil {
+				return
+			}
+			setHeaders(resp.Header(), encoding)
+			ctx.RespData = buffer.Bytes()
+		}
+	}
+}
+
+// compressible reports whether response could be compressed by status and headers,
+// Vary is added as response differs by Accept-Encoding
+func (m *MiddlewareBuilder) compressible(header http.Header, status int) bool {
+	header.Add("Vary", "Accept-Encoding")
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent ||
+		status >= 100 && status < 200 {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" {
+		// already compressed
+		return false
+	}
+	typ, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range m.types {
+		if typ == allowed || strings.HasSuffix(allowed, "/") && strings.HasPrefix(typ, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (m *MiddlewareBuilder) encoder(encoding string, w io.Writer) encoder {
+	switch res := m.pools[encoding].Get().(type) {
+	case *gzip.Writer:
+		res.Reset(w)
+		return res
+	case *zlib.Writer:
+		res.Reset(w)
+		return res
+	case *zstd.Encoder:
+		res.Reset(w)
+		return res
+	}
+	return nil
+}
+
+func setHeaders(header http.Header, encoding string) {
+	header.Set("Content-Encoding", encoding)
+	header.Del("Content-Length")
+	header.Del("Accept-Ranges")
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		// representation is changed
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// responseWriter compresses streamed bodies, encoding is decided when header written
+type responseWriter struct {
+	http.ResponseWriter
+	builder  *MiddlewareBuilder
+	encoding string
+	encoder  encoder
+	written  bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.written {
+		return
+	}
+	w.written = true
+	header := w.Header()
+	if w.builder.compressible(header, status) {
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil || length >= w.builder.minSize {
+			setHeaders(header, w.encoding)
+			w.encoder = w.builder.encoder(w.encoding, w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+// Flush sends compressed data to client
+func (w *responseWriter) Flush() {
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap is used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) close() {
+	if w.encoder == nil {
+		return
+	}
+	_ = w.encoder.Close()
+	w.builder.pools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+}
+
+// negotiate returns the encoding with the highest q-value in Accept-Encoding,
+// empty string means identity
+func negotiate(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := make(map[string]float64, 4)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if key, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+		if name == "x-gzip" {
+			name = Gzip
+		}
+		qualities[name] = quality
+	}
+	res, best := "", 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > best {
+			res, best = encoding, quality
+		}
+	}
+	if identity, ok := qualities["identity"]; ok && identity > best {
+		return ""
+	}
+	return res
+}
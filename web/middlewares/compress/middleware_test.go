@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	encodings := []string{Zstd, Gzip, Deflate}
+	testCases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "empty", header: "", want: ""},
+		{name: "gzip", header: "gzip", want: Gzip},
+		{name: "server preference", header: "gzip, deflate, zstd", want: Zstd},
+		{name: "q value", header: "zstd;q=0.5, gzip;q=0.8, deflate;q=0.1", want: Gzip},
+		{name: "excluded", header: "zstd;q=0, gzip", want: Gzip},
+		{name: "any", header: "*", want: Zstd},
+		{name: "any except", header: "*, zstd;q=0", want: Gzip},
+		{name: "x-gzip", header: "x-gzip", want: Gzip},
+		{name: "identity preferred", header: "identity, gzip;q=0.5", want: ""},
+		{name: "unsupported", header: "br", want: ""},
+		{name: "case insensitive", header: "GZIP; q=0.9", want: Gzip},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, negotiate(tc.header, encodings))
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, data []byte) string {
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case Gzip:
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case Deflate:
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	case Zstd:
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(bytes.NewReader(data))
+		reader = decoder
+	default:
+		return string(data)
+	}
+	require.NoError(t, err)
+	res, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(res)
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	large := strings.Repeat(`{"name":"tom"}`, 200)
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(NewMiddlewareBuilder().Build()))
+	server.Get("/json", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("ETag", `"v1"`)
+		_ = ctx.RespJSONOK(map[string]string{"data": large})
+	})
+	server.Get("/small", func(ctx *web.Context) {
+		_ = ctx.RespJSONOK("small")
+	})
+	server.Get("/image", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Content-Type", "image/png")
+		ctx.RespData = []byte(large)
+	})
+	server.Get("/compressed", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		ctx.Resp.Header().Set("Content-Encoding", "br")
+		ctx.RespData = []byte(large)
+	})
+	server.Get("/stream", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 3; i++ {
+			_, _ = ctx.Write([]byte("chunk "))
+			ctx.Flush()
+		}
+	})
+
+	testCases := []struct {
+		name         string
+		path         string
+		accept       string
+		wantEncoding string
+		wantETag     string
+		wantVary     bool
+		wantBody     string
+	}{
+		{name: "gzip", path: "/json", accept: "gzip", wantEncoding: Gzip, wantETag: `W/"v1"`, wantVary: true,
+			wantBody: `{"data":"` + strings.ReplaceAll(large, `"`, `\"`) + `"}`},
+		{name: "deflate", path: "/json", accept: "deflate", wantEncoding: Deflate, wantETag: `W/"v1"`, wantVary: true,
+			wantBody: `{"data":"` + strings.ReplaceAll(large, `"`, `\"`) + `"}`},
+		{name: "zstd", path: "/json", accept: "gzip, zstd", wantEncoding: Zstd, wantETag: `W/"v1"`, wantVary: true,
+			wantBody: `{"data":"` + strings.ReplaceAll(large, `"`, `\"`) + `"}`},
+		{name: "identity", path: "/json", wantETag: `"v1"`,
+			wantBody: `{"data":"` + strings.ReplaceAll(large, `"`, `\"`) + `"}`},
+		{name: "small", path: "/small", accept: "gzip", wantVary: true, wantBody: `"small"`},
+		{name: "type not allowed", path: "/image", accept: "gzip", wantVary: true, wantBody: large},
+		{name: "already compressed", path: "/compressed", accept: "gzip", wantEncoding: "br", wantVary: true, wantBody: large},
+		{name: "stream", path: "/stream", accept: "gzip", wantEncoding: Gzip, wantVary: true, wantBody: "chunk chunk chunk "},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept-Encoding", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			header := recorder.Header()
+			assert.Equal(t, tc.wantEncoding, header.Get("Content-Encoding"))
+			assert.Equal(t, tc.wantETag, header.Get("ETag"))
+			assert.Equal(t, tc.wantVary, header.Get("Vary") == "Accept-Encoding")
+			if tc.wantEncoding != "" && tc.wantEncoding != "br" && tc.path != "/stream" {
+				assert.Equal(t, recorder.Body.Len(), int(recorder.Result().ContentLength))
+				assert.Less(t, recorder.Body.Len(), len(tc.wantBody))
+			}
+			assert.Equal(t, tc.wantBody, decode(t, tc.wantEncoding, recorder.Body.Bytes()))
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package cors
+
+import (
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MiddlewareBuilder builds middleware of Cross-Origin Resource Sharing,
+// preflight requests are answered by the middleware without calling next:
+//
+//	cors.NewMiddlewareBuilder().
+//		AllowOrigins("https://app.example.com", "https://*.example.com").
+//		AllowCredentials(true).
+//		Build()
+type MiddlewareBuilder struct {
+	allowAllOrigins bool
+	origins         []string
+	// wildcard origins split by '*'
+	wildcards    [][2]string
+	regexps      []*regexp.Regexp
+	methods      []string
+	allowHeaders bool
+	headers      []string
+	exposed      []string
+	credentials  bool
+	maxAge       time.Duration
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		methods: []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		headers: []string{
+			"Accept",
+			"Accept-Language",
+			"Authorization",
+			"Content-Language",
+			"Content-Type",
+			"X-Requested-With",
+		},
+	}
+}
+
+// AllowOrigins sets allowed origins, "*" allows any origin,
+// a '*' in origin matches any subdomain, such as https://*.example.com
+func (m *MiddlewareBuilder) AllowOrigins(origins ...string) *MiddlewareBuilder {
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		switch strings.Count(origin, "*") {
+		case 0:
+			m.origins = append(m.origins, origin)
+		case 1:
+			if origin == "*" {
+				m.allowAllOrigins = true
+				continue
+			}
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			m.wildcards = append(m.wildcards, [2]string{prefix, suffix})
+		default:
+			panic(fmt.Sprintf("cors: invalid origin %s", origin))
+		}
+	}
+	return m
+}
+
+// AllowOriginRegexps allows lower case origins matching any of exprs entirely
+func (m *MiddlewareBuilder) AllowOriginRegexps(exprs ...string) *MiddlewareBuilder {
+	for _, expr := range exprs {
+		m.regexps = append(m.regexps, regexp.MustCompile("^(?:"+expr+")$"))
+	}
+	return m
+}
+
+// AllowMethods replaces allowed methods, default GET, HEAD, POST, PUT, PATCH and DELETE
+func (m *MiddlewareBuilder) AllowMethods(methods ...string) *MiddlewareBuilder {
+	m.methods = m.methods[:0]
+	for _, method := range methods {
+		m.methods = append(m.methods, strings.ToUpper(method))
+	}
+	return m
+}
+
+// AllowHeaders replaces allowed request headers, "*" allows any header
+func (m *MiddlewareBuilder) AllowHeaders(headers ...string) *MiddlewareBuilder {
+	m.headers = m.headers[:0]
+	for _, header := range headers {
+		if header == "*" {
+			m.allowHeaders = true
+			continue
+		}
+		m.headers = append(m.headers, http.CanonicalHeaderKey(header))
+	}
+	return m
+}
+
+// ExposeHeaders sets response headers which could be read by scripts
+func (m *MiddlewareBuilder) ExposeHeaders(headers ...string) *MiddlewareBuilder {
+	for _, header := range headers {
+		m.exposed = append(m.exposed, http.CanonicalHeaderKey(header))
+	}
+	return m
+}
+
+// AllowCredentials allows cookies and authorization headers,
+// the request origin is responded instead of "*" then
+func (m *MiddlewareBuilder) AllowCredentials(allow bool) *MiddlewareBuilder {
+	m.credentials = allow
+	return m
+}
+
+// MaxAge sets how long the result of preflight request could be cached
+func (m *MiddlewareBuilder) MaxAge(maxAge time.Duration) *MiddlewareBuilder {
+	m.maxAge = maxAge
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	methods := strings.Join(m.methods, ", ")
+	exposed := strings.Join(m.exposed, ", ")
+	maxAge := strconv.Itoa(int(m.maxAge.Seconds()))
+	return func(next web.Handler) web.Handler {
+		return func(ctx *web.Context) {
+			origin := ctx.Req.Header.Get("Origin")
+			header := ctx.Resp.Header()
+			if !m.allowAllOrigins || m.credentials {
+				// response differs by origin
+				header.Add("Vary", "Origin")
+			}
+			preflight := ctx.Req.Method == http.MethodOptions &&
+				ctx.Req.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				next(ctx)
+				return
+			}
+			if !m.allowOrigin(origin) {
+				if preflight {
+					ctx.RespCode = http.StatusForbidden
+					ctx.RespData = []byte("403 origin not allowed")
+					return
+				}
+				next(ctx)
+				return
+			}
+			if !preflight {
+				m.setOrigin(header, origin)
+				if exposed != "" {
+					header.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next(ctx)
+				return
+			}
+
+			method := strings.ToUpper(ctx.Req.Header.Get("Access-Control-Request-Method"))
+			headers, ok := m.allowRequestHeaders(ctx.Req.Header.Values("Access-Control-Request-Headers"))
+			if !slices.Contains(m.methods, method) || !ok {
+				ctx.RespCode = http.StatusForbidden
+				ctx.RespData = []byte("403 preflight not allowed")
+				return
+			}
+			m.setOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", methods)
+			if len(headers) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			}
+			if m.maxAge > 0 {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			ctx.RespCode = http.StatusNoContent
+			ctx.RespData = nil
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) setOrigin(header http.Header, origin string) {
+	if m.allowAllOrigins && !m.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if m.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (m *MiddlewareBuilder) allowOrigin(origin string) bool {
+	if m.allowAllOrigins {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if slices.Contains(m.origins, origin) {
+		return true
+	}
+	for _, wildcard := range m.wildcards {
+		if len(origin) <= len(wildcard[0])+len(wildcard[1]) ||
+			!strings.HasPrefix(origin, wildcard[0]) || !strings.HasSuffix(origin, wildcard[1]) {
+			continue
+		}
+		// '*' matches subdomain only
+		if sub := origin[len(wildcard[0]) : len(origin)-len(wildcard[1])]; !strings.ContainsAny(sub, "/:@") {
+			return true
+		}
+	}
+	for _, reg := range m.regexps {
+		if reg.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowRequestHeaders returns canonical requested headers if all of them are allowed
+func (m *MiddlewareBuilder) allowRequestHeaders(values []string) ([]string, bool) {
+	var res []string
+	for _, value := range values {
+		for _, header := range strings.Split(value, ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header == "" {
+				continue
+			}
+			if !m.allowHeaders && !slices.Contains(m.headers, header) {
+				return nil, false
+			}
+			res = append(res, header)
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,195 @@
+package cors
+
+import (
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	builder := NewMiddlewareBuilder().
+		AllowOrigins("https://app.example.com", "https://*.example.org").
+		AllowOriginRegexps(`http://localhost:\d+`).
+		AllowHeaders("Content-Type", "X-Token").
+		ExposeHeaders("x-request-id").
+		AllowCredentials(true).
+		MaxAge(10 * time.Minute)
+
+	server := web.NewHTTPServer()
+	api := server.Group("/api", builder.Build())
+	api.Get("/users", func(ctx *web.Context) {
+		ctx.RespData = []byte("users")
+	})
+	api.Delete("/users/:id", func(ctx *web.Context) {
+		ctx.RespData = []byte("deleted")
+	})
+	server.Get("/ping", func(ctx *web.Context) {
+		ctx.RespData = []byte("pong")
+	})
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		wantCode   int
+		wantHeader map[string]string
+		wantVary   []string
+		wantBody   string
+	}{
+		{
+			name: "simple", method: http.MethodGet, path: "/api/users",
+			header:   map[string]string{"Origin": "https://app.example.com"},
+			wantCode: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-Id",
+			},
+			wantVary: []string{"Origin"},
+			wantBody: "users",
+		},
+		{
+			name: "no origin", method: http.MethodGet, path: "/api/users",
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin"},
+			wantBody:   "users",
+		},
+		{
+			name: "origin not allowed", method: http.MethodGet, path: "/api/users",
+			header:     map[string]string{"Origin": "https://evil.com"},
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin"},
+			wantBody:   "users",
+		},
+		{
+			name: "wildcard", method: http.MethodGet, path: "/api/users",
+			header:     map[string]string{"Origin": "https://shop.example.org"},
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://shop.example.org"},
+			wantVary:   []string{"Origin"},
+			wantBody:   "users",
+		},
+		{
+			name: "wildcard not subdomain", method: http.MethodGet, path: "/api/users",
+			header:     map[string]string{"Origin": "https://evil.com/.example.org"},
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin"},
+			wantBody:   "users",
+		},
+		{
+			name: "regexp", method: http.MethodGet, path: "/api/users",
+			header:     map[string]string{"Origin": "http://localhost:3000"},
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "http://localhost:3000"},
+			wantVary:   []string{"Origin"},
+			wantBody:   "users",
+		},
+		{
+			name: "preflight", method: http.MethodOptions, path: "/api/users/12",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "DELETE",
+				"Access-Control-Request-Headers": "content-type, x-token",
+			},
+			wantCode: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers":     "Content-Type, X-Token",
+				"Access-Control-Max-Age":           "600",
+				"Allow":                            "DELETE, OPTIONS",
+			},
+			wantVary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		{
+			name: "preflight header not allowed", method: http.MethodOptions, path: "/api/users",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			wantCode:   http.StatusForbidden,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			wantBody:   "403 preflight not allowed",
+		},
+		{
+			name: "preflight origin not allowed", method: http.MethodOptions, path: "/api/users",
+			header: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			wantCode:   http.StatusForbidden,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			wantBody:   "403 origin not allowed",
+		},
+		{
+			name: "plain options", method: http.MethodOptions, path: "/api/users",
+			wantCode:   http.StatusNoContent,
+			wantHeader: map[string]string{"Allow": "GET, HEAD, OPTIONS"},
+			wantVary:   []string{"Origin"},
+		},
+		{
+			name: "not in group", method: http.MethodOptions, path: "/ping",
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			wantCode:   http.StatusNoContent,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, recorder.Header().Get(k), k)
+			}
+			assert.Equal(t, tc.wantVary, recorder.Header().Values("Vary"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_AllowAll(t *testing.T) {
+	testCases := []struct {
+		name        string
+		credentials bool
+		wantOrigin  string
+		wantVary    []string
+	}{
+		{name: "any", wantOrigin: "*"},
+		{name: "credentials", credentials: true, wantOrigin: "https://a.com", wantVary: []string{"Origin"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := web.NewHTTPServer(web.ServerWithMiddlewares(
+				NewMiddlewareBuilder().AllowOrigins("*").AllowCredentials(tc.credentials).Build()))
+			server.Get("/", func(ctx *web.Context) {})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Origin", "https://a.com")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantOrigin, recorder.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.wantVary, recorder.Header().Values("Vary"))
+		})
+	}
+	assert.Panics(t, func() {
+		NewMiddlewareBuilder().AllowOrigins("https://*.*.com")
+	})
+}
@@ -0,0 +1,239 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/session"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// TokenKey is the key of token in Context.UserValues
+const TokenKey = "csrf.token"
+
+// MiddlewareBuilder builds middleware against cross-site request forgery,
+// token is issued for every request and checked on unsafe methods,
+// it is stored in session by default, or in cookie in double-submit mode,
+// 403 is recorded by Context.SetError as web.HTTPError so that errhandle renders it,
+// templates rendered by GoTemplateEngine or FSTemplateEngine could output it by csrfToken and csrfField:
+//
+//	<form method="post">{{ csrfField }}</form>
+type MiddlewareBuilder struct {
+	manager      *session.Manager
+	key          []byte
+	sessionKey   string
+	headerName   string
+	fieldName    string
+	cookieName   string
+	cookieOption func(c *http.Cookie)
+	exempt       map[string]bool
+	skip         func(ctx *web.Context) bool
+}
+
+// NewMiddlewareBuilder stores token in session of manager,
+// session is initialized for safe requests without one so that login forms could be protected
+func NewMiddlewareBuilder(manager *session.Manager) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		manager:      manager,
+		sessionKey:   "csrf_token",
+		headerName:   "X-CSRF-Token",
+		fieldName:    "csrf_token",
+		cookieName:   "csrf_token",
+		cookieOption: func(c *http.Cookie) {},
+		exempt:       make(map[string]bool, 8),
+	}
+}
+
+// NewDoubleSubmitMiddlewareBuilder stores token in cookie for stateless setups,
+// request must submit the same token as the cookie,
+// cookie carries HMAC of token by key so that cookies planted by others, such as a subdomain, are rejected,
+// a valid cookie copied from another client is still accepted, use session for untrusted subdomains
+func NewDoubleSubmitMiddlewareBuilder(key []byte) *MiddlewareBuilder {
+	res := NewMiddlewareBuilder(nil)
+	res.key = key
+	return res
+}
+
+// SessionKey sets key of token in session, default csrf_token
+func (m *MiddlewareBuilder) SessionKey(key string) *MiddlewareBuilder {
+	m.sessionKey = key
+	return m
+}
+
+// HeaderName sets header carrying token, default X-CSRF-Token
+func (m *MiddlewareBuilder) HeaderName(name string) *MiddlewareBuilder {
+	m.headerName = name
+	return m
+}
+
+// FieldName sets form field carrying token, default csrf_token
+func (m *MiddlewareBuilder) FieldName(name string) *MiddlewareBuilder {
+	m.fieldName = name
+	return m
+}
+
+// CookieName sets cookie of double-submit mode, default csrf_token
+func (m *MiddlewareBuilder) CookieName(name string) *MiddlewareBuilder {
+	m.cookieName = name
+	return m
+}
+
+// CookieOption changes cookie of double-submit mode, such as Secure and Domain
+func (m *MiddlewareBuilder) CookieOption(option func(c *http.Cookie)) *MiddlewareBuilder {
+	m.cookieOption = option
+	return m
+}
+
+// ExemptRoutes skips checking of routes by pattern, such as /webhooks/:provider,
+// request path is compared if no route matched
+func (m *MiddlewareBuilder) ExemptRoutes(routes ...string) *MiddlewareBuilder {
+	for _, route := range routes {
+		m.exempt[route] = true
+	}
+	return m
+}
+
+// Skip skips checking of requests which skip returns true for
+func (m *MiddlewareBuilder) Skip(skip func(ctx *web.Context) bool) *MiddlewareBuilder {
+	m.skip = skip
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return func(ctx *web.Context) {
+			token, err := m.token(ctx)
+			if err != nil {
+				ctx.SetError(err)
+				return
+			}
+			if !safeMethod(ctx.Req.Method) && !m.exempted(ctx) {
+				submitted := ctx.Req.Header.Get(m.headerName)
+				if submitted == "" {
+					submitted = ctx.Req.PostFormValue(m.fieldName)
+				}
+				if token == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+					ctx.SetError(web.NewHTTPError(http.StatusForbidden, "invalid csrf token"))
+					return
+				}
+			}
+			if ctx.UserValues == nil {
+				ctx.UserValues = make(map[string]any, 4)
+			}
+			ctx.UserValues[TokenKey] = token
+			field := template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(m.fieldName) +
+				`" value="` + template.HTMLEscapeString(token) + `">`)
+			ctx.Req = ctx.Req.WithContext(web.WithTemplateFuncs(ctx.Req.Context(), template.FuncMap{
+				"csrfToken": func() string { return token },
+				"csrfField": func() template.HTML { return field },
+			}))
+			next(ctx)
+		}
+	}
+}
+
+// token returns token of request, new token is issued for safe requests without one,
+// empty token is returned for unsafe requests without one
+func (m *MiddlewareBuilder) token(ctx *web.Context) (string, error) {
+	safe := safeMethod(ctx.Req.Method)
+	if m.manager == nil {
+		if c, err := ctx.Req.Cookie(m.cookieName); err == nil {
+			if token, ok := m.verify(c.Value); ok {
+				return token, nil
+			}
+		}
+		if !safe {
+			return "", nil
+		}
+		token := newToken()
+		c := &http.Cookie{
+			Name:     m.cookieName,
+			Value:    token + "." + m.sign(token),
+			Path:     "/",
+			SameSite: http.SameSiteLaxMode,
+		}
+		m.cookieOption(c)
+		http.SetCookie(ctx.Resp, c)
+		return token, nil
+	}
+
+	sess, err := m.manager.GetSession(ctx)
+	if err != nil {
+		if !safe {
+			return "", nil
+		}
+		if sess, err = m.manager.InitSession(ctx); err != nil {
+			return "", err
+		}
+		ctx.UserValues[m.manager.CtxSessKey] = sess
+	}
+	if val, err := sess.Get(ctx.Req.Context(), m.sessionKey); err == nil {
+		if token, ok := val.(string); ok && token != "" {
+			return token, nil
+		}
+	}
+	if !safe {
+		return "", nil
+	}
+	token := newToken()
+	return token, sess.Set(ctx.Req.Context(), m.sessionKey, token)
+}
+
+// sign returns HMAC of token in double-submit mode
+func (m *MiddlewareBuilder) sign(token string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns token of cookie value if it is signed by key
+func (m *MiddlewareBuilder) verify(value string) (string, bool) {
+	token, signature, ok := strings.Cut(value, ".")
+	if !ok || token == "" || !hmac.Equal([]byte(signature), []byte(m.sign(token))) {
+		return "", false
+	}
+	return token, true
+}
+
+func (m *MiddlewareBuilder) exempted(ctx *web.Context) bool {
+	route := ctx.MatchedRoute
+	if route == "" {
+		route = ctx.Req.URL.Path
+	}
+	return m.exempt[route] || m.skip != nil && m.skip(ctx)
+}
+
+// Token returns token issued by middleware
+func Token(ctx *web.Context) string {
+	token, _ := ctx.UserValues[TokenKey].(string)
+	return token
+}
+
+// TemplateFuncs declares functions for parsing templates,
+// they are replaced by functions of request when rendering
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return "" },
+		"csrfField": func() template.HTML { return "" },
+	}
+}
+
+// safeMethod reports whether method is safe by RFC 9110
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func newToken() string {
+	data := make([]byte, 32)
+	_, _ = rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
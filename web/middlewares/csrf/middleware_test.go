@@ -0,0 +1,166 @@
+package csrf
+
+import (
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/middlewares/errhandle"
+	"github.com/CoucouMonEcho/go-framework/web/session"
+	"github.com/CoucouMonEcho/go-framework/web/session/cookie"
+	"github.com/CoucouMonEcho/go-framework/web/session/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Session(t *testing.T) {
+	manager := &session.Manager{
+		Propagator: cookie.NewPropagator(),
+		Store:      memory.NewStore(time.Minute),
+		CtxSessKey: "sessionKey",
+	}
+	tpl, err := template.New("form").Funcs(TemplateFuncs()).
+		Parse(`<form method="post">{{ csrfField }}</form>{{ csrfToken }}`)
+	require.NoError(t, err)
+
+	server := web.NewHTTPServer(
+		web.ServerWithTemplateEngine(&web.GoTemplateEngine{T: tpl}),
+		web.ServerWithMiddlewares(
+			errhandle.NewMiddlewareBuilder().RegisterError(http.StatusForbidden, []byte("invalid csrf token")).Build(),
+			NewMiddlewareBuilder(manager).ExemptRoutes("/webhooks/:provider").Build()))
+	server.Get("/form", func(ctx *web.Context) {
+		_ = ctx.Render("form", nil)
+	})
+	server.Post("/form", func(ctx *web.Context) {
+		ctx.RespData = []byte("saved")
+	})
+	server.Post("/webhooks/:provider", func(ctx *web.Context) {
+		ctx.RespData = []byte("hooked")
+	})
+
+	// issue token with new session
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/form", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	matches := regexp.MustCompile(`<input type="hidden" name="csrf_token" value="([\w-]+)"></form>([\w-]+)`).
+		FindStringSubmatch(recorder.Body.String())
+	require.Len(t, matches, 3)
+	token := matches[1]
+	assert.Equal(t, token, matches[2])
+
+	// the same token for the session
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Contains(t, recorder.Body.String(), token)
+	assert.Empty(t, recorder.Result().Cookies())
+
+	testCases := []struct {
+		name     string
+		path     string
+		header   string
+		form     string
+		noCookie bool
+		wantCode int
+		wantBody string
+	}{
+		{name: "header", path: "/form", header: token, wantCode: http.StatusOK, wantBody: "saved"},
+		{name: "form", path: "/form", form: token, wantCode: http.StatusOK, wantBody: "saved"},
+		{name: "missing", path: "/form", wantCode: http.StatusForbidden, wantBody: "invalid csrf token"},
+		{name: "wrong", path: "/form", header: "wrong", wantCode: http.StatusForbidden, wantBody: "invalid csrf token"},
+		{name: "no session", path: "/form", header: token, noCookie: true, wantCode: http.StatusForbidden, wantBody: "invalid csrf token"},
+		{name: "exempt", path: "/webhooks/github", noCookie: true, wantCode: http.StatusOK, wantBody: "hooked"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(url.Values{"csrf_token": {tc.form}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+			if !tc.noCookie {
+				req.AddCookie(cookies[0])
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestMiddlewareBuilder_DoubleSubmit(t *testing.T) {
+	tpl, err := template.New("field").Funcs(TemplateFuncs()).Parse(`{{ csrfField }}`)
+	require.NoError(t, err)
+	server := web.NewHTTPServer(web.ServerWithTemplateEngine(&web.GoTemplateEngine{T: tpl}),
+		web.ServerWithMiddlewares(NewDoubleSubmitMiddlewareBuilder([]byte("secret")).
+			CookieOption(func(c *http.Cookie) {
+				c.Secure = true
+			}).Build()))
+	server.Get("/field", func(ctx *web.Context) {
+		_ = ctx.Render("field", nil)
+	})
+	server.Get("/token", func(ctx *web.Context) {
+		ctx.RespData = []byte(Token(ctx))
+	})
+	server.Post("/form", func(ctx *web.Context) {
+		ctx.RespData = []byte("saved")
+	})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/token", nil))
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "csrf_token", cookies[0].Name)
+	assert.True(t, cookies[0].Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+	token := recorder.Body.String()
+	signed := cookies[0].Value
+	assert.True(t, strings.HasPrefix(signed, token+"."))
+
+	testCases := []struct {
+		name     string
+		cookie   string
+		header   string
+		wantCode int
+	}{
+		{name: "match", cookie: signed, header: token, wantCode: http.StatusOK},
+		{name: "mismatch", cookie: signed, header: "other", wantCode: http.StatusForbidden},
+		{name: "signed cookie submitted", cookie: signed, header: signed, wantCode: http.StatusForbidden},
+		{name: "no cookie", header: token, wantCode: http.StatusForbidden},
+		// planted by others without key
+		{name: "unsigned", cookie: "planted", header: "planted", wantCode: http.StatusForbidden},
+		{name: "forged", cookie: "planted." + strings.TrimPrefix(signed, token+"."), header: "planted",
+			wantCode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/form", nil)
+			req.Header.Set("X-CSRF-Token", tc.header)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tc.cookie})
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+
+	// unsigned cookie is replaced by a new token
+	req := httptest.NewRequest(http.MethodGet, "/field", nil)
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "x><script>"})
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	cookies = recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+	reissued, _, _ := strings.Cut(cookies[0].Value, ".")
+	assert.Equal(t, `<input type="hidden" name="csrf_token" value="`+reissued+`">`, recorder.Body.String())
+}
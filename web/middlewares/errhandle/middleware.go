@@ -1,10 +1,21 @@
 package errhandle
 
-import "github.com/CoucouMonEcho/go-framework/web"
+import (
+	"encoding/json"
+	"errors"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"net/http"
+)
 
+// MiddlewareBuilder builds middleware rendering error responses,
+// it handles responses with status >= 400 which carry error recorded by Context.SetError or no body,
+// static page registered for status is used first, otherwise content is negotiated by Accept:
+// HTML page is rendered by TemplateEngine if Template is set, or application/problem+json of RFC 9457
 type MiddlewareBuilder struct {
 	// static page
-	resp map[int][]byte
+	resp     map[int][]byte
+	template string
+	report   func(ctx *web.Context, err error)
 }
 
 func NewMiddlewareBuilder() *MiddlewareBuilder {
@@ -13,20 +24,137 @@ func NewMiddlewareBuilder() *MiddlewareBuilder {
 	}
 }
 
+// RegisterError sets static page of status, it replaces any body of response
 func (m *MiddlewareBuilder) RegisterError(status int, data []byte) *MiddlewareBuilder {
 	m.resp[status] = data
 	return m
 }
 
+// Template sets template of HTML error pages, Problem is passed as data
+func (m *MiddlewareBuilder) Template(name string) *MiddlewareBuilder {
+	m.template = name
+	return m
+}
+
+// Report is called for errors with status >= 500, such as logging them
+func (m *MiddlewareBuilder) Report(report func(ctx *web.Context, err error)) *MiddlewareBuilder {
+	m.report = report
+	return m
+}
+
 func (m *MiddlewareBuilder) Build() web.Middleware {
 	return func(next web.Handler) web.Handler {
 		return func(ctx *web.Context) {
 			next(ctx)
-			resp, ok := m.resp[ctx.RespCode]
+			if ctx.Committed() {
+				// streaming response can not be replaced
+				return
+			}
+			err := ctx.Err()
+			status := ctx.RespCode
+			if err != nil && status < http.StatusBadRequest {
+				status = web.StatusOf(err)
+			}
+			if status < http.StatusBadRequest {
+				return
+			}
+			if err != nil && status >= http.StatusInternalServerError && m.report != nil {
+				m.report(ctx, err)
+			}
+			resp, ok := m.resp[status]
 			if ok {
 				// static page
+				ctx.RespCode = status
 				ctx.RespData = resp
+				return
 			}
+			if err == nil && len(ctx.RespData) > 0 {
+				// body set by handler
+				return
+			}
+			m.render(ctx, newProblem(ctx, status, err))
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) render(ctx *web.Context, problem Problem) {
+	header := ctx.Resp.Header()
+	header.Add("Vary", "Accept")
+	offers := []string{"application/problem+json", "application/json"}
+	if m.template != "" {
+		offers = append(offers, "text/html")
+	}
+	if ctx.Accepts(offers...) == "text/html" {
+		if err := ctx.Render(m.template, problem); err == nil {
+			header.Set("Content-Type", "text/html; charset=utf-8")
+			ctx.RespCode = problem.Status
+			return
 		}
+		// problem is still responded
+	}
+	data, err := json.Marshal(problem)
+	if err != nil {
+		ctx.RespCode = http.StatusInternalServerError
+		ctx.RespData = nil
+		return
+	}
+	// problem is responded even if not acceptable
+	header.Set("Content-Type", "application/problem+json")
+	ctx.RespCode = problem.Status
+	ctx.RespData = data
+}
+
+// Problem is the problem details of RFC 9457, it is also the data of HTML error pages
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// Extensions are additional members
+	Extensions map[string]any
+}
+
+// newProblem builds problem of error, message of error is only exposed for 4xx
+// unless it is web.HTTPError, cause of web.HTTPError is never exposed
+func newProblem(ctx *web.Context, status int, err error) Problem {
+	res := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: ctx.Req.URL.Path,
+	}
+	var httpErr *web.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		if httpErr.Type != "" {
+			res.Type = httpErr.Type
+		}
+		if httpErr.Title != "" {
+			res.Title = httpErr.Title
+		}
+		res.Detail = httpErr.Detail
+		res.Extensions = httpErr.Extensions
+	case err != nil && status < http.StatusInternalServerError:
+		res.Detail = err.Error()
+	}
+	return res
+}
+
+// MarshalJSON flattens extensions into members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+5)
+	for key, val := range p.Extensions {
+		members[key] = val
+	}
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
 	}
+	return json.Marshal(members)
 }
@@ -1,33 +1,145 @@
 package errhandle
 
 import (
-	"bytes"
+	"errors"
 	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/middlewares/recover"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"html/template"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
-func TestNewMiddlewareBuilder(t *testing.T) {
-	page := `
-<html>
-	<body>
-		<h1>404 Not Found</h1>
-	</body>
-</html>
-`
-	tpl, err := template.New("404").Parse(page)
-	if err != nil {
-		t.Fatal(err)
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	tpl, err := template.New("error").Parse(`<h1>{{ .Status }} {{ .Title }}</h1><p>{{ .Detail }}</p>`)
+	require.NoError(t, err)
+	var reported error
+	builder := NewMiddlewareBuilder().
+		RegisterError(http.StatusTeapot, []byte("static teapot")).
+		Template("error").
+		Report(func(ctx *web.Context, err error) {
+			reported = err
+		})
+	server := web.NewHTTPServer(
+		web.ServerWithTemplateEngine(&web.GoTemplateEngine{T: tpl}),
+		web.ServerWithMiddlewares(builder.Build(), recover.MiddlewareBuilder{
+			Reporter: func(ctx *web.Context, err *recover.PanicError) {},
+		}.Build()))
+	server.Get("/users/:id", web.HandleErr(func(ctx *web.Context) error {
+		return &web.HTTPError{
+			Status:     http.StatusNotFound,
+			Type:       "https://example.com/problems/user-not-found",
+			Detail:     "user 1 not found",
+			Extensions: map[string]any{"id": 1},
+			Err:        errors.New("sql: no rows"),
+		}
+	}))
+	server.Post("/users", web.HandleErr(func(ctx *web.Context) error {
+		return &web.HTTPError{Status: http.StatusUnprocessableEntity, Err: errors.New("name is required")}
+	}))
+	server.Get("/db", web.HandleErr(func(ctx *web.Context) error {
+		return errors.New("connection refused")
+	}))
+	server.Get("/bad", func(ctx *web.Context) {
+		ctx.SetError(errors.New("invalid cursor"))
+		ctx.RespCode = http.StatusBadRequest
+	})
+	server.Get("/forbidden", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusForbidden
+	})
+	server.Get("/body", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusConflict
+		ctx.RespData = []byte("custom")
+	})
+	server.Get("/teapot", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusTeapot
+	})
+	server.Get("/panic", func(ctx *web.Context) {
+		panic("boom")
+	})
+
+	testCases := []struct {
+		name            string
+		method          string
+		path            string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+		wantReported    bool
+	}{
+		{
+			name: "problem", path: "/users/1", wantCode: http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody: `{"detail":"user 1 not found","id":1,"instance":"/users/1","status":404,` +
+				`"title":"Not Found","type":"https://example.com/problems/user-not-found"}`,
+		},
+		{
+			name: "html", path: "/users/1", accept: "text/html,*/*;q=0.8", wantCode: http.StatusNotFound,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        `<h1>404 Not Found</h1><p>user 1 not found</p>`,
+		},
+		{
+			name: "cause hidden", method: http.MethodPost, path: "/users", wantCode: http.StatusUnprocessableEntity,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"instance":"/users","status":422,"title":"Unprocessable Entity","type":"about:blank"}`,
+		},
+		{
+			name: "internal error hidden", path: "/db", wantCode: http.StatusInternalServerError,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"instance":"/db","status":500,"title":"Internal Server Error","type":"about:blank"}`,
+			wantReported:    true,
+		},
+		{
+			name: "client error exposed", path: "/bad", accept: "application/json", wantCode: http.StatusBadRequest,
+			wantContentType: "application/problem+json",
+			wantBody: `{"detail":"invalid cursor","instance":"/bad","status":400,` +
+				`"title":"Bad Request","type":"about:blank"}`,
+		},
+		{
+			name: "empty body", path: "/forbidden", wantCode: http.StatusForbidden,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"instance":"/forbidden","status":403,"title":"Forbidden","type":"about:blank"}`,
+		},
+		{name: "body kept", path: "/body", wantCode: http.StatusConflict, wantBody: "custom"},
+		{name: "static page", path: "/teapot", accept: "text/html", wantCode: http.StatusTeapot, wantBody: "static teapot"},
+		{
+			name: "not found", path: "/missing", wantCode: http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody:        `{"instance":"/missing","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+		{
+			name: "panic", path: "/panic", accept: "text/html", wantCode: http.StatusInternalServerError,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        `<h1>500 Internal Server Error</h1><p></p>`,
+			wantReported:    true,
+		},
+		{
+			name: "not acceptable", path: "/users/1", accept: "image/png", wantCode: http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody: `{"detail":"user 1 not found","id":1,"instance":"/users/1","status":404,` +
+				`"title":"Not Found","type":"https://example.com/problems/user-not-found"}`,
+		},
 	}
-	buffer := &bytes.Buffer{}
-	err = tpl.Execute(buffer, nil)
-	if err != nil {
-		t.Fatal(err)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reported = nil
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantContentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantReported, reported != nil)
+		})
 	}
-	server := web.NewHTTPServer(web.ServerWithMiddlewares(NewMiddlewareBuilder().
-		RegisterError(http.StatusNotFound, buffer.Bytes()).Build()))
-	err = server.Start(":8081")
-	require.NoError(t, err)
 }
@@ -0,0 +1,474 @@
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/CoucouMonEcho/go-framework/cache"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagsKey is the key of tags added by Tag in Context.UserValues
+const TagsKey = "httpcache.tags"
+
+// Rule configures caching of a route
+type Rule struct {
+	// TTL is used if response carries neither s-maxage nor max-age
+	TTL time.Duration
+	// Vary lists request headers which response differs by, they are part of key
+	Vary []string
+	// Tags are used by Invalidate
+	Tags []string
+	// Key returns key of request, default is path with sorted query
+	Key func(ctx *web.Context) string
+	// AllowCookie caches responses of requests with Cookie, which bypass cache by default,
+	// set it only if response does not depend on cookies or they are part of Key
+	AllowCookie bool
+}
+
+// MiddlewareBuilder builds middleware caching full responses of GET in cache.Cache,
+// HEAD requests are served from cache but never stored,
+// only 200 responses without Set-Cookie are cached, requests with Authorization or Cookie bypass cache,
+// only headers set by handler and inner middlewares are cached, headers set by outer middlewares before,
+// such as request id, are kept per request,
+// the middleware should be placed inside compress so that cached body is not encoded.
+//
+// entries are invalidated by versions of tags, every entry is tagged by its route,
+// so Invalidate and InvalidateRoute cost one write whatever the number of entries
+type MiddlewareBuilder struct {
+	cache  cache.Cache
+	prefix string
+	rule   Rule
+	routes map[string]Rule
+	skip   func(ctx *web.Context) bool
+	group  singleflight.Group
+	now    func() time.Time
+}
+
+func NewMiddlewareBuilder(c cache.Cache) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		cache:  c,
+		prefix: "httpcache:",
+		rule:   Rule{Key: defaultKey},
+		routes: make(map[string]Rule, 8),
+		now:    time.Now,
+	}
+}
+
+// Prefix sets prefix of keys in cache, default httpcache:
+func (m *MiddlewareBuilder) Prefix(prefix string) *MiddlewareBuilder {
+	m.prefix = prefix
+	return m
+}
+
+// TTL sets default TTL, responses without max-age are not cached by default
+func (m *MiddlewareBuilder) TTL(ttl time.Duration) *MiddlewareBuilder {
+	m.rule.TTL = ttl
+	return m
+}
+
+// Vary sets request headers which all responses differ by
+func (m *MiddlewareBuilder) Vary(headers ...string) *MiddlewareBuilder {
+	m.rule.Vary = headers
+	return m
+}
+
+// Key sets default key function
+func (m *MiddlewareBuilder) Key(key func(ctx *web.Context) string) *MiddlewareBuilder {
+	m.rule.Key = key
+	return m
+}
+
+// AllowCookie caches responses of requests with Cookie for all routes, see Rule.AllowCookie
+func (m *MiddlewareBuilder) AllowCookie() *MiddlewareBuilder {
+	m.rule.AllowCookie = true
+	return m
+}
+
+// Route sets rule of route by pattern, such as /products/:id,
+// zero TTL and nil Key fall back to defaults, Vary is appended to defaults
+func (m *MiddlewareBuilder) Route(pattern string, rule Rule) *MiddlewareBuilder {
+	m.routes[pattern] = rule
+	return m
+}
+
+// Skip bypasses cache for requests which skip returns true for
+func (m *MiddlewareBuilder) Skip(skip func(ctx *web.Context) bool) *MiddlewareBuilder {
+	m.skip = skip
+	return m
+}
+
+// Invalidate expires entries tagged by any of tags
+func (m *MiddlewareBuilder) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		if err := m.cache.Set(ctx, m.tagKey(tag), uuid.NewString(), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateRoute expires entries of route by pattern
+func (m *MiddlewareBuilder) InvalidateRoute(ctx context.Context, pattern string) error {
+	return m.Invalidate(ctx, routeTag(pattern))
+}
+
+// Tag adds tags to response of handler, such as product:42
+func Tag(ctx *web.Context, tags ...string) {
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 4)
+	}
+	res, _ := ctx.UserValues[TagsKey].([]string)
+	ctx.UserValues[TagsKey] = append(res, tags...)
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return func(ctx *web.Context) {
+			method := ctx.Req.Method
+			if method != http.MethodGet && method != http.MethodHead ||
+				ctx.Req.Header.Get("Authorization") != "" || m.skip != nil && m.skip(ctx) {
+				next(ctx)
+				return
+			}
+			directives := cacheControl(ctx.Req.Header.Values("Cache-Control"))
+			if _, ok := directives["no-store"]; ok {
+				next(ctx)
+				return
+			}
+			rule := m.ruleOf(ctx)
+			if !rule.AllowCookie && ctx.Req.Header.Get("Cookie") != "" {
+				// response may be personalized by session
+				next(ctx)
+				return
+			}
+			key := m.key(ctx, rule)
+			if !noCache(directives, ctx.Req.Header) {
+				if ent, ok := m.load(ctx, key); ok && fresh(directives, ent, m.now()) {
+					m.serve(ctx, ent, "HIT")
+					return
+				}
+			}
+			if _, ok := directives["only-if-cached"]; ok {
+				ctx.RespCode = http.StatusGatewayTimeout
+				return
+			}
+			if method == http.MethodHead {
+				next(ctx)
+				return
+			}
+			// concurrent misses wait for the leader
+			leader := false
+			val, _, _ := m.group.Do(key, func() (any, error) {
+				leader = true
+				// headers set by outer middlewares belong to this request only
+				before := ctx.Resp.Header().Clone()
+				next(ctx)
+				return m.store(ctx, key, rule, before), nil
+			})
+			ent, _ := val.(*entry)
+			if ent == nil {
+				if !leader {
+					next(ctx)
+				}
+				return
+			}
+			m.serve(ctx, ent, "MISS")
+		}
+	}
+}
+
+// entry is the cached response, it is read only after stored
+type entry struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+	Expires  time.Time   `json:"expires"`
+	// Tags are versions of tags when stored
+	Tags map[string]string `json:"tags"`
+}
+
+func (m *MiddlewareBuilder) ruleOf(ctx *web.Context) Rule {
+	rule, ok := m.routes[ctx.MatchedRoute]
+	if !ok {
+		return m.rule
+	}
+	if rule.TTL == 0 {
+		rule.TTL = m.rule.TTL
+	}
+	if rule.Key == nil {
+		rule.Key = m.rule.Key
+	}
+	rule.AllowCookie = rule.AllowCookie || m.rule.AllowCookie
+	rule.Vary = append(slices.Clone(m.rule.Vary), rule.Vary...)
+	return rule
+}
+
+// key joins key of rule and values of varying headers
+func (m *MiddlewareBuilder) key(ctx *web.Context, rule Rule) string {
+	var sb strings.Builder
+	sb.WriteString(m.prefix)
+	sb.WriteString(rule.Key(ctx))
+	for _, name := range rule.Vary {
+		sb.WriteString("|")
+		sb.WriteString(strings.ToLower(name))
+		sb.WriteString("=")
+		sb.WriteString(strings.Join(ctx.Req.Header.Values(name), ","))
+	}
+	return sb.String()
+}
+
+func (m *MiddlewareBuilder) tagKey(tag string) string {
+	return m.prefix + "tag:" + tag
+}
+
+// version returns current version of tag, empty if tag key is absent, such as evicted
+func (m *MiddlewareBuilder) version(ctx context.Context, tag string) string {
+	val, err := m.cache.Get(ctx, m.tagKey(tag))
+	if err != nil {
+		return ""
+	}
+	return str(val)
+}
+
+// ensureVersion returns version of tag, a random version is created if tag key is absent,
+// so that entries stored before the tag key is evicted never match again
+func (m *MiddlewareBuilder) ensureVersion(ctx context.Context, tag string) (string, error) {
+	if version := m.version(ctx, tag); version != "" {
+		return version, nil
+	}
+	version := uuid.NewString()
+	if err := m.cache.Set(ctx, m.tagKey(tag), version, 0); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+func (m *MiddlewareBuilder) load(ctx *web.Context, key string) (*entry, bool) {
+	val, err := m.cache.Get(ctx.Req.Context(), key)
+	if err != nil {
+		return nil, false
+	}
+	ent := &entry{}
+	if err = json.Unmarshal([]byte(str(val)), ent); err != nil {
+		return nil, false
+	}
+	if !m.now().Before(ent.Expires) {
+		return nil, false
+	}
+	for tag, version := range ent.Tags {
+		// missing tag key means it is invalidated or evicted
+		if current := m.version(ctx.Req.Context(), tag); current == "" || current != version {
+			return nil, false
+		}
+	}
+	return ent, true
+}
+
+// store caches response of handler if allowed, ETag and Last-Modified are generated if absent,
+// only headers changed since before are stored so that headers of outer middlewares are never replayed
+func (m *MiddlewareBuilder) store(ctx *web.Context, key string, rule Rule, before http.Header) *entry {
+	if ctx.Committed() || ctx.RespCode != 0 && ctx.RespCode != http.StatusOK {
+		return nil
+	}
+	header := ctx.Resp.Header()
+	for _, name := range rule.Vary {
+		header.Add("Vary", name)
+	}
+	header = changed(header, before)
+	if header.Get("Set-Cookie") != "" || !varyCovered(header, rule.Vary) {
+		return nil
+	}
+	directives := cacheControl(header.Values("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[directive]; ok {
+			return nil
+		}
+	}
+	ttl := rule.TTL
+	if age, ok := maxAge(directives, "s-maxage"); ok {
+		ttl = age
+	} else if age, ok = maxAge(directives, "max-age"); ok {
+		ttl = age
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	now := m.now()
+	if header.Get("ETag") == "" {
+		sum := sha256.Sum256(ctx.RespData)
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+	if header.Get("Last-Modified") == "" {
+		header.Set("Last-Modified", now.UTC().Format(http.TimeFormat))
+	}
+	ent := &entry{
+		Status:   http.StatusOK,
+		Header:   header,
+		Body:     ctx.RespData,
+		StoredAt: now,
+		Expires:  now.Add(ttl),
+		Tags:     make(map[string]string, len(rule.Tags)+1),
+	}
+	for _, name := range []string{"Age", "Content-Length", "X-Cache", "Connection", "Transfer-Encoding"} {
+		ent.Header.Del(name)
+	}
+	tags := append(slices.Clone(rule.Tags), routeTag(ctx.MatchedRoute))
+	if added, ok := ctx.UserValues[TagsKey].([]string); ok {
+		tags = append(tags, added...)
+	}
+	var err error
+	for _, tag := range tags {
+		if ent.Tags[tag], err = m.ensureVersion(ctx.Req.Context(), tag); err != nil {
+			// response is still shared with waiting requests but not cached
+			return ent
+		}
+	}
+	data, err := json.Marshal(ent)
+	if err == nil {
+		// response is still shared with waiting requests if failed
+		_ = m.cache.Set(ctx.Req.Context(), key, data, ttl)
+	}
+	return ent
+}
+
+// serve writes entry to ctx, 304 is responded if request is conditional and entry matches
+func (m *MiddlewareBuilder) serve(ctx *web.Context, ent *entry, status string) {
+	header := ctx.Resp.Header()
+	for name, values := range ent.Header {
+		header[name] = slices.Clone(values)
+	}
+	header.Set("Age", strconv.Itoa(int(m.now().Sub(ent.StoredAt).Seconds())))
+	header.Set("X-Cache", status)
+	if notModified(ctx.Req.Header, header) {
+		ctx.RespCode = http.StatusNotModified
+		ctx.RespData = nil
+		return
+	}
+	ctx.RespCode = ent.Status
+	ctx.RespData = ent.Body
+}
+
+// changed returns headers which differ from before
+func changed(header, before http.Header) http.Header {
+	res := make(http.Header, len(header))
+	for name, values := range header {
+		if !slices.Equal(values, before[name]) {
+			res[name] = slices.Clone(values)
+		}
+	}
+	return res
+}
+
+func defaultKey(ctx *web.Context) string {
+	// Encode sorts query by key
+	return ctx.Req.URL.Path + "?" + ctx.Req.URL.Query().Encode()
+}
+
+func routeTag(pattern string) string {
+	return "route:" + pattern
+}
+
+// varyCovered reports whether all headers in Vary are part of key
+func varyCovered(header http.Header, vary []string) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return false
+			}
+			if !slices.ContainsFunc(vary, func(v string) bool {
+				return strings.EqualFold(v, name)
+			}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cacheControl parses directives of Cache-Control, names are lower cased
+func cacheControl(values []string) map[string]string {
+	res := make(map[string]string, 4)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, val, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			res[strings.ToLower(name)] = strings.Trim(val, `"`)
+		}
+	}
+	return res
+}
+
+func maxAge(directives map[string]string, name string) (time.Duration, bool) {
+	val, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// noCache reports whether request asks for validation with origin
+func noCache(directives map[string]string, header http.Header) bool {
+	if _, ok := directives["no-cache"]; ok {
+		return true
+	}
+	if age, ok := maxAge(directives, "max-age"); ok && age == 0 {
+		return true
+	}
+	return len(directives) == 0 && header.Get("Pragma") == "no-cache"
+}
+
+// fresh reports whether entry satisfies max-age of request
+func fresh(directives map[string]string, ent *entry, now time.Time) bool {
+	age, ok := maxAge(directives, "max-age")
+	return !ok || now.Sub(ent.StoredAt) <= age
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since if absent, by RFC 9110
+func notModified(req http.Header, header http.Header) bool {
+	if match := req.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// weak comparison
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(req.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// str converts value of cache, RedisCache returns string and BuildInMapCache returns what is set
+func str(val any) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
@@ -0,0 +1,262 @@
+package httpcache
+
+import (
+	"context"
+	"github.com/CoucouMonEcho/go-framework/cache"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/middlewares/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newServer() (*web.HTTPServer, *MiddlewareBuilder, map[string]*atomic.Int32) {
+	builder := NewMiddlewareBuilder(cache.NewBuildInMapCache(time.Hour)).
+		TTL(time.Minute).
+		Route("/private", Rule{Vary: []string{"Accept-Language"}}).
+		Route("/public", Rule{AllowCookie: true})
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()))
+	calls := make(map[string]*atomic.Int32, 8)
+	handle := func(pattern string, handler web.Handler) {
+		calls[pattern] = &atomic.Int32{}
+		server.Get(pattern, func(ctx *web.Context) {
+			calls[pattern].Add(1)
+			handler(ctx)
+		})
+	}
+	handle("/products/:id", func(ctx *web.Context) {
+		id, _ := ctx.PathValue("id").String()
+		Tag(ctx, "product:"+id)
+		ctx.RespData = []byte("product " + id + " " + strconv.Itoa(int(calls["/products/:id"].Load())))
+	})
+	handle("/private", func(ctx *web.Context) {
+		ctx.RespData = []byte(ctx.Req.Header.Get("Accept-Language"))
+	})
+	handle("/public", func(ctx *web.Context) {
+		ctx.RespData = []byte("public")
+	})
+	handle("/no-store", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Cache-Control", "no-store")
+		ctx.RespData = []byte("fresh")
+	})
+	handle("/cookie", func(ctx *web.Context) {
+		ctx.SetCookie(&http.Cookie{Name: "sid", Value: "1"})
+		ctx.RespData = []byte("cookie")
+	})
+	handle("/vary", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Vary", "User-Agent")
+		ctx.RespData = []byte("vary")
+	})
+	handle("/error", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusInternalServerError
+	})
+	return server, builder, calls
+}
+
+func serve(server *web.HTTPServer, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name      string
+		path      string
+		first     http.Header
+		second    http.Header
+		wantCalls int32
+		wantCache string
+	}{
+		{name: "hit", path: "/products/1", wantCalls: 1, wantCache: "HIT"},
+		{name: "query order", path: "/products/1?a=1&b=2", wantCalls: 1, wantCache: "HIT"},
+		{name: "request no-cache", path: "/products/1", second: http.Header{"Cache-Control": {"no-cache"}},
+			wantCalls: 2, wantCache: "MISS"},
+		{name: "request no-store", path: "/products/1", second: http.Header{"Cache-Control": {"no-store"}},
+			wantCalls: 2},
+		{name: "request max-age", path: "/products/1", second: http.Header{"Cache-Control": {"max-age=60"}},
+			wantCalls: 1, wantCache: "HIT"},
+		{name: "authorization", path: "/products/1", second: http.Header{"Authorization": {"Bearer token"}},
+			wantCalls: 2},
+		{name: "cookie", path: "/products/1", second: http.Header{"Cookie": {"sid=1"}},
+			wantCalls: 2},
+		{name: "cookie allowed", path: "/public", first: http.Header{"Cookie": {"sid=1"}},
+			second: http.Header{"Cookie": {"sid=2"}}, wantCalls: 1, wantCache: "HIT"},
+		{name: "vary hit", path: "/private", first: http.Header{"Accept-Language": {"en"}},
+			second: http.Header{"Accept-Language": {"en"}}, wantCalls: 1, wantCache: "HIT"},
+		{name: "vary miss", path: "/private", first: http.Header{"Accept-Language": {"en"}},
+			second: http.Header{"Accept-Language": {"fr"}}, wantCalls: 2, wantCache: "MISS"},
+		{name: "response no-store", path: "/no-store", wantCalls: 2},
+		{name: "set cookie", path: "/cookie", wantCalls: 2},
+		{name: "vary not in key", path: "/vary", wantCalls: 2},
+		{name: "error", path: "/error", wantCalls: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, _, calls := newServer()
+			first := serve(server, http.MethodGet, tc.path, tc.first)
+			second := serve(server, http.MethodGet, tc.path, tc.second)
+			assert.Equal(t, first.Code, second.Code)
+			assert.Equal(t, tc.wantCache, second.Header().Get("X-Cache"))
+			for pattern, counter := range calls {
+				if counter.Load() > 0 {
+					assert.Equal(t, tc.wantCalls, counter.Load(), pattern)
+				}
+			}
+			if tc.wantCache == "HIT" {
+				assert.Equal(t, first.Body.String(), second.Body.String())
+				assert.Equal(t, first.Header().Get("ETag"), second.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Conditional(t *testing.T) {
+	server, _, _ := newServer()
+	first := serve(server, http.MethodGet, "/products/1", nil)
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	modified := first.Header().Get("Last-Modified")
+	require.NotEmpty(t, modified)
+
+	testCases := []struct {
+		name     string
+		method   string
+		header   http.Header
+		wantCode int
+	}{
+		{name: "etag", method: http.MethodGet, header: http.Header{"If-None-Match": {etag}}, wantCode: http.StatusNotModified},
+		{name: "weak etag", method: http.MethodGet, header: http.Header{"If-None-Match": {`"other", W/` + etag}},
+			wantCode: http.StatusNotModified},
+		{name: "etag mismatch", method: http.MethodGet, header: http.Header{"If-None-Match": {`"other"`}},
+			wantCode: http.StatusOK},
+		{name: "modified since", method: http.MethodGet, header: http.Header{"If-Modified-Since": {modified}},
+			wantCode: http.StatusNotModified},
+		{name: "modified", method: http.MethodGet,
+			header:   http.Header{"If-Modified-Since": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}},
+			wantCode: http.StatusOK},
+		{name: "etag precedes date", method: http.MethodGet,
+			header:   http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {modified}},
+			wantCode: http.StatusOK},
+		{name: "head", method: http.MethodHead, header: http.Header{"If-None-Match": {etag}}, wantCode: http.StatusNotModified},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serve(server, tc.method, "/products/1", tc.header)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, etag, recorder.Header().Get("ETag"))
+			if tc.wantCode == http.StatusNotModified {
+				assert.Empty(t, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareBuilder_Invalidate(t *testing.T) {
+	server, builder, calls := newServer()
+	counter := calls["/products/:id"]
+	serve(server, http.MethodGet, "/products/1", nil)
+	serve(server, http.MethodGet, "/products/2", nil)
+	require.Equal(t, int32(2), counter.Load())
+
+	// tag added by handler
+	require.NoError(t, builder.Invalidate(context.Background(), "product:1"))
+	assert.Equal(t, "MISS", serve(server, http.MethodGet, "/products/1", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(server, http.MethodGet, "/products/2", nil).Header().Get("X-Cache"))
+	assert.Equal(t, int32(3), counter.Load())
+
+	// route
+	require.NoError(t, builder.InvalidateRoute(context.Background(), "/products/:id"))
+	assert.Equal(t, "MISS", serve(server, http.MethodGet, "/products/1", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "MISS", serve(server, http.MethodGet, "/products/2", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(server, http.MethodGet, "/products/2", nil).Header().Get("X-Cache"))
+	assert.Equal(t, int32(5), counter.Load())
+
+	// evicted tag key never matches entries stored with it
+	require.NoError(t, builder.cache.Del(context.Background(), builder.tagKey("product:2")))
+	assert.Equal(t, "MISS", serve(server, http.MethodGet, "/products/2", nil).Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", serve(server, http.MethodGet, "/products/2", nil).Header().Get("X-Cache"))
+	assert.Equal(t, int32(6), counter.Load())
+}
+
+func TestMiddlewareBuilder_Singleflight(t *testing.T) {
+	builder := NewMiddlewareBuilder(cache.NewBuildInMapCache(time.Hour)).TTL(time.Minute)
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()))
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server.Get("/catalogue", func(ctx *web.Context) {
+		calls.Add(1)
+		<-release
+		ctx.RespData = []byte("catalogue")
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i] = serve(server, http.MethodGet, "/catalogue", nil).Body.String()
+		}()
+	}
+	// let requests wait for the first one
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+	for _, body := range bodies {
+		assert.Equal(t, "catalogue", body)
+	}
+}
+
+func TestMiddlewareBuilder_OuterHeaders(t *testing.T) {
+	builder := NewMiddlewareBuilder(cache.NewBuildInMapCache(time.Hour)).TTL(time.Minute)
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(
+		requestid.NewMiddlewareBuilder().Build(),
+		builder.Build(),
+	))
+	server.Get("/catalogue", func(ctx *web.Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		ctx.RespData = []byte("catalogue")
+	})
+
+	first := serve(server, http.MethodGet, "/catalogue", http.Header{"X-Request-Id": {"first"}})
+	require.Equal(t, "MISS", first.Header().Get("X-Cache"))
+	assert.Equal(t, "first", first.Header().Get("X-Request-ID"))
+	second := serve(server, http.MethodGet, "/catalogue", http.Header{"X-Request-Id": {"second"}})
+	require.Equal(t, "HIT", second.Header().Get("X-Cache"))
+	assert.Equal(t, "second", second.Header().Get("X-Request-ID"))
+	assert.Equal(t, "text/plain", second.Header().Get("Content-Type"))
+	third := serve(server, http.MethodGet, "/catalogue", nil)
+	require.Equal(t, "HIT", third.Header().Get("X-Cache"))
+	assert.NotEmpty(t, third.Header().Get("X-Request-ID"))
+	assert.NotEqual(t, "first", third.Header().Get("X-Request-ID"))
+}
+
+func TestCacheControl(t *testing.T) {
+	testCases := []struct {
+		name   string
+		values []string
+		want   map[string]string
+	}{
+		{name: "empty", want: map[string]string{}},
+		{name: "directives", values: []string{`public, max-age=60`, `S-MaxAge="120"`},
+			want: map[string]string{"public": "", "max-age": "60", "s-maxage": "120"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, cacheControl(tc.values))
+		})
+	}
+}
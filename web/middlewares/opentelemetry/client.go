@@ -0,0 +1,89 @@
+package opentelemetry
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var _ http.RoundTripper = &Transport{}
+
+// Transport traces outgoing requests and injects trace context into their headers,
+// so that spans of downstream services join the trace of request context:
+//
+//	client := &http.Client{Transport: opentelemetry.NewTransport(nil)}
+//	req, _ := http.NewRequestWithContext(ctx.Req.Context(), http.MethodGet, url, nil)
+//
+// span ends when response headers are received, status is Error for 4xx, 5xx and transport errors
+type Transport struct {
+	Base        http.RoundTripper
+	Tracer      trace.Tracer
+	Propagators propagation.TextMapPropagator
+}
+
+// NewTransport wraps base, http.DefaultTransport is used if nil
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base, tracer, propagators := t.Base, t.Tracer, t.Propagators
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if tracer == nil {
+		tracer = otel.GetTracerProvider().Tracer(instrumentationName)
+	}
+	if propagators == nil {
+		propagators = otel.GetTextMapPropagator()
+	}
+
+	attrs := []attribute.KeyValue{
+		methodAttribute(req.Method),
+		semconv.URLFull(redactedURL(req)),
+		semconv.ServerAddress(req.URL.Hostname()),
+	}
+	if knownMethod(req.Method) == "" {
+		attrs = append(attrs, semconv.HTTPRequestMethodOriginal(req.Method))
+	}
+	if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	ctx, span := tracer.Start(req.Context(), spanName(req.Method, ""),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	defer span.End()
+
+	// RoundTripper must not modify request
+	req = req.Clone(ctx)
+	propagators.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(semconv.ErrorTypeOther)
+		return resp, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode)))
+	}
+	return resp, nil
+}
+
+// redactedURL replaces credentials of url by semantic conventions
+func redactedURL(req *http.Request) string {
+	if req.URL.User == nil {
+		return req.URL.String()
+	}
+	u := *req.URL
+	u.User = url.UserPassword("REDACTED", "REDACTED")
+	return u.String()
+}
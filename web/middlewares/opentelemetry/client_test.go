@@ -0,0 +1,65 @@
+package opentelemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTransport_RoundTrip(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Traceparent", r.Header.Get("traceparent"))
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer downstream.Close()
+
+	tracer := &recordingTracer{}
+	client := &http.Client{Transport: &Transport{Tracer: tracer, Propagators: propagation.TraceContext{}}}
+	ctx, parent := tracer.Start(context.Background(), "GET /orders/:id", trace.WithSpanKind(trace.SpanKindServer))
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantCode   int
+		wantStatus codes.Code
+	}{
+		{name: "ok", path: "/ok", wantCode: http.StatusOK},
+		{name: "client error", path: "/missing", wantCode: http.StatusNotFound, wantStatus: codes.Error},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := url.Parse(downstream.URL + tc.path)
+			require.NoError(t, err)
+			target.User = url.UserPassword("user", "secret")
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, tc.wantCode, resp.StatusCode)
+			// request of caller is not modified
+			assert.Empty(t, req.Header.Get("traceparent"))
+
+			span := tracer.last()
+			assert.True(t, span.ended)
+			assert.Equal(t, "GET", span.name)
+			assert.Equal(t, trace.SpanKindClient, span.kind)
+			assert.Equal(t, tc.wantStatus, span.status)
+			assert.Equal(t, parent.SpanContext().TraceID(), span.sc.TraceID())
+			assert.Equal(t, "00-"+span.sc.TraceID().String()+"-"+span.sc.SpanID().String()+"-01",
+				resp.Header.Get("X-Traceparent"))
+			assert.Equal(t, attribute.IntValue(tc.wantCode), span.attrs["http.response.status_code"])
+			assert.NotContains(t, span.attrs["url.full"].AsString(), "secret")
+		})
+	}
+}
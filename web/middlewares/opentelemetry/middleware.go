@@ -1,47 +1,173 @@
 package opentelemetry
 
 import (
+	"fmt"
 	"github.com/CoucouMonEcho/go-framework/web"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
 	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
 )
 
 const instrumentationName = "github.com/CoucouMonEcho/go-framework/web/middlewares/opentelemetry"
 
+// MiddlewareBuilder builds middleware tracing requests and recording metrics by HTTP semantic conventions,
+// span is named by method and matched route, status is Error for 5xx and panics,
+// metrics are http.server.request.duration and http.server.active_requests,
+// global providers and propagator are used if fields are nil
 type MiddlewareBuilder struct {
-	Tracer trace.Tracer
+	Tracer      trace.Tracer
+	Meter       metric.Meter
+	Propagators propagation.TextMapPropagator
 }
 
 func (m MiddlewareBuilder) Build() web.Middleware {
 	if m.Tracer == nil {
 		m.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
 	}
+	if m.Meter == nil {
+		m.Meter = otel.GetMeterProvider().Meter(instrumentationName)
+	}
+	if m.Propagators == nil {
+		m.Propagators = otel.GetTextMapPropagator()
+	}
+	duration, err := m.Meter.Float64Histogram(semconv.HTTPServerRequestDurationName,
+		metric.WithUnit(semconv.HTTPServerRequestDurationUnit),
+		metric.WithDescription(semconv.HTTPServerRequestDurationDescription),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10))
+	if err != nil {
+		otel.Handle(err)
+	}
+	active, err := m.Meter.Int64UpDownCounter(semconv.HTTPServerActiveRequestsName,
+		metric.WithUnit(semconv.HTTPServerActiveRequestsUnit),
+		metric.WithDescription(semconv.HTTPServerActiveRequestsDescription))
+	if err != nil {
+		otel.Handle(err)
+	}
 
 	return func(next web.Handler) web.Handler {
 		return func(ctx *web.Context) {
-			reqCtx := ctx.Req.Context()
+			start := time.Now()
+			req := ctx.Req
 			// get client trace
-			reqCtx = otel.GetTextMapPropagator().Extract(reqCtx, propagation.HeaderCarrier(ctx.Req.Header))
-			// this req ctx need reset
-			reqCtx, span := m.Tracer.Start(reqCtx, "unknown")
+			reqCtx := m.Propagators.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			// route is matched before middlewares
+			reqCtx, span := m.Tracer.Start(reqCtx, spanName(req.Method, ctx.MatchedRoute),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(requestAttributes(req)...))
+			ctx.Req = req.WithContext(reqCtx)
+
+			common := []attribute.KeyValue{methodAttribute(req.Method), semconv.URLScheme(scheme(req))}
+			if active != nil {
+				active.Add(reqCtx, 1, metric.WithAttributes(common...))
+			}
 			defer func() {
-				span.SetName(ctx.MatchedRoute)
-				span.SetAttributes(
-					attribute.Int("http.status", ctx.RespCode),
-				)
+				status := ctx.RespCode
+				if status == 0 {
+					status = http.StatusOK
+				}
+				// recover before building attributes so that panic is recorded as 500
+				rec := recover()
+				if rec != nil {
+					// recover middleware inside would have set status
+					status = http.StatusInternalServerError
+					span.RecordError(fmt.Errorf("panic: %v", rec), trace.WithStackTrace(true))
+				}
+				attrs := append(common, semconv.HTTPResponseStatusCode(status))
+				if ctx.MatchedRoute != "" {
+					attrs = append(attrs, semconv.HTTPRoute(ctx.MatchedRoute))
+				}
+				if status >= http.StatusInternalServerError {
+					attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+					span.SetStatus(codes.Error, http.StatusText(status))
+				}
+				span.SetName(spanName(req.Method, ctx.MatchedRoute))
+				span.SetAttributes(attrs...)
+				span.SetAttributes(semconv.HTTPResponseBodySize(ctx.RespSize()))
 				span.End()
+				if active != nil {
+					active.Add(reqCtx, -1, metric.WithAttributes(common...))
+				}
+				if duration != nil {
+					duration.Record(reqCtx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+				}
+				if rec != nil {
+					panic(rec)
+				}
 			}()
-			span.SetAttributes(
-				attribute.String("http.method", ctx.Req.Method),
-				attribute.String("http.url", ctx.Req.URL.String()),
-				attribute.String("http.scheme", ctx.Req.URL.Scheme),
-				attribute.String("http.hostname", ctx.Req.Host),
-				attribute.String("http.proto", ctx.Req.Proto),
-			)
-			ctx.Req = ctx.Req.WithContext(reqCtx)
 			next(ctx)
 		}
 	}
 }
+
+// spanName is {method} {route}, or {method} if no route matched
+func spanName(method, route string) string {
+	if method = knownMethod(method); method == "" {
+		method = "HTTP"
+	}
+	if route == "" {
+		return method
+	}
+	return method + " " + route
+}
+
+func requestAttributes(req *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		methodAttribute(req.Method),
+		semconv.URLPath(req.URL.Path),
+		semconv.URLScheme(scheme(req)),
+		semconv.NetworkProtocolVersion(fmt.Sprintf("%d.%d", req.ProtoMajor, req.ProtoMinor)),
+	}
+	if knownMethod(req.Method) == "" {
+		attrs = append(attrs, semconv.HTTPRequestMethodOriginal(req.Method))
+	}
+	if host, port, err := net.SplitHostPort(req.Host); err == nil {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(p))
+		}
+	} else if req.Host != "" {
+		attrs = append(attrs, semconv.ServerAddress(req.Host))
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		attrs = append(attrs, semconv.ClientAddress(host))
+	}
+	if ua := req.UserAgent(); ua != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(ua))
+	}
+	if req.ContentLength > 0 {
+		attrs = append(attrs, semconv.HTTPRequestBodySize(int(req.ContentLength)))
+	}
+	return attrs
+}
+
+// knownMethod returns method if it is defined by RFC 9110 or RFC 5789, otherwise empty string
+func knownMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return ""
+}
+
+func methodAttribute(method string) attribute.KeyValue {
+	if method = knownMethod(method); method == "" {
+		return semconv.HTTPRequestMethodOther
+	}
+	return semconv.HTTPRequestMethodKey.String(method)
+}
+
+func scheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,253 @@
+package opentelemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMiddlewareBuilder_Record(t *testing.T) {
+	tracer := &recordingTracer{}
+	meter := &recordingMeter{}
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(MiddlewareBuilder{
+		Tracer:      tracer,
+		Meter:       meter,
+		Propagators: propagation.TraceContext{},
+	}.Build()))
+	server.Post("/users/:id", func(ctx *web.Context) {
+		ctx.RespData = []byte("hello")
+	})
+	server.Get("/error", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusInternalServerError
+	})
+	server.Get("/panic", func(ctx *web.Context) {
+		panic("boom")
+	})
+
+	parent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantName   string
+		wantStatus codes.Code
+		wantAttrs  map[attribute.Key]attribute.Value
+		wantPanic  bool
+	}{
+		{
+			name:     "ok",
+			method:   http.MethodPost,
+			path:     "/users/1",
+			body:     "body",
+			wantName: "POST /users/:id",
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"http.request.method":       attribute.StringValue(http.MethodPost),
+				"http.route":                attribute.StringValue("/users/:id"),
+				"http.response.status_code": attribute.IntValue(http.StatusOK),
+				"http.request.body.size":    attribute.IntValue(4),
+				"http.response.body.size":   attribute.IntValue(5),
+				"url.path":                  attribute.StringValue("/users/1"),
+				"url.scheme":                attribute.StringValue("http"),
+				"server.address":            attribute.StringValue("example.com"),
+				"client.address":            attribute.StringValue("192.0.2.1"),
+				"network.protocol.version":  attribute.StringValue("1.1"),
+			},
+		},
+		{
+			name:       "server error",
+			method:     http.MethodGet,
+			path:       "/error",
+			wantName:   "GET /error",
+			wantStatus: codes.Error,
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"http.response.status_code": attribute.IntValue(http.StatusInternalServerError),
+				"error.type":                attribute.StringValue("500"),
+			},
+		},
+		{
+			name:     "not found",
+			method:   http.MethodGet,
+			path:     "/missing",
+			wantName: "GET",
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"http.response.status_code": attribute.IntValue(http.StatusNotFound),
+			},
+		},
+		{
+			name:     "unknown method",
+			method:   "PURGE",
+			path:     "/missing",
+			wantName: "HTTP",
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"http.request.method":          attribute.StringValue("_OTHER"),
+				"http.request.method_original": attribute.StringValue("PURGE"),
+			},
+		},
+		{
+			name:       "panic",
+			method:     http.MethodGet,
+			path:       "/panic",
+			wantName:   "GET /panic",
+			wantStatus: codes.Error,
+			wantAttrs: map[attribute.Key]attribute.Value{
+				"http.response.status_code": attribute.IntValue(http.StatusInternalServerError),
+				"error.type":                attribute.StringValue("500"),
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("traceparent", parent)
+			serve := func() {
+				server.ServeHTTP(httptest.NewRecorder(), req)
+			}
+			if tc.wantPanic {
+				assert.Panics(t, serve)
+			} else {
+				serve()
+			}
+			span := tracer.last()
+			require.NotNil(t, span)
+			assert.True(t, span.ended)
+			assert.Equal(t, tc.wantName, span.name)
+			assert.Equal(t, trace.SpanKindServer, span.kind)
+			assert.Equal(t, tc.wantStatus, span.status)
+			assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", span.sc.TraceID().String())
+			for key, val := range tc.wantAttrs {
+				assert.Equal(t, val, span.attrs[key], key)
+			}
+			assert.Equal(t, tc.wantPanic, len(span.errs) > 0)
+		})
+	}
+
+	assert.Equal(t, int64(0), meter.active.value)
+	require.Len(t, meter.duration.records, len(testCases))
+	attrs := meter.duration.records[0]
+	route, _ := attrs.Value("http.route")
+	assert.Equal(t, "/users/:id", route.AsString())
+	status, _ := attrs.Value("http.response.status_code")
+	assert.Equal(t, int64(http.StatusOK), status.AsInt64())
+	// panic is recorded as 500
+	status, _ = meter.duration.records[len(testCases)-1].Value("http.response.status_code")
+	assert.Equal(t, int64(http.StatusInternalServerError), status.AsInt64())
+}
+
+// recordingTracer records spans without SDK
+type recordingTracer struct {
+	embedded.Tracer
+	mutex sync.Mutex
+	spans []*recordingSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	span := &recordingSpan{
+		name:  name,
+		kind:  cfg.SpanKind(),
+		attrs: make(map[attribute.Key]attribute.Value, 16),
+	}
+	span.SetAttributes(cfg.Attributes()...)
+	scc := trace.SpanContextConfig{TraceFlags: trace.FlagsSampled}
+	if parent := trace.SpanContextFromContext(ctx); parent.IsValid() {
+		scc.TraceID = parent.TraceID()
+	} else {
+		_, _ = rand.Read(scc.TraceID[:])
+	}
+	_, _ = rand.Read(scc.SpanID[:])
+	span.sc = trace.NewSpanContext(scc)
+	r.mutex.Lock()
+	r.spans = append(r.spans, span)
+	r.mutex.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (r *recordingTracer) last() *recordingSpan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.spans) == 0 {
+		return nil
+	}
+	return r.spans[len(r.spans)-1]
+}
+
+type recordingSpan struct {
+	tracenoop.Span
+	name   string
+	kind   trace.SpanKind
+	sc     trace.SpanContext
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	errs   []error
+	ended  bool
+}
+
+func (s *recordingSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *recordingSpan) IsRecording() bool { return !s.ended }
+
+func (s *recordingSpan) SetName(name string) { s.name = name }
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+
+func (s *recordingSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+func (s *recordingSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+// recordingMeter records the duration histogram and the active requests counter
+type recordingMeter struct {
+	metricnoop.Meter
+	duration *recordingHistogram
+	active   *recordingCounter
+}
+
+func (r *recordingMeter) Float64Histogram(string, ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	r.duration = &recordingHistogram{}
+	return r.duration, nil
+}
+
+func (r *recordingMeter) Int64UpDownCounter(string, ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	r.active = &recordingCounter{}
+	return r.active, nil
+}
+
+type recordingHistogram struct {
+	metricnoop.Float64Histogram
+	records []attribute.Set
+}
+
+func (r *recordingHistogram) Record(_ context.Context, _ float64, opts ...metric.RecordOption) {
+	r.records = append(r.records, metric.NewRecordConfig(opts).Attributes())
+}
+
+type recordingCounter struct {
+	metricnoop.Int64UpDownCounter
+	value int64
+}
+
+func (r *recordingCounter) Add(_ context.Context, incr int64, _ ...metric.AddOption) {
+	r.value += incr
+}
@@ -1,53 +1,189 @@
 package prometheus
 
 import (
+	"errors"
 	"github.com/CoucouMonEcho/go-framework/web"
 	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"net/http"
 	"strconv"
 	"time"
 )
 
+// MiddlewareBuilder builds middleware recording duration in seconds, request and response sizes in bytes
+// and requests in flight, labels are route, method and status class such as 2xx,
+// route is the matched pattern or unknown, methods out of RFC 9110 are other, so that cardinality is bounded
 type MiddlewareBuilder struct {
-	Namespace string
-	Subsystem string
-	Name      string
-	Help      string
-}
-
-func (m MiddlewareBuilder) Build() web.Middleware {
-	vector := prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Namespace: m.Namespace,
-		Subsystem: m.Subsystem,
-		Name:      m.Name,
-		Help:      m.Help,
-		Objectives: map[float64]float64{
-			0.5:   0.01,
-			0.75:  0.01,
-			0.90:  0.01,
-			0.99:  0.001,
-			0.999: 0.0001,
-		},
-	}, []string{"pattern", "method", "status"})
-	prometheus.MustRegister(vector)
+	registerer  prometheus.Registerer
+	namespace   string
+	subsystem   string
+	constLabels prometheus.Labels
+	buckets     []float64
+	sizeBuckets []float64
+}
+
+// NewMiddlewareBuilder registers metrics in registerer, prometheus.DefaultRegisterer is used if nil,
+// metrics registered by another builder with the same options are shared
+func NewMiddlewareBuilder(registerer prometheus.Registerer) *MiddlewareBuilder {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	return &MiddlewareBuilder{
+		registerer:  registerer,
+		namespace:   "http",
+		subsystem:   "server",
+		buckets:     prometheus.DefBuckets,
+		sizeBuckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}
+}
+
+// Namespace sets namespace of metrics, default http
+func (m *MiddlewareBuilder) Namespace(namespace string) *MiddlewareBuilder {
+	m.namespace = namespace
+	return m
+}
+
+// Subsystem sets subsystem of metrics, default server
+func (m *MiddlewareBuilder) Subsystem(subsystem string) *MiddlewareBuilder {
+	m.subsystem = subsystem
+	return m
+}
+
+// ConstLabels sets labels of all metrics, such as service
+func (m *MiddlewareBuilder) ConstLabels(labels prometheus.Labels) *MiddlewareBuilder {
+	m.constLabels = labels
+	return m
+}
+
+// Buckets sets buckets of duration in seconds, default prometheus.DefBuckets
+func (m *MiddlewareBuilder) Buckets(buckets ...float64) *MiddlewareBuilder {
+	m.buckets = buckets
+	return m
+}
+
+// SizeBuckets sets buckets of request and response sizes in bytes, default 64B to 1MB by 4 times
+func (m *MiddlewareBuilder) SizeBuckets(buckets ...float64) *MiddlewareBuilder {
+	m.sizeBuckets = buckets
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	labels := []string{"route", "method", "status_class"}
+	duration := register(m.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   m.namespace,
+		Subsystem:   m.subsystem,
+		Name:        "request_duration_seconds",
+		Help:        "Duration of HTTP requests in seconds.",
+		ConstLabels: m.constLabels,
+		Buckets:     m.buckets,
+	}, labels))
+	reqSize := register(m.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   m.namespace,
+		Subsystem:   m.subsystem,
+		Name:        "request_size_bytes",
+		Help:        "Size of HTTP request bodies in bytes.",
+		ConstLabels: m.constLabels,
+		Buckets:     m.sizeBuckets,
+	}, labels))
+	respSize := register(m.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   m.namespace,
+		Subsystem:   m.subsystem,
+		Name:        "response_size_bytes",
+		Help:        "Size of HTTP response bodies in bytes.",
+		ConstLabels: m.constLabels,
+		Buckets:     m.sizeBuckets,
+	}, labels))
+	inFlight := register(m.registerer, prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   m.namespace,
+		Subsystem:   m.subsystem,
+		Name:        "requests_in_flight",
+		Help:        "Number of HTTP requests being served.",
+		ConstLabels: m.constLabels,
+	}))
 	return func(next web.Handler) web.Handler {
 		return func(ctx *web.Context) {
 			start := time.Now()
+			inFlight.Inc()
+			body := &countReader{ReadCloser: ctx.Req.Body}
+			if ctx.Req.Body != nil {
+				ctx.Req.Body = body
+			}
+			// recorded synchronously before ctx is reused
 			defer func() {
-				go report(start, ctx, vector)
+				inFlight.Dec()
+				status := ctx.RespCode
+				if status == 0 {
+					status = http.StatusOK
+				}
+				err := recover()
+				if err != nil {
+					// recover middleware inside would have set status
+					status = http.StatusInternalServerError
+				}
+				values := []string{route(ctx.MatchedRoute), method(ctx.Req.Method), statusClass(status)}
+				duration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+				size := body.n
+				if size == 0 && ctx.Req.ContentLength > 0 {
+					// body is not read by handler
+					size = ctx.Req.ContentLength
+				}
+				reqSize.WithLabelValues(values...).Observe(float64(size))
+				respSize.WithLabelValues(values...).Observe(float64(ctx.RespSize()))
+				if err != nil {
+					panic(err)
+				}
 			}()
 			next(ctx)
 		}
 	}
 }
 
-func report(start time.Time, ctx *web.Context, vector *prometheus.SummaryVec) {
-	pattern := ctx.MatchedRoute
+// register returns the registered collector if an equal one exists
+func register[T prometheus.Collector](registerer prometheus.Registerer, collector T) T {
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector
+	}
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+	panic("prometheus: " + err.Error())
+}
+
+func route(pattern string) string {
 	if pattern == "" {
-		pattern = "unknown"
+		return "unknown"
+	}
+	return pattern
+}
+
+func method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
 	}
-	vector.WithLabelValues(
-		pattern,
-		ctx.Req.Method,
-		strconv.Itoa(ctx.RespCode),
-	).Observe(float64(time.Since(start).Milliseconds()))
+	return "other"
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// countReader counts bytes of request body read by handler
+type countReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
 }
@@ -11,12 +11,8 @@ import (
 	"time"
 )
 
-func TestMiddlewareBuilder_Build(t *testing.T) {
-	builder := MiddlewareBuilder{
-		Namespace: "test",
-		Subsystem: "web",
-		Name:      "prometheus",
-	}
+func TestMiddlewareBuilder_BuildE2E(t *testing.T) {
+	builder := NewMiddlewareBuilder(nil).Namespace("test").Subsystem("web")
 	server := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()))
 	type User struct {
 		Name string
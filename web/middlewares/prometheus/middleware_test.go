@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	builder := NewMiddlewareBuilder(registry).Namespace("test").SizeBuckets(10, 100)
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()))
+	server.Post("/users/:id", func(ctx *web.Context) {
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP test_server_requests_in_flight Number of HTTP requests being served.
+# TYPE test_server_requests_in_flight gauge
+test_server_requests_in_flight 1
+`), "test_server_requests_in_flight"))
+		ctx.RespData = []byte("hello")
+	})
+	server.Get("/error", func(ctx *web.Context) {
+		ctx.RespCode = http.StatusInternalServerError
+	})
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("body")),
+		httptest.NewRequest(http.MethodPost, "/users/2", strings.NewReader(strings.Repeat("a", 50))),
+		httptest.NewRequest(http.MethodGet, "/error", nil),
+		httptest.NewRequest(http.MethodGet, "/missing", nil),
+		httptest.NewRequest("PURGE", "/missing", nil),
+	}
+	for _, req := range requests {
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP test_server_request_size_bytes Size of HTTP request bodies in bytes.
+# TYPE test_server_request_size_bytes histogram
+test_server_request_size_bytes_bucket{method="GET",route="/error",status_class="5xx",le="10"} 1
+test_server_request_size_bytes_bucket{method="GET",route="/error",status_class="5xx",le="100"} 1
+test_server_request_size_bytes_bucket{method="GET",route="/error",status_class="5xx",le="+Inf"} 1
+test_server_request_size_bytes_sum{method="GET",route="/error",status_class="5xx"} 0
+test_server_request_size_bytes_count{method="GET",route="/error",status_class="5xx"} 1
+test_server_request_size_bytes_bucket{method="GET",route="unknown",status_class="4xx",le="10"} 1
+test_server_request_size_bytes_bucket{method="GET",route="unknown",status_class="4xx",le="100"} 1
+test_server_request_size_bytes_bucket{method="GET",route="unknown",status_class="4xx",le="+Inf"} 1
+test_server_request_size_bytes_sum{method="GET",route="unknown",status_class="4xx"} 0
+test_server_request_size_bytes_count{method="GET",route="unknown",status_class="4xx"} 1
+test_server_request_size_bytes_bucket{method="POST",route="/users/:id",status_class="2xx",le="10"} 1
+test_server_request_size_bytes_bucket{method="POST",route="/users/:id",status_class="2xx",le="100"} 2
+test_server_request_size_bytes_bucket{method="POST",route="/users/:id",status_class="2xx",le="+Inf"} 2
+test_server_request_size_bytes_sum{method="POST",route="/users/:id",status_class="2xx"} 54
+test_server_request_size_bytes_count{method="POST",route="/users/:id",status_class="2xx"} 2
+test_server_request_size_bytes_bucket{method="other",route="unknown",status_class="4xx",le="10"} 1
+test_server_request_size_bytes_bucket{method="other",route="unknown",status_class="4xx",le="100"} 1
+test_server_request_size_bytes_bucket{method="other",route="unknown",status_class="4xx",le="+Inf"} 1
+test_server_request_size_bytes_sum{method="other",route="unknown",status_class="4xx"} 0
+test_server_request_size_bytes_count{method="other",route="unknown",status_class="4xx"} 1
+# HELP test_server_response_size_bytes Size of HTTP response bodies in bytes.
+# TYPE test_server_response_size_bytes histogram
+test_server_response_size_bytes_bucket{method="GET",route="/error",status_class="5xx",le="10"} 1
+test_server_response_size_bytes_bucket{method="GET",route="/error",status_class="5xx",le="100"} 1
+test_server_response_size_bytes_bucket{method="GET",route="/error",status_class="5xx",le="+Inf"} 1
+test_server_response_size_bytes_sum{method="GET",route="/error",status_class="5xx"} 0
+test_server_response_size_bytes_count{method="GET",route="/error",status_class="5xx"} 1
+test_server_response_size_bytes_bucket{method="GET",route="unknown",status_class="4xx",le="10"} 0
+test_server_response_size_bytes_bucket{method="GET",route="unknown",status_class="4xx",le="100"} 1
+test_server_response_size_bytes_bucket{method="GET",route="unknown",status_class="4xx",le="+Inf"} 1
+test_server_response_size_bytes_sum{method="GET",route="unknown",status_class="4xx"} 18
+test_server_response_size_bytes_count{method="GET",route="unknown",status_class="4xx"} 1
+test_server_response_size_bytes_bucket{method="POST",route="/users/:id",status_class="2xx",le="10"} 2
+test_server_response_size_bytes_bucket{method="POST",route="/users/:id",status_class="2xx",le="100"} 2
+test_server_response_size_bytes_bucket{method="POST",route="/users/:id",status_class="2xx",le="+Inf"} 2
+test_server_response_size_bytes_sum{method="POST",route="/users/:id",status_class="2xx"} 10
+test_server_response_size_bytes_count{method="POST",route="/users/:id",status_class="2xx"} 2
+test_server_response_size_bytes_bucket{method="other",route="unknown",status_class="4xx",le="10"} 0
+test_server_response_size_bytes_bucket{method="other",route="unknown",status_class="4xx",le="100"} 1
+test_server_response_size_bytes_bucket{method="other",route="unknown",status_class="4xx",le="+Inf"} 1
+test_server_response_size_bytes_sum{method="other",route="unknown",status_class="4xx"} 18
+test_server_response_size_bytes_count{method="other",route="unknown",status_class="4xx"} 1
+# HELP test_server_requests_in_flight Number of HTTP requests being served.
+# TYPE test_server_requests_in_flight gauge
+test_server_requests_in_flight 0
+`), "test_server_request_size_bytes", "test_server_response_size_bytes", "test_server_requests_in_flight"))
+	count, err := testutil.GatherAndCount(registry, "test_server_request_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	// building twice shares metrics instead of panicking
+	assert.NotPanics(t, func() {
+		NewMiddlewareBuilder(registry).Namespace("test").SizeBuckets(10, 100).Build()
+	})
+}
+
+func TestMiddlewareBuilder_Panic(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(NewMiddlewareBuilder(registry).Build()))
+	server.Get("/panic", func(ctx *web.Context) {
+		panic("boom")
+	})
+	assert.PanicsWithValue(t, "boom", func() {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP http_server_requests_in_flight Number of HTTP requests being served.
+# TYPE http_server_requests_in_flight gauge
+http_server_requests_in_flight 0
+`), "http_server_requests_in_flight"))
+	count, err := testutil.GatherAndCount(registry, "http_server_request_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestStatusClass(t *testing.T) {
+	testCases := []struct {
+		status int
+		want   string
+	}{
+		{status: 200, want: "2xx"},
+		{status: 304, want: "3xx"},
+		{status: 499, want: "4xx"},
+		{status: 503, want: "5xx"},
+		{status: 999, want: "unknown"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, statusClass(tc.status))
+	}
+}
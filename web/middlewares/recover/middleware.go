@@ -1,26 +1,86 @@
 package recover
 
 import (
+	"fmt"
 	"github.com/CoucouMonEcho/go-framework/web"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
 )
 
+// PanicError is the recovered panic with stack of the panicking goroutine
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// MiddlewareBuilder builds middleware recovering panics of handlers,
+// panic is recorded by Context.SetError as web.HTTPError caused by PanicError,
+// so errhandle middleware placed outside renders it, unless Data is set,
+// http.ErrAbortHandler is not recovered
 type MiddlewareBuilder struct {
+	// Code is the status of response, default 500
 	Code int
+	// Data is the body of response if set
 	Data []byte
-	// log func(err any)
+	// Log is called after panic recovered
+	//
+	// Deprecated: use Reporter which receives panic value and stack
 	Log func(ctx *web.Context)
-	// log func(stack string)
+	// Reporter receives recovered panic, it is logged by slog.Default if nil
+	Reporter func(ctx *web.Context, err *PanicError)
 }
 
 func (m MiddlewareBuilder) Build() web.Middleware {
+	if m.Code == 0 {
+		m.Code = http.StatusInternalServerError
+	}
+	if m.Reporter == nil {
+		m.Reporter = func(ctx *web.Context, err *PanicError) {
+			slog.Default().ErrorContext(ctx.Req.Context(), "recover: panic",
+				slog.Any("error", err.Value),
+				slog.String("route", ctx.MatchedRoute),
+				slog.String("stack", string(err.Stack)))
+		}
+	}
 	return func(next web.Handler) web.Handler {
 		return func(ctx *web.Context) {
 			defer func() {
-				if err := recover(); err != nil {
-					ctx.RespData = m.Data
-					ctx.RespCode = m.Code
+				val := recover()
+				if val == nil {
+					return
+				}
+				if val == http.ErrAbortHandler {
+					// suppresses logging of net/http
+					panic(val)
+				}
+				err := &PanicError{Value: val, Stack: debug.Stack()}
+				m.Reporter(ctx, err)
+				if m.Log != nil {
 					m.Log(ctx)
 				}
+				if ctx.Committed() {
+					// status has been sent
+					return
+				}
+				if m.Data != nil {
+					ctx.RespCode = m.Code
+					ctx.RespData = m.Data
+					return
+				}
+				ctx.SetError(&web.HTTPError{Status: m.Code, Err: err})
+				// partial body is dropped
+				ctx.RespData = nil
 			}()
 			next(ctx)
 		}
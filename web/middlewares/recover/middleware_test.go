@@ -1,26 +1,106 @@
 package recover
 
 import (
-	"fmt"
+	"errors"
 	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestMiddlewareBuilder_Build(t *testing.T) {
-	builder := MiddlewareBuilder{
-		Code: http.StatusInternalServerError,
-		Data: []byte("panic"),
-		Log: func(ctx *web.Context) {
-			fmt.Printf("panic path: %s", ctx.Req.URL.String())
+	cause := errors.New("nil map")
+	testCases := []struct {
+		name     string
+		builder  MiddlewareBuilder
+		handler  web.Handler
+		wantCode int
+		wantBody string
+		wantErr  error
+	}{
+		{
+			name:     "default",
+			handler:  func(ctx *web.Context) { panic("boom") },
+			wantCode: http.StatusInternalServerError,
 		},
+		{
+			name:     "error value",
+			handler:  func(ctx *web.Context) { panic(cause) },
+			wantCode: http.StatusInternalServerError,
+			wantErr:  cause,
+		},
+		{
+			name:     "data",
+			builder:  MiddlewareBuilder{Code: http.StatusServiceUnavailable, Data: []byte("panic")},
+			handler:  func(ctx *web.Context) { panic("boom") },
+			wantCode: http.StatusServiceUnavailable,
+			wantBody: "panic",
+		},
+		{
+			name: "partial body",
+			handler: func(ctx *web.Context) {
+				ctx.RespData = []byte("half")
+				panic("boom")
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reported *PanicError
+			var recorded error
+			logged := false
+			builder := tc.builder
+			builder.Reporter = func(ctx *web.Context, err *PanicError) {
+				reported = err
+			}
+			builder.Log = func(ctx *web.Context) {
+				logged = true
+			}
+			server := web.NewHTTPServer(web.ServerWithMiddlewares(func(next web.Handler) web.Handler {
+				return func(ctx *web.Context) {
+					next(ctx)
+					recorded = ctx.Err()
+				}
+			}, builder.Build()))
+			server.Get("/user", tc.handler)
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.True(t, logged)
+			require.NotNil(t, reported)
+			// stack points to the panicking handler
+			assert.Contains(t, string(reported.Stack), "recover.TestMiddlewareBuilder_Build")
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, reported, tc.wantErr)
+			}
+			if tc.builder.Data == nil {
+				assert.ErrorIs(t, recorded, error(reported))
+				assert.Equal(t, tc.wantCode, web.StatusOf(recorded))
+			}
+		})
 	}
+}
 
-	server := web.NewHTTPServer(web.ServerWithMiddlewares(builder.Build()))
-	server.Get("/user", func(ctx *web.Context) {
-		panic("panic")
+func TestMiddlewareBuilder_Defaults(t *testing.T) {
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(MiddlewareBuilder{}.Build()))
+	server.Get("/panic", func(ctx *web.Context) {
+		panic("boom")
+	})
+	server.Get("/abort", func(ctx *web.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	recorder := httptest.NewRecorder()
+	assert.NotPanics(t, func() {
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
 	})
-	err := server.Start(":8081")
-	require.NoError(t, err)
 }
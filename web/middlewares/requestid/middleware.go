@@ -0,0 +1,83 @@
+package requestid
+
+import (
+	"context"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/google/uuid"
+)
+
+// Key is the key of request id in Context.UserValues
+const Key = "requestid"
+
+type requestIDKey struct{}
+
+// FromContext returns request id stored by middleware
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// Get returns request id stored in ctx.UserValues by middleware
+func Get(ctx *web.Context) string {
+	id, _ := ctx.UserValues[Key].(string)
+	return id
+}
+
+// MiddlewareBuilder builds middleware propagating request id,
+// id of request header is kept if valid, otherwise a new one is generated,
+// it is echoed in response header and stored in Context.UserValues and request context
+type MiddlewareBuilder struct {
+	header    string
+	generator func() string
+}
+
+func NewMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		header:    "X-Request-ID",
+		generator: uuid.NewString,
+	}
+}
+
+// Header sets header carrying request id, default X-Request-ID
+func (m *MiddlewareBuilder) Header(name string) *MiddlewareBuilder {
+	m.header = name
+	return m
+}
+
+// Generator sets function generating request id, default uuid v4
+func (m *MiddlewareBuilder) Generator(generator func() string) *MiddlewareBuilder {
+	m.generator = generator
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.Handler) web.Handler {
+		return func(ctx *web.Context) {
+			id := ctx.Req.Header.Get(m.header)
+			if !valid(id) {
+				id = m.generator()
+			}
+			ctx.Resp.Header().Set(m.header, id)
+			if ctx.UserValues == nil {
+				ctx.UserValues = make(map[string]any, 4)
+			}
+			ctx.UserValues[Key] = id
+			ctx.Req = ctx.Req.WithContext(context.WithValue(ctx.Req.Context(), requestIDKey{}, id))
+			next(ctx)
+		}
+	}
+}
+
+// valid reports whether id from client is safe to log and echo,
+// only printable ASCII is accepted and length is limited
+func valid(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package requestid
+
+import (
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	server := web.NewHTTPServer(web.ServerWithMiddlewares(NewMiddlewareBuilder().Generator(func() string {
+		return "generated"
+	}).Build()))
+	server.Get("/", func(ctx *web.Context) {
+		id, _ := FromContext(ctx.Req.Context())
+		ctx.RespData = []byte(Get(ctx) + " " + id)
+	})
+
+	testCases := []struct {
+		name   string
+		header string
+		wantID string
+	}{
+		{name: "generated", wantID: "generated"},
+		{name: "propagated", header: "abc-123", wantID: "abc-123"},
+		{name: "invalid", header: "abc 123", wantID: "generated"},
+		{name: "too long", header: strings.Repeat("a", 129), wantID: "generated"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("X-Request-ID", tc.header)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantID, recorder.Header().Get("X-Request-ID"))
+			assert.Equal(t, tc.wantID+" "+tc.wantID, recorder.Body.String())
+		})
+	}
+}
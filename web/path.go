@@ -0,0 +1,110 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrailingSlash decides how to serve request path ends with '/'
+type TrailingSlash int
+
+const (
+	// TrailingSlashTolerate serves /users/ by route /users
+	TrailingSlashTolerate TrailingSlash = iota
+	// TrailingSlashRedirect redirects /users/ to /users if it could be served
+	TrailingSlashRedirect
+	// TrailingSlashStrict responds 404 for /users/
+	TrailingSlashStrict
+)
+
+// ServerWithTrailingSlash sets policy of request path ends with '/', default TrailingSlashTolerate
+func ServerWithTrailingSlash(policy TrailingSlash) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.trailingSlash = policy
+	}
+}
+
+// ServerWithCaseInsensitive matches static segments ignoring case,
+// values of path params keep case of request
+func ServerWithCaseInsensitive() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.router.caseInsensitive = true
+	}
+}
+
+// ServerWithCleanPath redirects path with '.', '..' or duplicate slashes to the cleaned one,
+// such path is rejected with 400 otherwise
+func ServerWithCleanPath() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.cleanPath = true
+	}
+}
+
+// normalizePath returns path for routing,
+// false is returned if redirect or 400 response has been set
+func (h *HTTPServer) normalizePath(ctx *Context) (string, bool) {
+	p := ctx.Req.URL.Path
+	if p == "" || p[0] != '/' {
+		ctx.SetError(ErrMalformedPath)
+		ctx.RespData = []byte("400 malformed path")
+		return "", false
+	}
+	target := p
+	if h.cleanPath {
+		target = path.Clean(p)
+		if target != "/" && strings.HasSuffix(p, "/") {
+			// trailing slash is decided by policy
+			target += "/"
+		}
+	} else if !isCleanPath(p) {
+		ctx.SetError(ErrMalformedPath)
+		ctx.RespData = []byte("400 malformed path")
+		return "", false
+	}
+	trailing := target != "/" && strings.HasSuffix(target, "/")
+	if trailing && h.trailingSlash == TrailingSlashRedirect {
+		if trimmed := strings.TrimRight(target, "/"); len(h.router.allowedMethods(trimmed)) > 0 {
+			target, trailing = trimmed, false
+		}
+	}
+	if target != p {
+		redirect(ctx, target)
+		return "", false
+	}
+	if trailing && h.trailingSlash == TrailingSlashStrict {
+		ctx.SetError(ErrNotFound)
+		ctx.RespData = []byte("404 page not found")
+		return "", false
+	}
+	return p, true
+}
+
+// isCleanPath reports whether p contains no '.', '..' or empty segments except the trailing one
+func isCleanPath(p string) bool {
+	for start := 1; start < len(p); {
+		end := strings.IndexByte(p[start:], '/')
+		if end < 0 {
+			// the last segment
+			end = len(p) - start
+		}
+		seg := p[start : start+end]
+		start += end + 1
+		if seg == "." || seg == ".." || seg == "" && start <= len(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// redirect keeps method and body of non GET requests by 308
+func redirect(ctx *Context, target string) {
+	code := http.StatusPermanentRedirect
+	if ctx.Req.Method == http.MethodGet || ctx.Req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	location := &url.URL{Path: target, RawQuery: ctx.Req.URL.RawQuery}
+	ctx.Resp.Header().Set("Location", location.String())
+	ctx.RespCode = code
+}
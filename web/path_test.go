@@ -0,0 +1,93 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServer_normalizePath(t *testing.T) {
+	newServer := func(opts ...HTTPServerOption) *HTTPServer {
+		h := NewHTTPServer(opts...)
+		h.Get("/", func(ctx *Context) {
+			ctx.RespData = []byte("root")
+		})
+		h.Get("/users", func(ctx *Context) {
+			ctx.RespData = []byte("users")
+		})
+		h.Post("/users", func(ctx *Context) {
+			ctx.RespData = []byte("create")
+		})
+		h.Get("/users/:name", func(ctx *Context) {
+			ctx.RespData = []byte("user " + ctx.PathValue("name").val)
+		})
+		return h
+	}
+
+	testCases := []struct {
+		name         string
+		opts         []HTTPServerOption
+		method       string
+		target       string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "tolerate", target: "/users/", wantCode: http.StatusOK, wantBody: "users"},
+		{name: "root", target: "/", wantCode: http.StatusOK, wantBody: "root"},
+		{name: "duplicate slashes", target: "/users//tom", wantCode: http.StatusBadRequest, wantBody: "400 malformed path"},
+		{name: "dot dot", target: "/users/../users", wantCode: http.StatusBadRequest, wantBody: "400 malformed path"},
+		{name: "not absolute", method: http.MethodOptions, target: "*", wantCode: http.StatusBadRequest, wantBody: "400 malformed path"},
+		{name: "case sensitive", target: "/Users", wantCode: http.StatusNotFound, wantBody: "404 page not found"},
+
+		{name: "redirect", opts: []HTTPServerOption{ServerWithTrailingSlash(TrailingSlashRedirect)},
+			target: "/users/?page=2", wantCode: http.StatusMovedPermanently, wantLocation: "/users?page=2"},
+		{name: "redirect post", opts: []HTTPServerOption{ServerWithTrailingSlash(TrailingSlashRedirect)},
+			method: http.MethodPost, target: "/users/", wantCode: http.StatusPermanentRedirect, wantLocation: "/users"},
+		{name: "redirect not found", opts: []HTTPServerOption{ServerWithTrailingSlash(TrailingSlashRedirect)},
+			target: "/orders/", wantCode: http.StatusNotFound, wantBody: "404 page not found"},
+		{name: "strict", opts: []HTTPServerOption{ServerWithTrailingSlash(TrailingSlashStrict)},
+			target: "/users/", wantCode: http.StatusNotFound, wantBody: "404 page not found"},
+		{name: "strict root", opts: []HTTPServerOption{ServerWithTrailingSlash(TrailingSlashStrict)},
+			target: "/", wantCode: http.StatusOK, wantBody: "root"},
+
+		{name: "clean", opts: []HTTPServerOption{ServerWithCleanPath()},
+			target: "/a/../users//./tom?x=1", wantCode: http.StatusMovedPermanently, wantLocation: "/users/tom?x=1"},
+		{name: "clean escaped", opts: []HTTPServerOption{ServerWithCleanPath()},
+			target: "//users/tom cat", wantCode: http.StatusMovedPermanently, wantLocation: "/users/tom%20cat"},
+		{name: "clean keeps trailing slash", opts: []HTTPServerOption{ServerWithCleanPath()},
+			target: "/users//", wantCode: http.StatusMovedPermanently, wantLocation: "/users/"},
+		{name: "clean with redirect", opts: []HTTPServerOption{ServerWithCleanPath(), ServerWithTrailingSlash(TrailingSlashRedirect)},
+			target: "/users//", wantCode: http.StatusMovedPermanently, wantLocation: "/users"},
+		{name: "clean post", opts: []HTTPServerOption{ServerWithCleanPath()},
+			method: http.MethodPost, target: "/./users", wantCode: http.StatusPermanentRedirect, wantLocation: "/users"},
+		{name: "clean root", opts: []HTTPServerOption{ServerWithCleanPath()},
+			target: "/..", wantCode: http.StatusMovedPermanently, wantLocation: "/"},
+
+		{name: "case insensitive", opts: []HTTPServerOption{ServerWithCaseInsensitive()},
+			target: "/USERS/Tom", wantCode: http.StatusOK, wantBody: "user Tom"},
+		{name: "case insensitive static", opts: []HTTPServerOption{ServerWithCaseInsensitive()},
+			target: "/Users", wantCode: http.StatusOK, wantBody: "users"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newServer(tc.opts...)
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			// keep target as sent by client
+			req.URL.Path, req.URL.RawQuery, _ = strings.Cut(tc.target, "?")
+			recorder := httptest.NewRecorder()
+			assert.NotPanics(t, func() {
+				h.ServeHTTP(recorder, req)
+			})
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -2,22 +2,48 @@ package web
 
 import (
 	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// anyMethods are methods registered by Any
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
 type router struct {
 	// method -> root
 	trees map[string]*node
+	// route name -> pattern
+	names map[string]string
+	// caseInsensitive matches static segments ignoring case
+	caseInsensitive bool
 }
 
 func newRouter() router {
 	return router{
 		trees: map[string]*node{},
+		names: map[string]string{},
 	}
 }
 
-func (r *router) addRoute(method string, path string, handler Handler, middlewares ...Middleware) {
+// addRoute registers handler on path,
+// if handler is nil, middlewares take effect on path and all its sub routes,
+// otherwise middlewares only take effect on this route
+func (r *router) addRoute(method string, path string, handler Handler, middlewares ...Middleware) *Route {
 	if path == "" {
 		panic("web: empty path")
 	}
@@ -36,13 +62,9 @@ func (r *router) addRoute(method string, path string, handler Handler, middlewar
 		r.trees[method] = root
 	}
 	if path == "/" {
-		if root.handler != nil {
-			panic("web: '/' already has a handler")
-		}
-		root.handler = handler
-		root.route = "/"
-		root.middlewares = middlewares
-		return
+		root.register(path, handler, middlewares)
+		r.prepareChains(method, root, handler == nil)
+		return &Route{router: r, pattern: path, nodes: []*node{root}}
 	}
 	for _, seg := range strings.Split(path, "/")[1:] {
 		if seg == "" {
@@ -52,12 +74,41 @@ func (r *router) addRoute(method string, path string, handler Handler, middlewar
 		// do not edit node here
 		root = child
 	}
-	if root.handler != nil {
-		panic(fmt.Sprintf("web: path '%s' already exist", path))
+	root.register(path, handler, middlewares)
+	r.prepareChains(method, root, handler == nil)
+	return &Route{router: r, pattern: path, nodes: []*node{root}}
+}
+
+// prepareChains precomputes chains after registration,
+// middlewares used on path affect all routes of method, a route only affects itself
+func (r *router) prepareChains(method string, n *node, used bool) {
+	if !used {
+		r.prepareChain(method, n)
+		return
 	}
-	root.handler = handler
-	root.route = path
-	root.middlewares = middlewares
+	r.trees[method].walk("", func(_ string, n *node) {
+		if n.handler != nil {
+			r.prepareChain(method, n)
+		}
+	})
+}
+
+// prepareChain wraps handler of n with its middlewares in advance,
+// chain is left nil if middlewares are used on nodes matching only part of requests of the route,
+// such as /users/me for /users/:id, they are collected by request path when serving
+func (r *router) prepareChain(method string, n *node) {
+	n.chain = nil
+	var segs []string
+	pattern := ""
+	if n.route != "/" {
+		pattern = n.route
+		segs = strings.Split(pattern[1:], "/")
+	}
+	wildcard := len(segs) > 0 && segs[len(segs)-1] == "*"
+	if r.trees[method].partialMiddlewares(segs, false, r.caseInsensitive, wildcard) {
+		return
+	}
+	n.chain = chain(n.handler, slices.Concat(r.patternMiddlewares(method, pattern), n.routeMiddlewares))
 }
 
 func (r *router) route(method string, path string) (*matchInfo, bool) {
@@ -65,40 +116,86 @@ func (r *router) route(method string, path string) (*matchInfo, bool) {
 	if !ok {
 		return nil, false
 	}
-	mi := &matchInfo{
-		node: root,
-	}
-	if path == "/" {
-		return mi, mi.node.handler != nil
+	var params []pathParam
+	n := r.find(root, path, &params)
+	if n == nil {
+		return nil, false
 	}
-
-	var pathParams map[string]string
-	segs := strings.Split(strings.Trim(path, "/"), "/")
-	for _, seg := range segs {
-		if seg == "" {
-			panic("web: path can not contains '//'")
+	mi := &matchInfo{node: n}
+	for _, param := range params {
+		if mi.pathParams == nil {
+			mi.pathParams = make(map[string]string, len(params))
 		}
-		child, ok := mi.node.childOf(seg)
-		if !ok {
-			if mi.node.nodeType == nodeTypeWildcard {
-				return mi, mi.node.handler != nil
+		mi.pathParams[param.key] = param.val
+		if param.typed != nil {
+			if mi.typedPathParams == nil {
+				mi.typedPathParams = make(map[string]any, len(params))
 			}
-			return nil, false
+			mi.typedPathParams[param.key] = param.typed
 		}
-		if child.nodeType == nodeTypePathParam || child.nodeType == nodeTypeRegular {
-			if pathParams == nil {
-				pathParams = make(map[string]string)
-			}
-			pathParams[child.path[1:]] = seg
+	}
+	mi.middlewares = append(findMiddlewares(root, pathSegments(path), r.caseInsensitive), n.routeMiddlewares...)
+	return mi, true
+}
+
+// find returns the node with handler matching path, path params are appended to params,
+// segments are sliced from path by index so that static routes are matched without allocation
+func (r *router) find(root *node, path string, params *[]pathParam) *node {
+	if path == "/" {
+		if root.handler == nil {
+			return nil
 		}
-		mi.node = child
+		return root
+	}
+	path = strings.Trim(path, "/")
+	if path == "" || strings.Contains(path, "//") {
+		// malformed path is rejected before routing
+		return nil
 	}
-	mi.pathParams = pathParams
-	mi.middlewares = findMiddlewares(root, segs)
-	return mi, mi.node.handler != nil
+	return root.search(path, params, r.caseInsensitive)
 }
 
-func findMiddlewares(root *node, segs []string) []Middleware {
+// pathSegments splits path for collecting middlewares, trailing slash is ignored
+func pathSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		// only middlewares of root
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// allowedMethods returns sorted methods which could serve path,
+// HEAD and OPTIONS are always allowed if any method matched
+func (r *router) allowedMethods(path string) []string {
+	var res []string
+	for method := range r.trees {
+		if _, ok := r.route(method, path); ok {
+			res = append(res, method)
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	if slices.Contains(res, http.MethodGet) && !slices.Contains(res, http.MethodHead) {
+		res = append(res, http.MethodHead)
+	}
+	if !slices.Contains(res, http.MethodOptions) {
+		res = append(res, http.MethodOptions)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// findMiddlewares collects middlewares of nodes matching segs level by level
+func findMiddlewares(root *node, segs []string, fold bool) []Middleware {
+	return collectMiddlewares(root, segs, func(n *node, seg string) bool {
+		_, ok := n.matchSegment(seg, fold)
+		return ok
+	})
+}
+
+func collectMiddlewares(root *node, segs []string, match func(n *node, seg string) bool) []Middleware {
 	// use queue to level-order traversal
 	queue := []*node{root}
 	res := make([]Middleware, 0, 16)
@@ -106,36 +203,63 @@ func findMiddlewares(root *node, segs []string) []Middleware {
 		seg := segs[i]
 		var children []*node
 		for _, cur := range queue {
-			if len(cur.children) > 0 {
-				res = append(res, cur.middlewares...)
-			}
-			var curChildren []*node
+			res = append(res, cur.middlewares...)
 			for _, curChild := range cur.children {
-				if curChild.path == seg || curChild.nodeType != nodeTypeStatic {
-					curChildren = append(children, curChild)
+				if match(curChild, seg) {
+					children = append(children, curChild)
 				}
 			}
-			children = append(children, curChildren...)
 		}
 		queue = children
 	}
 	for _, cur := range queue {
-		if len(cur.children) > 0 {
-			res = append(res, cur.middlewares...)
-		}
+		res = append(res, cur.middlewares...)
 	}
 	return res
 }
 
+// node is a segment of path, children are matched by priority:
+//
+//	static       /users/profile
+//	regular      /users/:id<int>, /users/:name([a-z]+), in registration order
+//	path param   /users/:name
+//	wildcard     /users/*
+//
+// if the sub path can not be matched by a child, the next one is tried,
+// wildcard as the last matched node matches the rest of path
 type node struct {
-	route       string
-	path        string
-	children    []*node
-	nodeType    nodeType
-	handler     Handler
+	route    string
+	name     string
+	path     string
+	children []*node
+	// sorted are children sorted by node type for searching, registration order is kept for the same type
+	sorted   []*node
+	nodeType nodeType
+	handler  Handler
+	// constraint restricts value of regular node
+	constraint *paramConstraint
+	// middlewares take effect on this node and its sub nodes
 	middlewares []Middleware
+	// routeMiddlewares only take effect on handler of this node
+	routeMiddlewares []Middleware
+	// chain is handler wrapped with middlewares, nil if middlewares depend on request path
+	chain Handler
 }
 
+func (n *node) register(path string, handler Handler, middlewares []Middleware) {
+	if handler == nil {
+		n.middlewares = append(n.middlewares, middlewares...)
+		return
+	}
+	if n.handler != nil {
+		panic(fmt.Sprintf("web: path '%s' already exist", path))
+	}
+	n.handler = handler
+	n.route = path
+	n.routeMiddlewares = middlewares
+}
+
+// nodeType is declared in priority of matching
 type nodeType int
 
 const (
@@ -145,91 +269,267 @@ const (
 	nodeTypeWildcard
 )
 
-var regCompileMap map[int]*regexp.Regexp
+func (n *node) childOrCreate(seg string) *node {
+	typ, path, constraint := parseSegment(seg)
+	for _, child := range n.children {
+		if child.nodeType != typ {
+			if typ == nodeTypePathParam && child.nodeType == nodeTypeWildcard ||
+				typ == nodeTypeWildcard && child.nodeType == nodeTypePathParam {
+				panic("web: path param and wildcard can not be registered on the same node")
+			}
+			continue
+		}
+		switch typ {
+		case nodeTypePathParam:
+			if child.path != path {
+				panic(fmt.Sprintf("web: path param '%s' conflicts with '%s'", path, child.path))
+			}
+			return child
+		case nodeTypeRegular:
+			if child.constraint.expr != constraint.expr {
+				continue
+			}
+			if child.path != path {
+				panic("web: duplicate regular router")
+			}
+			return child
+		default:
+			if child.path == path {
+				return child
+			}
+		}
+	}
+	child := &node{path: path, nodeType: typ, constraint: constraint}
+	n.children = append(n.children, child)
+	idx, _ := slices.BinarySearchFunc(n.sorted, typ+1, func(n *node, typ nodeType) int {
+		return int(n.nodeType - typ)
+	})
+	n.sorted = slices.Insert(n.sorted, idx, child)
+	return child
+}
 
-func (n *node) childOrCreate(path string) *node {
-	if n.children == nil {
-		n.children = []*node{}
+// matchSegment reports whether seg matches the node, static path is compared ignoring case if fold,
+// parsed value of typed path param is returned
+func (n *node) matchSegment(seg string, fold bool) (any, bool) {
+	switch n.nodeType {
+	case nodeTypeStatic:
+		return nil, n.path == seg || fold && strings.EqualFold(n.path, seg)
+	case nodeTypeRegular:
+		return n.constraint.match(seg)
 	}
-	var needChildType nodeType
-	var regIndexL int
-	var regCompile *regexp.Regexp
+	return nil, true
+}
 
-	if regIndexL = strings.Index(path, "("); regIndexL > 0 && regIndexL < len(path)-1 && strings.HasSuffix(path, ")") {
-		needChildType = nodeTypeRegular
-		if c, err := regexp.Compile(path[regIndexL+1 : len(path)-1]); err != nil {
-			panic("web: invalid regular expression")
-		} else {
-			regCompile = c
+// search finds the node with handler matching path by priority with backtracking,
+// path has no leading slash and params appended by failed branches are truncated
+func (n *node) search(path string, params *[]pathParam, fold bool) *node {
+	if path == "" {
+		if n.handler == nil {
+			return nil
 		}
-	} else if path[0] == ':' {
-		needChildType = nodeTypePathParam
-	} else if path == "*" {
-		needChildType = nodeTypeWildcard
-	} else {
-		needChildType = nodeTypeStatic
+		return n
 	}
-
-	for index, child := range n.children {
-		if nodeTypeRegular == needChildType && nodeTypeRegular == child.nodeType {
-			isPathEqual := child.path == path[:regIndexL]
-			isRegEqual := regCompileMap != nil && regCompileMap[index] != nil && regCompileMap[index].String() == path[regIndexL+1:len(path)-1]
-			if !isPathEqual && isRegEqual || isPathEqual && !isRegEqual {
-				panic("web: duplicate regular router")
-			} else if isPathEqual && isRegEqual {
-				return child
-			}
+	seg, rest := path, ""
+	if idx := strings.IndexByte(path, '/'); idx >= 0 {
+		seg, rest = path[:idx], path[idx+1:]
+	}
+	for _, child := range n.sorted {
+		typed, ok := child.matchSegment(seg, fold)
+		if !ok {
 			continue
-		} else if nodeTypeStatic != needChildType && nodeTypeStatic != child.nodeType && needChildType != child.nodeType {
-			panic("web: can not register too many non static nodes")
 		}
-		if child.nodeType == needChildType && child.path == path {
+		size := len(*params)
+		if child.nodeType == nodeTypeRegular || child.nodeType == nodeTypePathParam {
+			*params = append(*params, pathParam{key: child.path[1:], val: seg, typed: typed})
+		}
+		if res := child.search(rest, params, fold); res != nil {
+			return res
+		}
+		if child.nodeType == nodeTypeWildcard && child.handler != nil {
 			return child
 		}
+		*params = (*params)[:size]
+	}
+	return nil
+}
+
+// partialMiddlewares reports whether middlewares are used on nodes matching part of requests of segs,
+// partial means n or one of its ancestors does not cover its segment
+func (n *node) partialMiddlewares(segs []string, partial bool, fold bool, wildcard bool) bool {
+	if partial && len(n.middlewares) > 0 {
+		return true
 	}
-	if nodeTypeRegular == needChildType {
-		if regCompileMap == nil {
-			regCompileMap = make(map[int]*regexp.Regexp)
+	if len(segs) == 0 {
+		// requests of wildcard could be longer than pattern
+		return wildcard && slices.ContainsFunc(n.children, (*node).hasMiddlewares)
+	}
+	typ, path, constraint := parseSegment(segs[0])
+	for _, child := range n.children {
+		covered, overlapped := child.covers(typ, path, constraint, fold)
+		if overlapped && child.partialMiddlewares(segs[1:], partial || !covered, fold, wildcard) {
+			return true
 		}
-		regCompileMap[len(n.children)] = regCompile
-		path = path[:regIndexL]
 	}
-	child := &node{path: path, nodeType: needChildType}
-	n.children = append(n.children, child)
-	return child
+	return false
 }
 
-func (n *node) childOf(path string) (*node, bool) {
-	if n.children == nil {
-		return nil, false
-	}
-	nonStaticChildren := make(map[int]*node)
-	for index, child := range n.children {
-		if child.nodeType == nodeTypeStatic && child.path == path {
-			return child, true
+// covers reports whether n matches every segment matched by the pattern segment,
+// and whether n matches any of them, it is conservative when fold
+func (n *node) covers(typ nodeType, path string, constraint *paramConstraint, fold bool) (bool, bool) {
+	switch n.nodeType {
+	case nodeTypeStatic:
+		switch {
+		case typ == nodeTypeStatic && n.path == path:
+			return true, true
+		case typ == nodeTypeStatic:
+			return false, fold && strings.EqualFold(n.path, path)
+		case typ == nodeTypeRegular && !fold:
+			_, ok := constraint.match(n.path)
+			return false, ok
 		}
-		if child.nodeType != nodeTypeStatic {
-			nonStaticChildren[index] = child
+		return false, true
+	case nodeTypeRegular:
+		switch {
+		case typ == nodeTypeStatic && !fold:
+			_, ok := n.constraint.match(path)
+			return ok, ok
+		case typ == nodeTypeRegular && n.constraint.covers(constraint):
+			return true, true
 		}
+		return false, true
 	}
-	for index, nonStaticChild := range nonStaticChildren {
-		if nonStaticChild == nil {
-			continue
+	return true, true
+}
+
+func (n *node) hasMiddlewares() bool {
+	return len(n.middlewares) > 0 || slices.ContainsFunc(n.children, (*node).hasMiddlewares)
+}
+
+type pathParam struct {
+	key   string
+	val   string
+	typed any
+}
+
+type matchInfo struct {
+	node            *node
+	pathParams      map[string]string
+	typedPathParams map[string]any
+	middlewares     []Middleware
+}
+
+// paramConstraint restricts value of path param
+type paramConstraint struct {
+	// expr is the constraint with brackets in segment, such as <int> or ([0-9]+)
+	expr  string
+	match func(seg string) (any, bool)
+}
+
+// paramTypes are typed constraints, parsed values are returned by Context.TypedPathValue
+var paramTypes = map[string]func(seg string) (any, bool){
+	"int": func(seg string) (any, bool) {
+		if !isDigits(strings.TrimPrefix(strings.TrimPrefix(seg, "-"), "+")) {
+			// syntax error of strconv allocates
+			return nil, false
+		}
+		val, err := strconv.ParseInt(seg, 10, 64)
+		return val, err == nil
+	},
+	"uint": func(seg string) (any, bool) {
+		if !isDigits(seg) {
+			return nil, false
+		}
+		val, err := strconv.ParseUint(seg, 10, 64)
+		return val, err == nil
+	},
+	"float": func(seg string) (any, bool) {
+		val, err := strconv.ParseFloat(seg, 64)
+		return val, err == nil && !math.IsNaN(val) && !math.IsInf(val, 0)
+	},
+	"bool": func(seg string) (any, bool) {
+		// same as strconv.ParseBool without allocating errors
+		switch seg {
+		case "1", "t", "T", "true", "TRUE", "True":
+			return true, true
+		case "0", "f", "F", "false", "FALSE", "False":
+			return false, true
+		}
+		return nil, false
+	},
+	"uuid": func(seg string) (any, bool) {
+		// canonical form only
+		if len(seg) != 36 {
+			return nil, false
 		}
-		if nonStaticChild.nodeType != nodeTypeRegular {
-			return nonStaticChild, true
-		} else {
-			regCompile := regCompileMap[index]
-			if regCompile.Match([]byte(path)) {
-				return nonStaticChild, true
+		val, err := uuid.Parse(seg)
+		return val, err == nil
+	},
+	"alpha": func(seg string) (any, bool) {
+		for i := 0; i < len(seg); i++ {
+			if c := seg[i] | 0x20; c < 'a' || c > 'z' {
+				return nil, false
 			}
 		}
+		return seg, true
+	},
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
 	}
-	return nil, false
+	return true
 }
 
-type matchInfo struct {
-	node        *node
-	pathParams  map[string]string
-	middlewares []Middleware
+// parseSegment returns node type, node path and constraint of segment:
+//
+//	:name<int>      typed param, types are int, uint, float, bool, uuid and alpha
+//	:name<expr>     param matches regular expression entirely
+//	:name(expr)     param contains match of regular expression, kept as before <expr> was supported
+//	:name           param
+//	name            static
+//	*               wildcard
+func parseSegment(seg string) (nodeType, string, *paramConstraint) {
+	switch {
+	case seg == "*":
+		return nodeTypeWildcard, seg, nil
+	case seg == "" || seg[0] != ':':
+		return nodeTypeStatic, seg, nil
+	}
+	idx := strings.IndexAny(seg, "<(")
+	if idx < 0 {
+		return nodeTypePathParam, seg, nil
+	}
+	closing := byte(')')
+	if seg[idx] == '<' {
+		closing = '>'
+	}
+	if idx == 1 || seg[len(seg)-1] != closing || idx == len(seg)-2 {
+		panic(fmt.Sprintf("web: invalid path param '%s'", seg))
+	}
+	expr := seg[idx+1 : len(seg)-1]
+	constraint := &paramConstraint{expr: seg[idx:]}
+	if match, ok := paramTypes[expr]; ok && closing == '>' {
+		constraint.match = match
+		return nodeTypeRegular, seg[:idx], constraint
+	}
+	var reg *regexp.Regexp
+	var err error
+	if closing == '>' {
+		reg, err = compileRegexp(expr)
+	} else {
+		reg, err = regexp.Compile(expr)
+	}
+	if err != nil {
+		panic("web: invalid regular expression")
+	}
+	constraint.match = func(seg string) (any, bool) {
+		return nil, reg.MatchString(seg)
+	}
+	return nodeTypeRegular, seg[:idx], constraint
 }
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// benchRoutes are shaped like routes of an API gateway
+var benchRoutes = []string{
+	"/",
+	"/healthz",
+	"/api/v1/users",
+	"/api/v1/users/profile",
+	"/api/v1/users/:id<int>",
+	"/api/v1/users/:id<int>/posts",
+	"/api/v1/users/:id<int>/posts/:postId",
+	"/api/v1/users/:name/followers",
+	"/api/v1/orders/:no([A-Z]{2}[0-9]{6})",
+	"/api/v1/orders/:no([A-Z]{2}[0-9]{6})/items",
+	"/api/v1/search",
+	"/static/*",
+}
+
+var benchPaths = []struct {
+	name string
+	path string
+}{
+	{"static", "/api/v1/users/profile"},
+	{"static root", "/"},
+	{"param", "/api/v1/users/tom/followers"},
+	{"typed", "/api/v1/users/12/posts/34"},
+	{"regexp", "/api/v1/orders/AB123456/items"},
+	{"wildcard", "/static/css/app.css"},
+	{"backtrack", "/api/v1/users/12/followers"},
+}
+
+func newBenchServer(opts ...HTTPServerOption) *HTTPServer {
+	h := NewHTTPServer(opts...)
+	handler := func(ctx *Context) {
+		ctx.RespCode = http.StatusNoContent
+	}
+	for _, route := range benchRoutes {
+		h.Get(route, handler)
+	}
+	return h
+}
+
+func BenchmarkRouter_find(b *testing.B) {
+	h := newBenchServer()
+	root := h.router.trees[http.MethodGet]
+	for _, bp := range benchPaths {
+		b.Run(bp.name, func(b *testing.B) {
+			params := make([]pathParam, 0, 8)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				params = params[:0]
+				if h.router.find(root, bp.path, &params) == nil {
+					b.Fatalf("%s not found", bp.path)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHTTPServer_ServeHTTP(b *testing.B) {
+	mw := func(next Handler) Handler {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	}
+	servers := []struct {
+		name string
+		h    *HTTPServer
+	}{
+		{"bare", newBenchServer()},
+		{"middlewares", func() *HTTPServer {
+			h := newBenchServer(ServerWithMiddlewares(mw, mw))
+			h.Use(http.MethodGet, "/api", mw)
+			h.Use(http.MethodGet, "/api/v1/users/:id<int>", mw)
+			return h
+		}()},
+		{"path middlewares", func() *HTTPServer {
+			// middlewares collected by request path
+			h := newBenchServer()
+			h.Use(http.MethodGet, "/api/v1/users/me", mw)
+			return h
+		}()},
+	}
+	for _, server := range servers {
+		for _, bp := range benchPaths {
+			b.Run(server.name+"/"+bp.name, func(b *testing.B) {
+				req := httptest.NewRequest(http.MethodGet, bp.path, nil)
+				resp := &discardWriter{header: http.Header{}}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					server.h.ServeHTTP(resp, req)
+				}
+				if resp.code != http.StatusNoContent {
+					b.Fatalf("%s responded %d", bp.path, resp.code)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkHTTPServer_ServeHTTPParallel(b *testing.B) {
+	h := newBenchServer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/12/posts/34", nil)
+		resp := &discardWriter{header: http.Header{}}
+		for pb.Next() {
+			h.ServeHTTP(resp, req)
+		}
+	})
+}
@@ -1,8 +1,10 @@
 package web
 
 import (
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
@@ -51,14 +53,16 @@ func TestRouter_AddRoute(t *testing.T) {
 								handler:  mockHandler,
 								children: []*node{
 									{
-										path:     ":orderId",
-										nodeType: nodeTypeRegular,
-										handler:  mockHandler,
+										path:       ":orderId",
+										nodeType:   nodeTypeRegular,
+										handler:    mockHandler,
+										constraint: &paramConstraint{expr: "([0-9]+)"},
 									},
 									{
-										path:     ":orderId2",
-										nodeType: nodeTypeRegular,
-										handler:  mockHandler,
+										path:       ":orderId2",
+										nodeType:   nodeTypeRegular,
+										handler:    mockHandler,
+										constraint: &paramConstraint{expr: "([a-z]+)"},
 									},
 								},
 							},
@@ -99,10 +103,17 @@ func TestRouter_getRoute(t *testing.T) {
 		info      *matchInfo
 	}{
 		{"method not exist", http.MethodOptions, "/order/detail", false, nil},
-		{"static", http.MethodGet, "/order/detail", true, &matchInfo{node: &node{path: "detail", nodeType: nodeTypeStatic, handler: mockHandler, children: []*node{{path: ":orderId", nodeType: nodeTypeRegular, handler: mockHandler}}}}},
+		{"static", http.MethodGet, "/order/detail", true, &matchInfo{node: &node{path: "detail", nodeType: nodeTypeStatic, handler: mockHandler, children: []*node{
+			{path: ":orderId", nodeType: nodeTypeRegular, handler: mockHandler, constraint: &paramConstraint{expr: "([0-9]+)"}},
+			{path: ":orderId2", nodeType: nodeTypeRegular, handler: mockHandler, constraint: &paramConstraint{expr: "([a-z]+)"}},
+		}}}},
 		{"wild card", http.MethodGet, "/order/aaa", true, &matchInfo{node: &node{path: "*", nodeType: nodeTypeWildcard, handler: mockHandler, children: []*node{{path: ":id", nodeType: nodeTypePathParam, handler: mockHandler}}}}},
-		{"path param", http.MethodGet, "/order/detail/123o", true, &matchInfo{node: &node{path: ":orderId", nodeType: nodeTypeRegular, handler: mockHandler}, pathParams: map[string]string{"orderId": "123o"}}},
-		{"path param", http.MethodGet, "/order/detail/123o", true, &matchInfo{node: &node{path: ":orderId2", nodeType: nodeTypeRegular, handler: mockHandler}, pathParams: map[string]string{"orderId2": "123o"}}},
+		{"wild card rest", http.MethodGet, "/order/aaa/bbb/ccc", true, &matchInfo{node: &node{path: "*", nodeType: nodeTypeWildcard, handler: mockHandler, children: []*node{{path: ":id", nodeType: nodeTypePathParam, handler: mockHandler}}}}},
+		{"regular", http.MethodGet, "/order/detail/123", true, &matchInfo{node: &node{path: ":orderId", nodeType: nodeTypeRegular, handler: mockHandler, constraint: &paramConstraint{expr: "([0-9]+)"}}, pathParams: map[string]string{"orderId": "123"}}},
+		{"regular next", http.MethodGet, "/order/detail/abc", true, &matchInfo{node: &node{path: ":orderId2", nodeType: nodeTypeRegular, handler: mockHandler, constraint: &paramConstraint{expr: "([a-z]+)"}}, pathParams: map[string]string{"orderId2": "abc"}}},
+		{"path param", http.MethodGet, "/order/detail/123o", true, &matchInfo{node: &node{path: ":orderId", nodeType: nodeTypeRegular, handler: mockHandler, constraint: &paramConstraint{expr: "([0-9]+)"}}, pathParams: map[string]string{"orderId": "123o"}}},
+		{"regular backtrack", http.MethodGet, "/order/detail/-", true, &matchInfo{node: &node{path: ":id", nodeType: nodeTypePathParam, handler: mockHandler}, pathParams: map[string]string{"id": "-"}}},
+		{"not found", http.MethodGet, "/user", false, nil},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -118,6 +129,102 @@ func TestRouter_getRoute(t *testing.T) {
 	}
 }
 
+func TestRouter_typedParams(t *testing.T) {
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/users/:id<int>", mockHandler)
+	r.addRoute(http.MethodGet, "/users/:uid<uuid>", mockHandler)
+	r.addRoute(http.MethodGet, "/users/:name", mockHandler)
+	r.addRoute(http.MethodGet, "/users/me", mockHandler)
+	r.addRoute(http.MethodGet, "/items/:price<float>/:on<bool>", mockHandler)
+	r.addRoute(http.MethodGet, "/items/:code<[A-Z]{3}>", mockHandler)
+	r.addRoute(http.MethodGet, "/tags/:tag<alpha>", mockHandler)
+	r.addRoute(http.MethodGet, "/pages/:page<uint>/*", mockHandler)
+
+	testCases := []struct {
+		name      string
+		path      string
+		wantFound bool
+		wantRoute string
+		wantTyped map[string]any
+		wantParam map[string]string
+	}{
+		{name: "static first", path: "/users/me", wantFound: true, wantRoute: "/users/me"},
+		{name: "int", path: "/users/42", wantFound: true, wantRoute: "/users/:id<int>",
+			wantTyped: map[string]any{"id": int64(42)}, wantParam: map[string]string{"id": "42"}},
+		{name: "negative int", path: "/users/-1", wantFound: true, wantRoute: "/users/:id<int>",
+			wantTyped: map[string]any{"id": int64(-1)}, wantParam: map[string]string{"id": "-1"}},
+		{name: "int overflow", path: "/users/99999999999999999999", wantFound: true, wantRoute: "/users/:name",
+			wantParam: map[string]string{"name": "99999999999999999999"}},
+		{name: "uuid", path: "/users/7d444840-9dc0-11d1-b245-5ffdce74fad2", wantFound: true, wantRoute: "/users/:uid<uuid>",
+			wantTyped: map[string]any{"uid": uuid.MustParse("7d444840-9dc0-11d1-b245-5ffdce74fad2")},
+			wantParam: map[string]string{"uid": "7d444840-9dc0-11d1-b245-5ffdce74fad2"}},
+		{name: "plain", path: "/users/tom", wantFound: true, wantRoute: "/users/:name",
+			wantParam: map[string]string{"name": "tom"}},
+		{name: "float and bool", path: "/items/1.5/true", wantFound: true, wantRoute: "/items/:price<float>/:on<bool>",
+			wantTyped: map[string]any{"price": 1.5, "on": true}, wantParam: map[string]string{"price": "1.5", "on": "true"}},
+		{name: "float NaN", path: "/items/NaN/true", wantFound: false},
+		{name: "regexp", path: "/items/ABC", wantFound: true, wantRoute: "/items/:code<[A-Z]{3}>",
+			wantParam: map[string]string{"code": "ABC"}},
+		{name: "regexp anchored", path: "/items/ABCD", wantFound: false},
+		{name: "alpha", path: "/tags/Go", wantFound: true, wantRoute: "/tags/:tag<alpha>",
+			wantTyped: map[string]any{"tag": "Go"}, wantParam: map[string]string{"tag": "Go"}},
+		{name: "alpha not match", path: "/tags/go1", wantFound: false},
+		{name: "uint wildcard", path: "/pages/3/a/b", wantFound: true, wantRoute: "/pages/:page<uint>/*",
+			wantTyped: map[string]any{"page": uint64(3)}, wantParam: map[string]string{"page": "3"}},
+		{name: "uint not match", path: "/pages/-3/a", wantFound: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, found := r.route(http.MethodGet, tc.path)
+			assert.Equal(t, tc.wantFound, found)
+			if !found {
+				return
+			}
+			assert.Equal(t, tc.wantRoute, info.node.route)
+			assert.Equal(t, tc.wantTyped, info.typedPathParams)
+			assert.Equal(t, tc.wantParam, info.pathParams)
+		})
+	}
+}
+
+func TestRouter_paramConflicts(t *testing.T) {
+	testCases := []struct {
+		name      string
+		paths     []string
+		wantPanic string
+	}{
+		{name: "same constraint different name", paths: []string{"/a/:id<int>", "/a/:no<int>"},
+			wantPanic: "web: duplicate regular router"},
+		{name: "different param name", paths: []string{"/a/:id", "/a/:no"},
+			wantPanic: "web: path param ':no' conflicts with ':id'"},
+		{name: "param and wildcard", paths: []string{"/a/:id", "/a/*"},
+			wantPanic: "web: path param and wildcard can not be registered on the same node"},
+		{name: "invalid regexp", paths: []string{"/a/:id<[0-9>"},
+			wantPanic: "web: invalid regular expression"},
+		{name: "empty constraint", paths: []string{"/a/:id<>"},
+			wantPanic: "web: invalid path param ':id<>'"},
+		{name: "unclosed constraint", paths: []string{"/a/:id<int"},
+			wantPanic: "web: invalid path param ':id<int'"},
+		{name: "same name different constraint", paths: []string{"/a/:id<int>", "/a/:id<uuid>", "/a/:id"}},
+		{name: "constraint and wildcard", paths: []string{"/a/:id<int>", "/a/*"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRouter()
+			register := func() {
+				for _, path := range tc.paths {
+					r.addRoute(http.MethodGet, path, mockHandler)
+				}
+			}
+			if tc.wantPanic != "" {
+				assert.PanicsWithValue(t, tc.wantPanic, register)
+				return
+			}
+			assert.NotPanics(t, register)
+		})
+	}
+}
+
 func (r *router) equal(r2 *router) (string, bool) {
 	if r == r2 {
 		return "", true
@@ -151,6 +258,10 @@ func (n *node) equal(n2 *node) (string, bool) {
 	if n.nodeType != n2.nodeType {
 		return "node type not match", false
 	}
+	if (n.constraint == nil) != (n2.constraint == nil) ||
+		n.constraint != nil && n.constraint.expr != n2.constraint.expr {
+		return "constraint not match", false
+	}
 	if reflect.ValueOf(n.handler) != reflect.ValueOf(n2.handler) {
 		return "handler not match", false
 	}
@@ -170,3 +281,60 @@ func (n *node) equal(n2 *node) (string, bool) {
 	}
 	return "", true
 }
+
+func TestRouter_prepareChain(t *testing.T) {
+	var logs []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx *Context) {
+				logs = append(logs, name)
+				next(ctx)
+			}
+		}
+	}
+	h := NewHTTPServer()
+	h.Get("/users/:id", mockHandler)
+	h.Get("/users/:id/posts", mockHandler)
+	h.Get("/orders/:no<int>", mockHandler)
+	h.Get("/files/*", mockHandler)
+	h.Get("/accounts/:id([0-9]+)", mockHandler)
+	h.Get("/groups/:no<[0-9]+>", mockHandler)
+	// used after routes
+	h.Use(http.MethodGet, "/users", mark("users"))
+	h.Use(http.MethodGet, "/users/me", mark("me"))
+	h.Use(http.MethodGet, "/orders/:no<int>", mark("int"))
+	h.Use(http.MethodGet, "/orders/:id", mark("order"))
+	// never matches :no<int>
+	h.Use(http.MethodGet, "/orders/new", mark("new"))
+	h.Use(http.MethodGet, "/files/*/raw", mark("raw"))
+	// <expr> matches part of values of (expr)
+	h.Use(http.MethodGet, "/accounts/:x<[0-9]+>", mark("anchored"))
+	h.Use(http.MethodGet, "/groups/:x([0-9]+)", mark("contains"))
+
+	testCases := []struct {
+		name      string
+		path      string
+		wantChain bool
+		wantLogs  []string
+	}{
+		{name: "depends on path", path: "/users/me", wantLogs: []string{"users", "me"}},
+		{name: "depends on path other", path: "/users/12", wantLogs: []string{"users"}},
+		{name: "sub route", path: "/users/me/posts", wantLogs: []string{"users", "me"}},
+		{name: "precomputed", path: "/orders/12", wantChain: true, wantLogs: []string{"int", "order"}},
+		{name: "wildcard", path: "/files/a/raw", wantLogs: []string{"raw"}},
+		{name: "wildcard other", path: "/files/a", wantLogs: nil},
+		{name: "anchored", path: "/accounts/12", wantLogs: []string{"anchored"}},
+		{name: "anchored substring", path: "/accounts/a1", wantLogs: nil},
+		{name: "contains", path: "/groups/12", wantChain: true, wantLogs: []string{"contains"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs = nil
+			info, ok := h.route(http.MethodGet, tc.path)
+			assert.True(t, ok)
+			assert.Equal(t, tc.wantChain, info.node.chain != nil)
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantLogs, logs)
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Name    string `json:"name,omitempty"`
+	// Middlewares are names of middlewares applied in order,
+	// including server middlewares, middlewares used on the path and route middlewares
+	Middlewares []string `json:"middlewares"`
+	// ConditionalMiddlewares are names of middlewares used on more specific paths,
+	// such as /users/me for /users/:id, they apply only to requests matching those paths
+	ConditionalMiddlewares []string `json:"conditional_middlewares,omitempty"`
+}
+
+// RouteConflict describes a route which could never be matched,
+// or middlewares which never take effect
+type RouteConflict struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason"`
+}
+
+// Routes returns all registered routes sorted by pattern and method
+func (h *HTTPServer) Routes() []RouteInfo {
+	var res []RouteInfo
+	for method, root := range h.router.trees {
+		root.walk("", func(pattern string, n *node) {
+			if n.handler == nil {
+				return
+			}
+			info := RouteInfo{Method: method, Pattern: n.route, Name: n.name}
+			middlewares := slices.Concat(h.middlewares, h.router.patternMiddlewares(method, pattern), n.routeMiddlewares)
+			for _, middleware := range middlewares {
+				if middleware != nil {
+					info.Middlewares = append(info.Middlewares, funcName(middleware))
+				}
+			}
+			var segs []string
+			if pattern != "" {
+				segs = strings.Split(pattern[1:], "/")
+			}
+			wildcard := len(segs) > 0 && segs[len(segs)-1] == "*"
+			for _, middleware := range root.conditionalMiddlewares(segs, false, h.router.caseInsensitive, wildcard) {
+				if middleware != nil {
+					info.ConditionalMiddlewares = append(info.ConditionalMiddlewares, funcName(middleware))
+				}
+			}
+			res = append(res, info)
+		})
+	}
+	slices.SortFunc(res, func(a, b RouteInfo) int {
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+	return res
+}
+
+// RouteConflicts reports routes shadowed by siblings with the same constraint,
+// such as /users/:id([0-9]+) registered after /users/:no<[0-9]+>,
+// and middlewares used on paths without any route,
+// conflicts are logged when server starts
+func (h *HTTPServer) RouteConflicts() []RouteConflict {
+	var res []RouteConflict
+	for method, root := range h.router.trees {
+		root.walk("", func(pattern string, n *node) {
+			if len(n.middlewares) > 0 && !n.hasHandler() {
+				res = append(res, RouteConflict{
+					Method:  method,
+					Pattern: patternOrRoot(pattern),
+					Reason:  "middlewares apply to no route",
+				})
+			}
+			for i, child := range n.children {
+				for _, prev := range n.children[:i] {
+					if prev.nodeType == nodeTypeRegular && child.nodeType == nodeTypeRegular &&
+						prev.constraint.covers(child.constraint) {
+						res = append(res, shadowedRoutes(method, prev, child)...)
+					}
+				}
+			}
+		})
+	}
+	slices.SortFunc(res, func(a, b RouteConflict) int {
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Method, b.Method)
+	})
+	return res
+}
+
+// RoutesHandler returns handler rendering Routes and RouteConflicts as JSON,
+// or as HTML if client prefers text/html, mount it with protection middlewares:
+//
+//	server.Get("/debug/routes", server.RoutesHandler())
+func (h *HTTPServer) RoutesHandler() Handler {
+	return func(ctx *Context) {
+		report := routesReport{Routes: h.Routes(), Conflicts: h.RouteConflicts()}
+		if prefersHTML(ctx.Req.Header.Get("Accept")) {
+			var builder strings.Builder
+			if err := routesTemplate.Execute(&builder, report); err != nil {
+				ctx.RespCode = http.StatusInternalServerError
+				ctx.RespData = []byte(err.Error())
+				return
+			}
+			ctx.Resp.Header().Set("Content-Type", TemplateEncoder{}.ContentType())
+			ctx.RespCode = http.StatusOK
+			ctx.RespData = []byte(builder.String())
+			return
+		}
+		if err := ctx.RespJSONOK(report); err != nil {
+			h.logger("web: failed to encode routes %v", err)
+		}
+	}
+}
+
+type routesReport struct {
+	Routes    []RouteInfo     `json:"routes"`
+	Conflicts []RouteConflict `json:"conflicts"`
+}
+
+var _ json.Marshaler = routesReport{}
+
+// MarshalJSON keeps empty lists as [] rather than null
+func (r routesReport) MarshalJSON() ([]byte, error) {
+	type report routesReport
+	if r.Routes == nil {
+		r.Routes = []RouteInfo{}
+	}
+	if r.Conflicts == nil {
+		r.Conflicts = []RouteConflict{}
+	}
+	return json.Marshal(report(r))
+}
+
+var routesTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Routes</title></head>
+<body>
+<h1>Routes</h1>
+<table border="1">
+<tr><th>Method</th><th>Pattern</th><th>Name</th><th>Middlewares</th><th>Conditional Middlewares</th></tr>
+{{range .Routes}}<tr><td>{{.Method}}</td><td>{{.Pattern}}</td><td>{{.Name}}</td><td>{{range $i, $m := .Middlewares}}{{if $i}}<br>{{end}}{{$m}}{{end}}</td><td>{{range $i, $m := .ConditionalMiddlewares}}{{if $i}}<br>{{end}}{{$m}}{{end}}</td></tr>
+{{end}}</table>
+{{if .Conflicts}}<h1>Conflicts</h1>
+<table border="1">
+<tr><th>Method</th><th>Pattern</th><th>Reason</th></tr>
+{{range .Conflicts}}<tr><td>{{.Method}}</td><td>{{.Pattern}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// prefersHTML reports whether text/html is the most preferred acceptable media type
+func prefersHTML(accept string) bool {
+	ranges := parseAccept(accept)
+	for _, accepted := range ranges {
+		if accepted.quality == 0 || accepted.specificity() == 0 {
+			return false
+		}
+		if accepted.match("text/html") {
+			return !rejected(ranges, "text/html", accepted.specificity())
+		}
+		if accepted.match("application/json") {
+			return false
+		}
+	}
+	return false
+}
+
+// logRouteConflicts is called before serving
+func (h *HTTPServer) logRouteConflicts() {
+	for _, conflict := range h.RouteConflicts() {
+		h.logger("web: route conflict %s %s: %s", conflict.Method, conflict.Pattern, conflict.Reason)
+	}
+}
+
+// patternMiddlewares collects middlewares used on nodes covering every request of pattern
+func (r *router) patternMiddlewares(method string, pattern string) []Middleware {
+	root := r.trees[method]
+	if pattern == "" {
+		return root.middlewares
+	}
+	return collectMiddlewares(root, strings.Split(pattern[1:], "/"), func(n *node, seg string) bool {
+		typ, path, constraint := parseSegment(seg)
+		switch n.nodeType {
+		case nodeTypeStatic:
+			return typ == nodeTypeStatic && n.path == path
+		case nodeTypeRegular:
+			if typ == nodeTypeStatic {
+				_, ok := n.constraint.match(path)
+				return ok
+			}
+			return typ == nodeTypeRegular && n.constraint.covers(constraint)
+		}
+		return true
+	})
+}
+
+// conditionalMiddlewares collects middlewares used on nodes matching part of requests of segs,
+// it visits the same nodes as partialMiddlewares
+func (n *node) conditionalMiddlewares(segs []string, partial bool, fold bool, wildcard bool) []Middleware {
+	var res []Middleware
+	if partial {
+		res = append(res, n.middlewares...)
+	}
+	if len(segs) == 0 {
+		if wildcard {
+			// requests of wildcard could be longer than pattern
+			for _, child := range n.children {
+				child.walk("", func(_ string, sub *node) {
+					res = append(res, sub.middlewares...)
+				})
+			}
+		}
+		return res
+	}
+	typ, path, constraint := parseSegment(segs[0])
+	for _, child := range n.children {
+		covered, overlapped := child.covers(typ, path, constraint, fold)
+		if overlapped {
+			res = append(res, child.conditionalMiddlewares(segs[1:], partial || !covered, fold, wildcard)...)
+		}
+	}
+	return res
+}
+
+// walk visits n and its sub nodes in depth-first order,
+// pattern of root is empty
+func (n *node) walk(pattern string, visit func(pattern string, n *node)) {
+	visit(pattern, n)
+	for _, child := range n.children {
+		child.walk(pattern+"/"+child.segment(), visit)
+	}
+}
+
+// segment returns the segment registered for n
+func (n *node) segment() string {
+	if n.constraint != nil {
+		return n.path + n.constraint.expr
+	}
+	return n.path
+}
+
+func (n *node) hasHandler() bool {
+	if n.handler != nil {
+		return true
+	}
+	for _, child := range n.children {
+		if child.hasHandler() {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether c matches every value matched by o, (expr) contains matches of <expr>
+// of the same regular expression but not the other way around
+func (c *paramConstraint) covers(o *paramConstraint) bool {
+	if c.expr == o.expr {
+		return true
+	}
+	expr := o.expr[1 : len(o.expr)-1]
+	if _, ok := paramTypes[expr]; ok || c.expr[0] != '(' || o.expr[0] != '<' {
+		return false
+	}
+	return c.expr[1:len(c.expr)-1] == expr
+}
+
+// shadowedRoutes reports routes of node which are always matched by prev first
+func shadowedRoutes(method string, prev *node, n *node) []RouteConflict {
+	var res []RouteConflict
+	if prev.handler != nil && n.handler != nil {
+		res = append(res, RouteConflict{
+			Method:  method,
+			Pattern: n.route,
+			Reason:  fmt.Sprintf("shadowed by %s", prev.route),
+		})
+	}
+	for _, child := range n.children {
+		for _, prevChild := range prev.children {
+			if coversSegment(prevChild, child) {
+				res = append(res, shadowedRoutes(method, prevChild, child)...)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// coversSegment reports whether a matches every segment matched by b
+func coversSegment(a *node, b *node) bool {
+	if a.nodeType != b.nodeType {
+		return false
+	}
+	switch a.nodeType {
+	case nodeTypeStatic:
+		return a.path == b.path
+	case nodeTypeRegular:
+		return a.constraint.covers(b.constraint)
+	}
+	return true
+}
+
+func patternOrRoot(pattern string) string {
+	if pattern == "" {
+		return "/"
+	}
+	return pattern
+}
+
+// funcName returns function name without package path, such as accesslog.MiddlewareBuilder.Build.func1
+func funcName(fn any) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serverMiddleware(next Handler) Handler { return next }
+
+func apiMiddleware(next Handler) Handler { return next }
+
+func userMiddleware(next Handler) Handler { return next }
+
+func routeMiddleware(next Handler) Handler { return next }
+
+func TestHTTPServer_Routes(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddlewares(serverMiddleware))
+	h.Use(http.MethodGet, "/api", apiMiddleware)
+	h.Use(http.MethodGet, "/api/users/:id<int>", userMiddleware)
+	h.Get("/", mockHandler)
+	api := h.Group("/api")
+	api.Get("/users/:id<int>", mockHandler).Name("user.detail")
+	api.Get("/users/:name", mockHandler)
+	api.Post("/users", mockHandler)
+	h.Group("/admin", routeMiddleware).Delete("/users/*", mockHandler)
+
+	assert.Equal(t, []RouteInfo{
+		{Method: http.MethodGet, Pattern: "/", Middlewares: []string{"web.serverMiddleware"}},
+		{Method: http.MethodDelete, Pattern: "/admin/users/*",
+			Middlewares: []string{"web.serverMiddleware", "web.routeMiddleware"}},
+		{Method: http.MethodPost, Pattern: "/api/users", Middlewares: []string{"web.serverMiddleware"}},
+		{Method: http.MethodGet, Pattern: "/api/users/:id<int>", Name: "user.detail",
+			Middlewares: []string{"web.serverMiddleware", "web.apiMiddleware", "web.userMiddleware"}},
+		{Method: http.MethodGet, Pattern: "/api/users/:name",
+			Middlewares:            []string{"web.serverMiddleware", "web.apiMiddleware"},
+			ConditionalMiddlewares: []string{"web.userMiddleware"}},
+	}, h.Routes())
+	assert.Empty(t, h.RouteConflicts())
+}
+
+func TestHTTPServer_RouteConflicts(t *testing.T) {
+	var logs []string
+	h := NewHTTPServer(ServerWithLogger(func(msg string, args ...any) {
+		logs = append(logs, msg)
+	}))
+	h.Get("/users/:no<[0-9]+>", mockHandler)
+	h.Get("/users/:id([0-9]+)", mockHandler)
+	h.Get("/users/:no<[0-9]+>/posts", mockHandler)
+	h.Get("/users/:id([0-9]+)/posts", mockHandler)
+	h.Get("/users/:id([0-9]+)/likes", mockHandler)
+	h.Get("/users/:id<int>", mockHandler)
+	// (expr) contains matches of <expr>
+	h.Get("/items/:id([0-9]+)", mockHandler)
+	h.Get("/items/:no<[0-9]+>", mockHandler)
+	h.Get("/items/:id([0-9]+)/posts", mockHandler)
+	h.Get("/items/:no<[0-9]+>/posts", mockHandler)
+	h.Use(http.MethodPost, "/orders", apiMiddleware)
+
+	assert.Equal(t, []RouteConflict{
+		{Method: http.MethodGet, Pattern: "/items/:no<[0-9]+>", Reason: "shadowed by /items/:id([0-9]+)"},
+		{Method: http.MethodGet, Pattern: "/items/:no<[0-9]+>/posts", Reason: "shadowed by /items/:id([0-9]+)/posts"},
+		{Method: http.MethodPost, Pattern: "/orders", Reason: "middlewares apply to no route"},
+	}, h.RouteConflicts())
+
+	// /likes is reachable by backtracking
+	info, ok := h.route(http.MethodGet, "/users/12/likes")
+	require.True(t, ok)
+	assert.Equal(t, "/users/:id([0-9]+)/likes", info.node.route)
+	// values containing digits only reach (expr)
+	info, ok = h.route(http.MethodGet, "/users/a1")
+	require.True(t, ok)
+	assert.Equal(t, "/users/:id([0-9]+)", info.node.route)
+
+	h.logRouteConflicts()
+	assert.Len(t, logs, 3)
+}
+
+func TestHTTPServer_RoutesHandler(t *testing.T) {
+	h := NewHTTPServer()
+	h.Get("/users/:id", mockHandler).Name("user.detail")
+	h.Get("/debug/routes", h.RoutesHandler())
+
+	testCases := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantBody        []string
+	}{
+		{name: "default json", wantContentType: "application/json",
+			wantBody: []string{`"pattern":"/users/:id"`, `"name":"user.detail"`, `"conflicts":[]`}},
+		{name: "any", accept: "*/*", wantContentType: "application/json"},
+		{name: "json preferred", accept: "application/json, text/html;q=0.9", wantContentType: "application/json"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8", wantContentType: "text/html; charset=utf-8",
+			wantBody: []string{"<td>/users/:id</td>", "<td>user.detail</td>"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), tc.wantContentType))
+			for _, want := range tc.wantBody {
+				assert.Contains(t, recorder.Body.String(), want)
+			}
+			if tc.wantContentType == "application/json" {
+				var report routesReport
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+				assert.Len(t, report.Routes, 2)
+			}
+		})
+	}
+}
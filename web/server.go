@@ -1,18 +1,29 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Handler func(ctx *Context)
 
+// Hook is called when server starts or stops
+type Hook func(ctx context.Context) error
+
 type Server interface {
 	http.Handler
 	Start(addr string) error
+	// Shutdown stops accepting connections and waits for active requests
+	Shutdown(ctx context.Context) error
 
-	addRoute(method string, path string, handler Handler, middlewares ...Middleware)
+	addRoute(method string, path string, handler Handler, middlewares ...Middleware) *Route
 }
 
 type HTTPServerOption func(server *HTTPServer)
@@ -24,18 +35,43 @@ type HTTPServer struct {
 	middlewares    []Middleware
 	logger         func(msg string, args ...any)
 	templateEngine TemplateEngine
+	encoders       []Encoder
+	trailingSlash  TrailingSlash
+	cleanPath      bool
+
+	// root is serve wrapped with server middlewares, built once after options
+	root Handler
+	pool sync.Pool
+
+	srv     *http.Server
+	onStart []Hook
+	onStop  []Hook
+
+	// webSockets are hijacked connections, they are closed by Shutdown
+	webSockets      map[*WebSocketConn]struct{}
+	webSocketsMutex sync.Mutex
 }
 
 func NewHTTPServer(opts ...HTTPServerOption) *HTTPServer {
 	res := &HTTPServer{
 		router: newRouter(),
+		// do not exit, a failed write only affects one request
 		logger: func(msg string, args ...any) {
-			log.Fatalf(msg, args)
+			log.Printf(msg, args...)
 		},
+		srv:        &http.Server{},
+		encoders:   defaultEncoders,
+		webSockets: make(map[*WebSocketConn]struct{}),
+	}
+	res.srv.Handler = res
+	res.srv.RegisterOnShutdown(res.closeWebSockets)
+	res.pool.New = func() any {
+		return &Context{}
 	}
 	for _, opt := range opts {
 		opt(res)
 	}
+	res.root = chain(res.serve, res.middlewares)
 	return res
 }
 
@@ -51,9 +87,57 @@ func ServerWithLogger(logger func(msg string, args ...any)) HTTPServerOption {
 	}
 }
 
+// ServerWithTemplateEngine sets engine of Context.Render,
+// urlFor of FSTemplateEngine generates urls of routes of the server
 func ServerWithTemplateEngine(templateEngine TemplateEngine) HTTPServerOption {
 	return func(server *HTTPServer) {
 		server.templateEngine = templateEngine
+		if engine, ok := templateEngine.(interface{ bind(server *HTTPServer) }); ok {
+			engine.bind(server)
+		}
+	}
+}
+
+// ServerWithReadTimeout sets the maximum duration for reading the entire request
+func ServerWithReadTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.srv.ReadTimeout = timeout
+	}
+}
+
+// ServerWithReadHeaderTimeout sets the maximum duration for reading request headers
+func ServerWithReadHeaderTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.srv.ReadHeaderTimeout = timeout
+	}
+}
+
+// ServerWithWriteTimeout sets the maximum duration before timing out writes of the response
+func ServerWithWriteTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.srv.WriteTimeout = timeout
+	}
+}
+
+// ServerWithIdleTimeout sets the maximum duration to wait for the next request when keep-alive
+func ServerWithIdleTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.srv.IdleTimeout = timeout
+	}
+}
+
+// ServerWithOnStart adds hooks called in order after listening and before serving,
+// server will not start if any hook returns error
+func ServerWithOnStart(hooks ...Hook) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.onStart = append(server.onStart, hooks...)
+	}
+}
+
+// ServerWithOnStop adds hooks called in order after active requests finished in Shutdown
+func ServerWithOnStop(hooks ...Hook) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.onStop = append(server.onStop, hooks...)
 	}
 }
 
@@ -61,39 +145,85 @@ func (h *HTTPServer) Use(method string, path string, middlewares ...Middleware)
 	h.router.addRoute(method, path, nil, middlewares...)
 }
 
-func (h *HTTPServer) Get(path string, handler Handler) {
-	h.router.addRoute(http.MethodGet, path, handler)
+func (h *HTTPServer) Get(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodGet, path, handler)
+}
+
+func (h *HTTPServer) Post(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodPost, path, handler)
+}
+
+func (h *HTTPServer) Put(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodPut, path, handler)
+}
+
+func (h *HTTPServer) Patch(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodPatch, path, handler)
 }
 
-func (h *HTTPServer) Post(path string, handler Handler) {
-	h.router.addRoute(http.MethodPost, path, handler)
+func (h *HTTPServer) Delete(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodDelete, path, handler)
+}
+
+// Head registers handler for HEAD explicitly,
+// otherwise HEAD requests are served by GET handler with body dropped
+func (h *HTTPServer) Head(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodHead, path, handler)
+}
+
+// Options registers handler for OPTIONS explicitly,
+// otherwise OPTIONS requests are answered with Allow header automatically
+func (h *HTTPServer) Options(path string, handler Handler) *Route {
+	return h.router.addRoute(http.MethodOptions, path, handler)
+}
+
+// Any registers handler for all methods in anyMethods
+func (h *HTTPServer) Any(path string, handler Handler) *Route {
+	res := &Route{router: &h.router, pattern: path}
+	for _, method := range anyMethods {
+		res.nodes = append(res.nodes, h.router.addRoute(method, path, handler).nodes...)
+	}
+	return res
 }
 
 // ServeHTTP deal request
 func (h *HTTPServer) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
-	ctx := &Context{
-		Req:            req,
-		Resp:           resp,
-		templateEngine: h.templateEngine,
-	}
-	root := h.serve
-	for i := len(h.middlewares) - 1; i >= 0; i-- {
-		root = h.middlewares[i](root)
-	}
-	m := func(next Handler) Handler {
-		return func(ctx *Context) {
-			next(ctx)
-			h.flushResp(ctx)
-		}
+	ctx := h.pool.Get().(*Context)
+	ctx.reset(resp, req)
+	ctx.templateEngine = h.templateEngine
+	ctx.encoders = h.encoders
+	// match in advance so that server middlewares could know the route
+	h.match(ctx, req.Method, req.URL.Path)
+	if ctx.matched.node != nil {
+		ctx.MatchedRoute = ctx.matched.node.route
 	}
-	root = m(root)
-	root(ctx)
+	h.root(ctx)
+	h.flushResp(ctx)
+	// ctx is not put back if handler panics, it may be still referenced
+	h.pool.Put(ctx)
 }
 
 func (h *HTTPServer) flushResp(ctx *Context) {
+	if ctx.committed {
+		// response has been written by streaming
+		return
+	}
+	if bodyAllowed(ctx.RespCode) {
+		// value is set in place if writer keeps header, strconv does not allocate lengths under 100
+		length := strconv.Itoa(len(ctx.RespData))
+		if values := ctx.Resp.Header()["Content-Length"]; len(values) == 1 {
+			values[0] = length
+		} else {
+			ctx.Resp.Header()["Content-Length"] = []string{length}
+		}
+	}
 	if ctx.RespCode != 0 {
 		ctx.Resp.WriteHeader(ctx.RespCode)
 	}
+	if ctx.Req.Method == http.MethodHead {
+		// HEAD response keeps headers of GET only
+		return
+	}
 	n, err := ctx.Resp.Write(ctx.RespData)
 	if err != nil || n != len(ctx.RespData) {
 		h.logger("web: failed to write response body %v", err)
@@ -101,33 +231,145 @@ func (h *HTTPServer) flushResp(ctx *Context) {
 }
 
 func (h *HTTPServer) serve(ctx *Context) {
-	info, ok := h.router.route(ctx.Req.Method, ctx.Req.URL.Path)
+	// decided again after path normalization
+	ctx.MatchedRoute = ""
+	path, ok := h.normalizePath(ctx)
 	if !ok {
-		ctx.RespCode = http.StatusNotFound
-		ctx.RespData = []byte("404 page not found")
 		return
 	}
-	ctx.pathParams = info.pathParams
-	ctx.MatchedRoute = info.node.route
-
-	middlewares := info.middlewares
-	root := info.node.handler
-	if middlewares != nil {
-		for i := len(middlewares) - 1; i >= 0; i-- {
-			if middlewares[i] == nil {
-				continue
-			}
-			root = middlewares[i](root)
+	if ctx.matched.method != ctx.Req.Method || ctx.matched.path != path {
+		// request is rewritten by server middlewares
+		h.match(ctx, ctx.Req.Method, path)
+	}
+	n := ctx.matched.node
+	if n == nil {
+		allowed := h.router.allowedMethods(path)
+		if len(allowed) == 0 {
+			ctx.SetError(ErrNotFound)
+			ctx.RespData = []byte("404 page not found")
+			return
+		}
+		ctx.Resp.Header().Set("Allow", strings.Join(allowed, ", "))
+		if ctx.Req.Method == http.MethodOptions {
+			h.serveOptions(ctx, path, allowed)
+			return
+		}
+		ctx.SetError(ErrMethodNotAllowed)
+		ctx.RespData = []byte("405 method not allowed")
+		return
+	}
+	ctx.MatchedRoute = n.route
+	if n.chain != nil {
+		n.chain(ctx)
+		return
+	}
+	// middlewares depend on request path
+	middlewares := findMiddlewares(ctx.matched.tree, pathSegments(path), h.router.caseInsensitive)
+	chain(n.handler, append(middlewares, n.routeMiddlewares...))(ctx)
+}
+
+// routeMatch is the result of routing request,
+// it is reused by serve unless method or path is rewritten by server middlewares
+type routeMatch struct {
+	method string
+	path   string
+	// tree is the root of method serving request
+	tree *node
+	node *node
+}
+
+// match routes path into ctx.matched and ctx.params, HEAD requests are served by GET routes if absent
+func (h *HTTPServer) match(ctx *Context, method string, path string) {
+	ctx.params = ctx.params[:0]
+	ctx.matched = routeMatch{method: method, path: path}
+	if h.lookup(ctx, method, path) || method != http.MethodHead {
+		return
+	}
+	h.lookup(ctx, http.MethodGet, path)
+}
+
+func (h *HTTPServer) lookup(ctx *Context, method string, path string) bool {
+	root, ok := h.router.trees[method]
+	if !ok {
+		return false
+	}
+	n := h.router.find(root, path, &ctx.params)
+	if n == nil {
+		return false
+	}
+	ctx.matched.tree, ctx.matched.node = root, n
+	return true
+}
+
+// serveOptions answers OPTIONS automatically through middlewares of the route,
+// which is chosen by Access-Control-Request-Method or allowed methods,
+// so that middlewares such as cors could handle preflight requests
+func (h *HTTPServer) serveOptions(ctx *Context, path string, allowed []string) {
+	var root Handler = func(ctx *Context) {
+		ctx.RespCode = http.StatusNoContent
+	}
+	methods := append([]string{ctx.Req.Header.Get("Access-Control-Request-Method")}, allowed...)
+	for _, method := range methods {
+		if info, ok := h.router.route(method, path); ok {
+			root = chain(root, info.middlewares)
+			break
 		}
 	}
 	root(ctx)
-	return
+}
+
+func chain(root Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] == nil {
+			continue
+		}
+		root = middlewares[i](root)
+	}
+	return root
+}
+
+// bodyAllowed reports whether a response with status could have a body
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status < 200:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
 }
 
 func (h *HTTPServer) Start(addr string) error {
-	listenr, err := net.Listen("tcp", addr)
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
-	return http.Serve(listenr, h)
+	return h.Serve(listener)
+}
+
+// Serve accepts connections on listener and blocks until Shutdown is called,
+// route conflicts are logged before serving, it returns nil after a graceful shutdown
+func (h *HTTPServer) Serve(listener net.Listener) error {
+	h.logRouteConflicts()
+	for _, hook := range h.onStart {
+		if err := hook(context.Background()); err != nil {
+			_ = listener.Close()
+			return err
+		}
+	}
+	err := h.srv.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for active requests until ctx done,
+// then calls stop hooks, errors of all hooks are joined
+func (h *HTTPServer) Shutdown(ctx context.Context) error {
+	errs := []error{h.srv.Shutdown(ctx)}
+	for _, hook := range h.onStop {
+		errs = append(errs, hook(ctx))
+	}
+	return errors.Join(errs...)
 }
@@ -1,14 +1,21 @@
 package web
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestHTTPServer(t *testing.T) {
-	h := NewHTTPServer()
-	h.middlewares = []Middleware{
+	h := NewHTTPServer(ServerWithMiddlewares(
 		func(next Handler) Handler {
 			return func(ctx *Context) {
 				fmt.Println("hello 1 before")
@@ -33,10 +40,266 @@ func TestHTTPServer(t *testing.T) {
 				fmt.Println("can not reach 4")
 			}
 		},
-	}
-	h.ServeHTTP(nil, &http.Request{})
+	))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
 	//h.Get("/user/login", func(ctx *Context) {
 	//	ctx.Resp.Write([]byte("<h1>Hello World</h1>"))
 	//})
 	//h.Start(":8081")
 }
+
+func TestHTTPServer_Methods(t *testing.T) {
+	h := NewHTTPServer()
+	respond := func(data string) Handler {
+		return func(ctx *Context) {
+			ctx.RespCode = http.StatusOK
+			ctx.RespData = []byte(data)
+		}
+	}
+	h.Get("/user", respond("get user"))
+	h.Post("/user", respond("post user"))
+	h.Put("/user/:id", respond("put user"))
+	h.Patch("/user/:id", respond("patch user"))
+	h.Delete("/user/:id", respond("delete user"))
+	h.Head("/order", respond("head order"))
+	h.Options("/order", respond("options order"))
+	h.Any("/any", respond("any"))
+
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{"get", http.MethodGet, "/user", http.StatusOK, "get user", ""},
+		{"post", http.MethodPost, "/user", http.StatusOK, "post user", ""},
+		{"put", http.MethodPut, "/user/1", http.StatusOK, "put user", ""},
+		{"patch", http.MethodPatch, "/user/1", http.StatusOK, "patch user", ""},
+		{"delete", http.MethodDelete, "/user/1", http.StatusOK, "delete user", ""},
+		{"head by get", http.MethodHead, "/user", http.StatusOK, "", ""},
+		{"explicit options", http.MethodOptions, "/order", http.StatusOK, "options order", ""},
+		{"any", http.MethodTrace, "/any", http.StatusOK, "any", ""},
+		{"auto options", http.MethodOptions, "/user", http.StatusNoContent, "", "GET, HEAD, OPTIONS, POST"},
+		{"not allowed", http.MethodGet, "/user/1", http.StatusMethodNotAllowed, "405 method not allowed", "DELETE, OPTIONS, PATCH, PUT"},
+		{"not allowed without get", http.MethodGet, "/order", http.StatusMethodNotAllowed, "405 method not allowed", "HEAD, OPTIONS"},
+		{"not found", http.MethodGet, "/none", http.StatusNotFound, "404 page not found", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantAllow, recorder.Header().Get("Allow"))
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "/user", nil))
+	assert.Equal(t, "8", recorder.Header().Get("Content-Length"))
+}
+
+func TestHTTPServer_Shutdown(t *testing.T) {
+	var hooks []string
+	h := NewHTTPServer(
+		ServerWithReadHeaderTimeout(time.Second),
+		ServerWithIdleTimeout(time.Second),
+		ServerWithOnStart(func(ctx context.Context) error {
+			hooks = append(hooks, "start")
+			return nil
+		}),
+		ServerWithOnStop(func(ctx context.Context) error {
+			hooks = append(hooks, "stop")
+			return nil
+		}),
+	)
+	started := make(chan struct{})
+	h.Get("/slow", func(ctx *Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		ctx.RespData = []byte("done")
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- h.Serve(listener)
+	}()
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		respCh <- string(data)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, h.Shutdown(ctx))
+	// in-flight request is drained before Shutdown returns
+	assert.Equal(t, "done", <-respCh)
+	assert.NoError(t, <-serveErr)
+	assert.Equal(t, []string{"start", "stop"}, hooks)
+}
+
+func TestHTTPServer_StartHookError(t *testing.T) {
+	h := NewHTTPServer(ServerWithOnStart(func(ctx context.Context) error {
+		return fmt.Errorf("hook failed")
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.EqualError(t, h.Serve(listener), "hook failed")
+}
+
+func TestHTTPServer_MatchedRouteBeforeMiddlewares(t *testing.T) {
+	var routes []string
+	h := NewHTTPServer(ServerWithMiddlewares(func(next Handler) Handler {
+		return func(ctx *Context) {
+			routes = append(routes, ctx.MatchedRoute)
+			next(ctx)
+			routes = append(routes, ctx.MatchedRoute)
+		}
+	}), ServerWithTrailingSlash(TrailingSlashStrict))
+	h.Get("/users/:id", func(ctx *Context) {})
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantRoutes []string
+	}{
+		{name: "matched", path: "/users/1", wantRoutes: []string{"/users/:id", "/users/:id"}},
+		{name: "not found", path: "/orders", wantRoutes: []string{"", ""}},
+		{name: "rejected by policy", path: "/users/1/", wantRoutes: []string{"/users/:id", ""}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			routes = nil
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantRoutes, routes)
+		})
+	}
+}
+
+func TestHTTPServer_ContextPool(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddlewares(func(next Handler) Handler {
+		return func(ctx *Context) {
+			if ctx.Req.URL.Path == "/old/1" {
+				// rewritten path is routed again
+				ctx.Req.URL.Path = "/users/2"
+			}
+			next(ctx)
+		}
+	}))
+	h.Get("/users/:id", func(ctx *Context) {
+		id, err := ctx.PathValue("id").String()
+		require.NoError(t, err)
+		_, ok := ctx.TypedPathValue("name")
+		ctx.RespCode = http.StatusOK
+		ctx.RespData = []byte(fmt.Sprintf("%s %s %v", ctx.MatchedRoute, id, ok))
+	})
+	h.Get("/names/:name", func(ctx *Context) {
+		ctx.RespCode = http.StatusOK
+		ctx.RespData = []byte(ctx.MatchedRoute)
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "param", path: "/names/tom", wantCode: http.StatusOK, wantBody: "/names/:name"},
+		{name: "params reset", path: "/users/1", wantCode: http.StatusOK, wantBody: "/users/:id 1 false"},
+		{name: "rewritten", path: "/old/1", wantCode: http.StatusOK, wantBody: "/users/:id 2 false"},
+		{name: "not found", path: "/orders", wantCode: http.StatusNotFound, wantBody: "404 page not found"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHTTPServer_ServeHTTPAllocs(t *testing.T) {
+	h := NewHTTPServer(ServerWithMiddlewares(func(next Handler) Handler {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	}))
+	h.Use(http.MethodGet, "/api", func(next Handler) Handler {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	})
+	h.Get("/api/users/profile", func(ctx *Context) {
+		ctx.RespCode = http.StatusNoContent
+	})
+	h.Get("/api/users/:id", func(ctx *Context) {
+		ctx.RespCode = http.StatusNoContent
+	})
+	name := []byte("tom")
+	h.Get("/api/users/:id/name", func(ctx *Context) {
+		ctx.RespCode = http.StatusOK
+		ctx.RespData = name
+	})
+	bio := bytes.Repeat([]byte("a"), 1024)
+	h.Get("/api/users/:id/bio", func(ctx *Context) {
+		ctx.RespCode = http.StatusOK
+		ctx.RespData = bio
+	})
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantCode   int
+		wantLength string
+		wantAllocs float64
+	}{
+		{name: "static", path: "/api/users/profile", wantCode: http.StatusNoContent},
+		{name: "param", path: "/api/users/12", wantCode: http.StatusNoContent},
+		{name: "body", path: "/api/users/12/name", wantCode: http.StatusOK, wantLength: "3"},
+		// only Content-Length of 100 bytes or more is allocated
+		{name: "large body", path: "/api/users/12/bio", wantCode: http.StatusOK, wantLength: "1024", wantAllocs: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			resp := &discardWriter{header: http.Header{}}
+			allocs := testing.AllocsPerRun(100, func() {
+				h.ServeHTTP(resp, req)
+			})
+			assert.Equal(t, tc.wantCode, resp.code)
+			assert.Equal(t, tc.wantLength, resp.header.Get("Content-Length"))
+			assert.Equal(t, tc.wantAllocs, allocs)
+		})
+	}
+}
+
+// discardWriter keeps header across requests so that it allocates nothing
+type discardWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *discardWriter) WriteHeader(code int) {
+	w.code = code
+}
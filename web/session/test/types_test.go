@@ -8,9 +8,11 @@ import (
 	"github.com/CoucouMonEcho/go-framework/web/session"
 	"github.com/CoucouMonEcho/go-framework/web/session/cookie"
 	"github.com/CoucouMonEcho/go-framework/web/session/memory"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -94,6 +96,33 @@ func TestHttpServer(t *testing.T) {
 		ctx.RespData = []byte(val.(string))
 		return
 	})
-	err := server.Start(":8081")
-	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "john", recorder.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/user", nil)
+	req.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
 }
@@ -0,0 +1,122 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidSSEField = errors.New("web: sse id or event can not contain line break")
+
+// SSEEvent is a message of Server-Sent Events
+type SSEEvent struct {
+	ID    string
+	Event string
+	// Data contains multiple lines will be sent as multiple data fields
+	Data string
+	// Retry tells client the reconnection time, zero means not set
+	Retry time.Duration
+}
+
+// SSEStream writes Server-Sent Events to client,
+// it is not safe for concurrent use as http.ResponseWriter
+type SSEStream struct {
+	ctx *Context
+}
+
+// SSE commits headers of event stream and returns SSEStream,
+// it fails if response has been committed
+func (ctx *Context) SSE() (*SSEStream, error) {
+	if ctx.committed {
+		return nil, errors.New("web: response already committed")
+	}
+	header := ctx.Resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disable proxy buffering such as nginx
+	header.Set("X-Accel-Buffering", "no")
+	ctx.WriteHeader(http.StatusOK)
+	ctx.Flush()
+	return &SSEStream{ctx: ctx}, nil
+}
+
+// Done is closed when client disconnected or request canceled
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.ctx.Req.Context().Done()
+}
+
+// Send writes event and flushes it to client
+func (s *SSEStream) Send(evt SSEEvent) error {
+	if strings.ContainsAny(evt.ID, "\r\n") || strings.ContainsAny(evt.Event, "\r\n") {
+		return errInvalidSSEField
+	}
+	buffer := &bytes.Buffer{}
+	if evt.ID != "" {
+		buffer.WriteString("id: " + evt.ID + "\n")
+	}
+	if evt.Event != "" {
+		buffer.WriteString("event: " + evt.Event + "\n")
+	}
+	if evt.Retry > 0 {
+		buffer.WriteString("retry: " + strconv.FormatInt(evt.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(evt.Data, "\r\n", "\n"), "\n") {
+		buffer.WriteString("data: " + line + "\n")
+	}
+	buffer.WriteString("\n")
+	return s.write(buffer.Bytes())
+}
+
+// Comment writes a comment line, which is ignored by client and used to keep alive
+func (s *SSEStream) Comment(text string) error {
+	buffer := &bytes.Buffer{}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		buffer.WriteString(": " + line + "\n")
+	}
+	buffer.WriteString("\n")
+	return s.write(buffer.Bytes())
+}
+
+// Serve sends events until events closed or client disconnected,
+// a comment is sent as heartbeat every heartbeat duration, zero disables it
+func (s *SSEStream) Serve(events <-chan SSEEvent, heartbeat time.Duration) error {
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-s.Done():
+			return s.ctx.Req.Context().Err()
+		case evt, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(evt); err != nil {
+				return err
+			}
+		case <-tick:
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *SSEStream) write(data []byte) error {
+	// client disconnected
+	if err := s.ctx.Req.Context().Err(); err != nil {
+		return err
+	}
+	if _, err := s.ctx.Write(data); err != nil {
+		return err
+	}
+	s.ctx.Flush()
+	return nil
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSEStream_Send(t *testing.T) {
+	testCases := []struct {
+		name    string
+		evt     SSEEvent
+		wantErr error
+		want    string
+	}{
+		{"data only", SSEEvent{Data: "hello"}, nil, "data: hello\n\n"},
+		{"all fields", SSEEvent{ID: "1", Event: "update", Data: "a\nb", Retry: 3 * time.Second}, nil, "id: 1\nevent: update\nretry: 3000\ndata: a\ndata: b\n\n"},
+		{"invalid id", SSEEvent{ID: "1\n2", Data: "hello"}, errInvalidSSEField, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/events", nil), Resp: recorder}
+			stream, err := ctx.SSE()
+			require.NoError(t, err)
+			err = stream.Send(tc.evt)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, recorder.Body.String())
+			assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+			assert.True(t, recorder.Flushed)
+		})
+	}
+}
+
+func TestSSEStream_Serve(t *testing.T) {
+	h := NewHTTPServer()
+	events := make(chan SSEEvent, 2)
+	h.Get("/events", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		require.NoError(t, err)
+		_ = stream.Serve(events, 0)
+	})
+	events <- SSEEvent{ID: "1", Data: "first"}
+	events <- SSEEvent{ID: "2", Data: "second"}
+	close(events)
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "id: 1\ndata: first\n\nid: 2\ndata: second\n\n", recorder.Body.String())
+
+	// client disconnected
+	reqCtx, cancel := context.WithCancel(context.Background())
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(reqCtx), Resp: httptest.NewRecorder()}
+	stream, err := ctx.SSE()
+	require.NoError(t, err)
+	cancel()
+	assert.Equal(t, context.Canceled, stream.Serve(make(chan SSEEvent), time.Millisecond))
+	assert.Equal(t, context.Canceled, stream.Send(SSEEvent{Data: "lost"}))
+}
@@ -0,0 +1,383 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StaticResourceHandler serves files of fs.FS, such as os.DirFS and embed.FS,
+// register it on a wildcard route or a route with "file" path param:
+//
+//	h.Get("/static/*", sh.Handle)
+//	h.Get("/static/:file", sh.Handle)
+//
+// conditional requests and ranges are handled by http.ServeContent
+type StaticResourceHandler struct {
+	fsys       fs.FS
+	pathPrefix string
+	// cache keeps content of files no larger than maxSize
+	cache                   *lru.Cache[string, []byte]
+	extensionContentTypeMap map[string]string
+	maxSize                 int
+	index                   string
+	fallback                string
+	precompressed           bool
+	cacheControl            func(name string) string
+	// etags are content hashes of files without modification time, such as files of embed.FS
+	etags sync.Map
+}
+
+type StaticResourceHandlerOption func(sh *StaticResourceHandler)
+
+// NewStaticResourceHandler serves files of dir/pathPrefix
+func NewStaticResourceHandler(dir string, pathPrefix string, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
+	return NewStaticResourceHandlerFS(os.DirFS(dir), pathPrefix, opts...)
+}
+
+// NewStaticResourceHandlerFS serves files of fsys under pathPrefix, pathPrefix could be empty
+func NewStaticResourceHandlerFS(fsys fs.FS, pathPrefix string, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
+	// key-value count <= 1000
+	c, err := lru.New[string, []byte](1000)
+	if err != nil {
+		return nil, err
+	}
+	res := &StaticResourceHandler{
+		fsys:                    fsys,
+		pathPrefix:              strings.Trim(pathPrefix, "/"),
+		cache:                   c,
+		extensionContentTypeMap: map[string]string{},
+		maxSize:                 1024 * 1024 * 10,
+		cacheControl:            DefaultStaticCacheControl,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res, nil
+}
+
+// StaticResourceHandlerWithMaxSize caches files no larger than maxSize in memory, default 10 MiB
+func StaticResourceHandlerWithMaxSize(maxSize int) StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		sh.maxSize = maxSize
+	}
+}
+
+func StaticResourceHandlerWithCache(c *lru.Cache[string, []byte]) StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		sh.cache = c
+	}
+}
+
+// StaticResourceHandlerWithMoreExtension overrides content types detected by mime,
+// such as {"wasm": "application/wasm"}
+func StaticResourceHandlerWithMoreExtension(extMap map[string]string) StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		for ext, contentType := range extMap {
+			sh.extensionContentTypeMap[strings.TrimPrefix(ext, ".")] = contentType
+		}
+	}
+}
+
+// StaticResourceHandlerWithIndex serves index file such as index.html for directories,
+// directories are not found without it
+func StaticResourceHandlerWithIndex(index string) StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		sh.index = index
+	}
+}
+
+// StaticResourceHandlerWithFallback serves fallback file such as index.html of single page application
+// for missing paths without extension, missing assets such as /app.js are still not found
+func StaticResourceHandlerWithFallback(fallback string) StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		sh.fallback = fallback
+	}
+}
+
+// StaticResourceHandlerWithPrecompressed serves sibling file.zst or file.gz
+// if the client accepts zstd or gzip, they are generated by build tools
+func StaticResourceHandlerWithPrecompressed() StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		sh.precompressed = true
+	}
+}
+
+// StaticResourceHandlerWithCacheControl decides Cache-Control of files by name,
+// header is not set if it returns empty string, default DefaultStaticCacheControl
+func StaticResourceHandlerWithCacheControl(cacheControl func(name string) string) StaticResourceHandlerOption {
+	return func(sh *StaticResourceHandler) {
+		sh.cacheControl = cacheControl
+	}
+}
+
+// DefaultStaticCacheControl caches fingerprinted assets such as app.3f9a2c1b.js or index-BxK3f9aZ.js for a year,
+// other files are revalidated by ETag before used
+func DefaultStaticCacheControl(name string) string {
+	if fingerprinted(name) {
+		return "public, max-age=31536000, immutable"
+	}
+	return "no-cache"
+}
+
+// fingerprinted reports whether the base name contains a hash part of at least 8 alphanumeric characters
+// with a digit, between the first part and the extension
+func fingerprinted(name string) bool {
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	parts := strings.FieldsFunc(base, func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+	for i := 1; i < len(parts); i++ {
+		if isHash(parts[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHash(s string) bool {
+	if len(s) < 8 {
+		return false
+	}
+	digit := false
+	for _, c := range []byte(s) {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		default:
+			return false
+		}
+	}
+	return digit
+}
+
+func (sh *StaticResourceHandler) Handle(ctx *Context) {
+	name := path.Join(sh.pathPrefix, path.Clean("/" + sh.filePath(ctx))[1:])
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(sh.fsys, name)
+	if err == nil && info.IsDir() {
+		if sh.index == "" {
+			err = fs.ErrNotExist
+		} else {
+			name = path.Join(name, sh.index)
+			info, err = fs.Stat(sh.fsys, name)
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) && sh.fallback != "" && path.Ext(name) == "" {
+		name = path.Join(sh.pathPrefix, sh.fallback)
+		info, err = fs.Stat(sh.fsys, name)
+	}
+	if errors.Is(err, fs.ErrNotExist) || err == nil && info.IsDir() {
+		ctx.SetError(NewHTTPError(http.StatusNotFound, "file not found"))
+		return
+	}
+	if err != nil {
+		ctx.SetError(err)
+		return
+	}
+
+	header := ctx.Resp.Header()
+	if cacheControl := sh.cacheControl(name); cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	contentType := sh.contentType(name)
+	if sh.precompressed {
+		header.Add("Vary", "Accept-Encoding")
+		if encoding, encoded, encodedInfo := sh.negotiate(ctx.Req.Header.Get("Accept-Encoding"), name); encoding != "" {
+			header.Set("Content-Encoding", encoding)
+			if contentType == "" {
+				// content of encoded file can not be sniffed
+				contentType = "application/octet-stream"
+			}
+			name, info = encoded, encodedInfo
+		}
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	content, err := sh.open(name, info)
+	if err != nil {
+		ctx.SetError(err)
+		return
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+	etag, err := sh.etag(name, info, content)
+	if err != nil {
+		ctx.SetError(err)
+		return
+	}
+	header.Set("ETag", etag)
+	http.ServeContent(contextResponseWriter{ctx: ctx}, ctx.Req, path.Base(name), info.ModTime(), content)
+}
+
+// filePath is "file" path param or the path matched by wildcard
+func (sh *StaticResourceHandler) filePath(ctx *Context) string {
+	if param, ok := ctx.pathParam("file"); ok {
+		return param.val
+	}
+	route, ok := strings.CutSuffix(ctx.MatchedRoute, "/*")
+	if !ok {
+		return ""
+	}
+	res := strings.TrimLeft(ctx.Req.URL.Path, "/")
+	// skip segments before wildcard, the case of them could differ from route
+	for range strings.Count(route, "/") {
+		_, res, _ = strings.Cut(res, "/")
+	}
+	return res
+}
+
+// contentType is detected by extension, it is empty to be sniffed by http.ServeContent
+func (sh *StaticResourceHandler) contentType(name string) string {
+	ext := path.Ext(name)
+	if ext == "" {
+		return ""
+	}
+	if contentType, ok := sh.extensionContentTypeMap[ext[1:]]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// negotiate returns encoding and info of precompressed sibling accepted by client, zstd is preferred
+func (sh *StaticResourceHandler) negotiate(acceptEncoding string, name string) (string, string, fs.FileInfo) {
+	if acceptEncoding == "" {
+		return "", "", nil
+	}
+	for _, encoding := range []struct {
+		name string
+		ext  string
+	}{{name: "zstd", ext: ".zst"}, {name: "gzip", ext: ".gz"}} {
+		if !acceptsEncoding(acceptEncoding, encoding.name) {
+			continue
+		}
+		encoded := name + encoding.ext
+		if info, err := fs.Stat(sh.fsys, encoded); err == nil && !info.IsDir() {
+			return encoding.name, encoded, info
+		}
+	}
+	return "", "", nil
+}
+
+// acceptsEncoding reports whether encoding or "*" is listed in Accept-Encoding with q-value above 0
+func acceptsEncoding(header string, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encoding && name != "*" && !(encoding == "gzip" && name == "x-gzip") {
+			continue
+		}
+		quality := 1.0
+		if key, val, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+		if name != "*" {
+			// explicit encoding overrides "*"
+			return quality > 0
+		}
+		accepted = quality > 0
+	}
+	return accepted
+}
+
+// open returns content from cache, or reads file into cache if it is no larger than maxSize,
+// key contains size and modification time so that changed files are read again
+func (sh *StaticResourceHandler) open(name string, info fs.FileInfo) (readSeekCloser, error) {
+	key := fmt.Sprintf("%s:%d:%d", name, info.Size(), info.ModTime().UnixNano())
+	if data, ok := sh.cache.Get(key); ok {
+		return nopCloser{bytes.NewReader(data)}, nil
+	}
+	file, err := sh.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := file.(io.ReadSeeker); ok && info.Size() > int64(sh.maxSize) {
+		return struct {
+			io.ReadSeeker
+			io.Closer
+		}{seeker, file}, nil
+	}
+	data, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= sh.maxSize {
+		sh.cache.Add(key, data)
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// etag is made of size and modification time, or hash of content for files without modification time
+func (sh *StaticResourceHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()), nil
+	}
+	if etag, ok := sh.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	sh.etags.Store(name, etag)
+	return etag, nil
+}
+
+type readSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// contextResponseWriter writes response in streaming mode of Context
+type contextResponseWriter struct {
+	ctx *Context
+}
+
+func (w contextResponseWriter) Header() http.Header {
+	return w.ctx.Resp.Header()
+}
+
+func (w contextResponseWriter) Write(data []byte) (int, error) {
+	return w.ctx.Write(data)
+}
+
+func (w contextResponseWriter) WriteHeader(status int) {
+	w.ctx.WriteHeader(status)
+}
@@ -0,0 +1,274 @@
+package web
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticResourceHandler_Handle(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"public/index.html":                 {Data: []byte("<html>home</html>"), ModTime: modTime},
+		"public/docs/index.html":            {Data: []byte("<html>docs</html>"), ModTime: modTime},
+		"public/docs/manual.pdf":            {Data: []byte("%PDF-1.7"), ModTime: modTime},
+		"public/LICENSE":                    {Data: []byte("MIT License"), ModTime: modTime},
+		"public/assets/app.3f9a2c1b.js":     {Data: []byte("console.log('app')"), ModTime: modTime},
+		"public/assets/app.3f9a2c1b.js.gz":  {Data: []byte("gzip"), ModTime: modTime},
+		"public/assets/app.3f9a2c1b.js.zst": {Data: []byte("zstd"), ModTime: modTime},
+		"public/assets/data.bin":            {Data: []byte("0123456789"), ModTime: modTime},
+		"secret.txt":                        {Data: []byte("secret"), ModTime: modTime},
+	}
+	etag := fmt.Sprintf(`"%x-a"`, modTime.UnixNano())
+
+	testCases := []struct {
+		name       string
+		opts       []StaticResourceHandlerOption
+		path       string
+		header     map[string]string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			name:     "javascript",
+			path:     "/static/assets/app.3f9a2c1b.js",
+			wantCode: http.StatusOK,
+			wantBody: "console.log('app')",
+			wantHeader: map[string]string{
+				"Content-Type":  "text/javascript; charset=utf-8",
+				"Cache-Control": "public, max-age=31536000, immutable",
+				"Last-Modified": "Tue, 02 Jan 2024 03:04:05 GMT",
+			},
+		},
+		{
+			name:       "pdf",
+			path:       "/static/docs/manual.pdf",
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "application/pdf", "Cache-Control": "no-cache"},
+		},
+		{
+			name:       "sniffed without extension",
+			path:       "/static/LICENSE",
+			wantCode:   http.StatusOK,
+			wantBody:   "MIT License",
+			wantHeader: map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		},
+		{
+			name:       "more extension",
+			opts:       []StaticResourceHandlerOption{StaticResourceHandlerWithMoreExtension(map[string]string{".bin": "application/x-data"})},
+			path:       "/static/assets/data.bin",
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "application/x-data"},
+		},
+		{
+			name:     "not modified by etag",
+			path:     "/static/assets/data.bin",
+			header:   map[string]string{"If-None-Match": etag},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "not modified since",
+			path:     "/static/assets/data.bin",
+			header:   map[string]string{"If-Modified-Since": "Tue, 02 Jan 2024 03:04:05 GMT"},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:       "range",
+			path:       "/static/assets/data.bin",
+			header:     map[string]string{"Range": "bytes=2-5"},
+			wantCode:   http.StatusPartialContent,
+			wantBody:   "2345",
+			wantHeader: map[string]string{"Content-Range": "bytes 2-5/10", "ETag": etag},
+		},
+		{
+			name:     "range of stale representation",
+			path:     "/static/assets/data.bin",
+			header:   map[string]string{"Range": "bytes=2-5", "If-Range": `"stale"`},
+			wantCode: http.StatusOK,
+			wantBody: "0123456789",
+		},
+		{
+			name:     "range not satisfiable",
+			path:     "/static/assets/data.bin",
+			header:   map[string]string{"Range": "bytes=20-"},
+			wantCode: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:     "traversal",
+			path:     "/static/../secret.txt",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "directory",
+			path:     "/static/docs",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "directory index",
+			opts:     []StaticResourceHandlerOption{StaticResourceHandlerWithIndex("index.html")},
+			path:     "/static/docs/",
+			wantCode: http.StatusOK,
+			wantBody: "<html>docs</html>",
+		},
+		{
+			name:     "spa fallback",
+			opts:     []StaticResourceHandlerOption{StaticResourceHandlerWithFallback("index.html")},
+			path:     "/static/users/1/profile",
+			wantCode: http.StatusOK,
+			wantBody: "<html>home</html>",
+			wantHeader: map[string]string{
+				"Content-Type":  "text/html; charset=utf-8",
+				"Cache-Control": "no-cache",
+			},
+		},
+		{
+			name:     "missing asset without fallback",
+			opts:     []StaticResourceHandlerOption{StaticResourceHandlerWithFallback("index.html")},
+			path:     "/static/assets/missing.js",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "precompressed zstd",
+			opts:     []StaticResourceHandlerOption{StaticResourceHandlerWithPrecompressed()},
+			path:     "/static/assets/app.3f9a2c1b.js",
+			header:   map[string]string{"Accept-Encoding": "gzip, deflate, br, zstd"},
+			wantCode: http.StatusOK,
+			wantBody: "zstd",
+			wantHeader: map[string]string{
+				"Content-Encoding": "zstd",
+				"Content-Type":     "text/javascript; charset=utf-8",
+				"Vary":             "Accept-Encoding",
+			},
+		},
+		{
+			name:       "precompressed gzip",
+			opts:       []StaticResourceHandlerOption{StaticResourceHandlerWithPrecompressed()},
+			path:       "/static/assets/app.3f9a2c1b.js",
+			header:     map[string]string{"Accept-Encoding": "*;q=0.5, zstd;q=0"},
+			wantCode:   http.StatusOK,
+			wantBody:   "gzip",
+			wantHeader: map[string]string{"Content-Encoding": "gzip"},
+		},
+		{
+			name:       "precompressed not accepted",
+			opts:       []StaticResourceHandlerOption{StaticResourceHandlerWithPrecompressed()},
+			path:       "/static/assets/app.3f9a2c1b.js",
+			header:     map[string]string{"Accept-Encoding": "br"},
+			wantCode:   http.StatusOK,
+			wantBody:   "console.log('app')",
+			wantHeader: map[string]string{"Content-Encoding": "", "Vary": "Accept-Encoding"},
+		},
+		{
+			name: "cache control",
+			opts: []StaticResourceHandlerOption{StaticResourceHandlerWithCacheControl(func(name string) string {
+				return ""
+			})},
+			path:       "/static/assets/app.3f9a2c1b.js",
+			wantCode:   http.StatusOK,
+			wantHeader: map[string]string{"Cache-Control": ""},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sh, err := NewStaticResourceHandlerFS(fsys, "public", tc.opts...)
+			require.NoError(t, err)
+			h := NewHTTPServer()
+			h.Get("/static/*", sh.Handle)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for key, val := range tc.header {
+				req.Header.Set(key, val)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantBody, recorder.Body.String())
+			}
+			for key, val := range tc.wantHeader {
+				assert.Equal(t, val, recorder.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestStaticResourceHandler_HandleDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "js"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "js", "app.js"), []byte("v1"), 0644))
+	sh, err := NewStaticResourceHandler(dir, "js")
+	require.NoError(t, err)
+	h := NewHTTPServer()
+	h.Get("/static/:file", sh.Handle)
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "v1", recorder.Body.String())
+	etag := recorder.Header().Get("ETag")
+
+	// changed file is not served from cache
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "js", "app.js"), []byte("v2!"), 0644))
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	assert.Equal(t, "v2!", recorder.Body.String())
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "/static/app.js", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "3", recorder.Header().Get("Content-Length"))
+	assert.Empty(t, recorder.Body.String())
+}
+
+func TestStaticResourceHandler_HandleEmbed(t *testing.T) {
+	// files of embed.FS have no modification time
+	fsys := fstest.MapFS{"app.css": {Data: []byte("body{}")}}
+	sh, err := NewStaticResourceHandlerFS(fsys, "", StaticResourceHandlerWithMaxSize(0))
+	require.NoError(t, err)
+	h := NewHTTPServer()
+	h.Group("/assets").Get("/*", sh.Handle)
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/assets/app.css", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "body{}", recorder.Body.String())
+	assert.Equal(t, "text/css; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Empty(t, recorder.Header().Get("Last-Modified"))
+	etag := recorder.Header().Get("ETag")
+	assert.Len(t, etag, 34)
+
+	req := httptest.NewRequest(http.MethodGet, "/assets/app.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+}
+
+func TestFingerprinted(t *testing.T) {
+	testCases := []struct {
+		name string
+		want bool
+	}{
+		{name: "assets/app.3f9a2c1b.js", want: true},
+		{name: "assets/index-BxK3f9aZ.js", want: true},
+		{name: "main.3f9a2c1b.chunk.css", want: true},
+		{name: "index.html", want: false},
+		{name: "jquery-3.7.1.min.js", want: false},
+		{name: "3f9a2c1b.js", want: false},
+		{name: "my-component.js", want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, fingerprinted(tc.name))
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var _ storage.Storage = &Storage{}
+
+// Storage stores files under dir of local disk,
+// content type is decided by extension of key
+type Storage struct {
+	dir string
+}
+
+func NewStorage(dir string) *Storage {
+	return &Storage{dir: dir}
+}
+
+// Put writes a temporary file in the same directory and renames it,
+// so that readers never see a partial file
+func (s *Storage) Put(_ context.Context, key string, reader io.Reader, _ int64, _ string) error {
+	return s.write(key, reader, os.Rename)
+}
+
+// Create links the temporary file instead, which fails if file exists
+func (s *Storage) Create(_ context.Context, key string, reader io.Reader, _ int64, _ string) error {
+	err := s.write(key, reader, func(tmp string, dst string) error {
+		if err := os.Link(tmp, dst); err != nil {
+			return err
+		}
+		// file is created, the temporary name is only garbage
+		_ = os.Remove(tmp)
+		return nil
+	})
+	if errors.Is(err, fs.ErrExist) {
+		return storage.ErrExists
+	}
+	return err
+}
+
+// write writes a temporary file and moves it to key by commit
+func (s *Storage) write(key string, reader io.Reader, commit func(tmp string, dst string) error) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	// directory, not the file itself
+	if err = os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	// buffer default 32 * 1024
+	_, err = io.Copy(tmp, reader)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = commit(tmp.Name(), dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *Storage) Get(_ context.Context, key string) (io.ReadCloser, storage.Object, error) {
+	dst, err := s.path(key)
+	if err != nil {
+		return nil, storage.Object{}, err
+	}
+	file, err := os.Open(dst)
+	if err != nil {
+		return nil, storage.Object{}, notFound(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, storage.Object{}, err
+	}
+	if info.IsDir() {
+		_ = file.Close()
+		return nil, storage.Object{}, storage.ErrNotFound
+	}
+	return file, object(key, info), nil
+}
+
+func (s *Storage) Stat(_ context.Context, key string) (storage.Object, error) {
+	dst, err := s.path(key)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return storage.Object{}, notFound(err)
+	}
+	if info.IsDir() {
+		return storage.Object{}, storage.ErrNotFound
+	}
+	return object(key, info), nil
+}
+
+func (s *Storage) Delete(_ context.Context, key string) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List walks dir, temporary files of unfinished writes are skipped
+func (s *Storage) List(_ context.Context, dir string) ([]storage.Object, error) {
+	root, err := s.path(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []storage.Object
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, file)
+		if err != nil {
+			return err
+		}
+		res = append(res, object(filepath.ToSlash(rel), info))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	// a/b.txt is walked after a/b/c
+	slices.SortFunc(res, func(a, b storage.Object) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return res, err
+}
+
+func (s *Storage) path(key string) (string, error) {
+	if !storage.ValidKey(key) {
+		return "", storage.ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func object(key string, info fs.FileInfo) storage.Object {
+	return storage.Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     info.ModTime(),
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return storage.ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage(dir)
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "avatars/1.png", strings.NewReader("png"), -1, ""))
+	// parent directories are created, not the file itself
+	data, err := os.ReadFile(filepath.Join(dir, "avatars", "1.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(data))
+
+	obj, err := s.Stat(ctx, "avatars/1.png")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), obj.Size)
+	assert.Equal(t, "image/png", obj.ContentType)
+	assert.False(t, obj.ModTime.IsZero())
+
+	reader, obj, err := s.Get(ctx, "avatars/1.png")
+	require.NoError(t, err)
+	data, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "png", string(data))
+	assert.Equal(t, "avatars/1.png", obj.Key)
+
+	// failed put keeps the previous file and leaves no temporary file
+	err = s.Put(ctx, "avatars/1.png", io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset"))), -1, "")
+	assert.Error(t, err)
+	data, err = os.ReadFile(filepath.Join(dir, "avatars", "1.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(data))
+	entries, err := os.ReadDir(filepath.Join(dir, "avatars"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// create never replaces existing file and leaves no temporary file
+	assert.ErrorIs(t, s.Create(ctx, "avatars/1.png", strings.NewReader("new"), -1, ""), storage.ErrExists)
+	data, err = os.ReadFile(filepath.Join(dir, "avatars", "1.png"))
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(data))
+	require.NoError(t, s.Create(ctx, "avatars/2.png", strings.NewReader("new"), -1, ""))
+	entries, err = os.ReadDir(filepath.Join(dir, "avatars"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// listed recursively without temporary files
+	require.NoError(t, s.Put(ctx, "avatars/2/small.png", strings.NewReader("small"), -1, ""))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "avatars", ".upload-1"), []byte("partial"), 0o644))
+	objects, err := s.List(ctx, "avatars")
+	require.NoError(t, err)
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	assert.Equal(t, []string{"avatars/1.png", "avatars/2.png", "avatars/2/small.png"}, keys)
+	objects, err = s.List(ctx, "missing")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+	require.NoError(t, os.Remove(filepath.Join(dir, "avatars", ".upload-1")))
+	require.NoError(t, s.Delete(ctx, "avatars/2/small.png"))
+	require.NoError(t, s.Delete(ctx, "avatars/2.png"))
+
+	require.NoError(t, s.Delete(ctx, "avatars/1.png"))
+	require.NoError(t, s.Delete(ctx, "avatars/1.png"))
+	_, err = s.Stat(ctx, "avatars/1.png")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, _, err = s.Get(ctx, "avatars")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../b", "a//b", "."} {
+		assert.ErrorIs(t, s.Put(ctx, key, strings.NewReader(""), 0, ""), storage.ErrInvalidKey, key)
+	}
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ storage.Storage = &Storage{}
+
+// Storage keeps files in memory, it is for tests and single node demos
+type Storage struct {
+	mutex   sync.RWMutex
+	objects map[string]object
+}
+
+type object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		objects: make(map[string]object),
+	}
+}
+
+func (s *Storage) Put(_ context.Context, key string, reader io.Reader, _ int64, contentType string) error {
+	return s.put(key, reader, contentType, true)
+}
+
+func (s *Storage) Create(_ context.Context, key string, reader io.Reader, _ int64, contentType string) error {
+	return s.put(key, reader, contentType, false)
+}
+
+func (s *Storage) put(key string, reader io.Reader, contentType string, overwrite bool) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.objects[key]; ok && !overwrite {
+		return storage.ErrExists
+	}
+	s.objects[key] = object{data: data, contentType: contentType, modTime: time.Now()}
+	return nil
+}
+
+func (s *Storage) Get(_ context.Context, key string) (io.ReadCloser, storage.Object, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, storage.Object{}, storage.ErrNotFound
+	}
+	// data is never modified after put
+	return io.NopCloser(bytes.NewReader(obj.data)), obj.info(key), nil
+}
+
+func (s *Storage) Stat(_ context.Context, key string) (storage.Object, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return storage.Object{}, storage.ErrNotFound
+	}
+	return obj.info(key), nil
+}
+
+func (s *Storage) Delete(_ context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *Storage) List(_ context.Context, dir string) ([]storage.Object, error) {
+	if !storage.ValidKey(dir) {
+		return nil, storage.ErrInvalidKey
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var res []storage.Object
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, dir+"/") {
+			res = append(res, obj.info(key))
+		}
+	}
+	slices.SortFunc(res, func(a, b storage.Object) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return res, nil
+}
+
+func (o object) info(key string) storage.Object {
+	return storage.Object{
+		Key:         key,
+		Size:        int64(len(o.data)),
+		ContentType: o.contentType,
+		ModTime:     o.modTime,
+	}
+}
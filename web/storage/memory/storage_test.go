@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStorage(t *testing.T) {
+	s := NewStorage()
+	ctx := context.Background()
+
+	require.NoError(t, s.Put(ctx, "docs/a.txt", strings.NewReader("hello"), 5, "text/plain"))
+	obj, err := s.Stat(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), obj.Size)
+	assert.Equal(t, "text/plain", obj.ContentType)
+
+	reader, _, err := s.Get(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// failed put keeps the previous object
+	assert.Error(t, s.Put(ctx, "docs/a.txt", iotest.ErrReader(io.ErrUnexpectedEOF), -1, ""))
+	obj, err = s.Stat(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), obj.Size)
+
+	// create never replaces existing object
+	assert.ErrorIs(t, s.Create(ctx, "docs/a.txt", strings.NewReader("new"), 3, ""), storage.ErrExists)
+	obj, err = s.Stat(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), obj.Size)
+	require.NoError(t, s.Create(ctx, "docs/b.txt", strings.NewReader("new"), 3, ""))
+
+	require.NoError(t, s.Put(ctx, "docs.txt", strings.NewReader("other"), 5, ""))
+	objects, err := s.List(ctx, "docs")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "docs/a.txt", objects[0].Key)
+	assert.Equal(t, "docs/b.txt", objects[1].Key)
+	objects, err = s.List(ctx, "missing")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+
+	require.NoError(t, s.Delete(ctx, "docs/a.txt"))
+	_, _, err = s.Get(ctx, "docs/a.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, s.Put(ctx, "../a.txt", strings.NewReader(""), 0, ""), storage.ErrInvalidKey)
+}
@@ -0,0 +1,335 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minPartSize is the minimum size of parts except the last one
+const minPartSize = 5 << 20
+
+var _ storage.Storage = &Storage{}
+
+// Config of S3 compatible service, objects are addressed in path style:
+// Endpoint/Bucket/key
+type Config struct {
+	// Endpoint is the base URL of service, such as https://s3.us-east-1.amazonaws.com or http://127.0.0.1:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is for temporary credentials
+	SessionToken string
+	// PartSize is the size of parts of multipart upload, default and minimum 5 MiB,
+	// at most one part is buffered in memory for each upload
+	PartSize int64
+	// Client sends requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Storage stores files in a bucket of S3 compatible service by signed REST requests,
+// content of unknown size is uploaded by multipart upload
+type Storage struct {
+	cfg Config
+	now func() time.Time
+}
+
+func NewStorage(cfg Config) *Storage {
+	if cfg.PartSize < minPartSize {
+		cfg.PartSize = minPartSize
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &Storage{cfg: cfg, now: time.Now}
+}
+
+// Error is the error response of service
+type Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (s *Storage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	return s.put(ctx, key, reader, size, contentType, nil)
+}
+
+// Create writes with If-None-Match: *, service responds 412 if object exists,
+// or 409 if another conditional write of the key is in progress
+func (s *Storage) Create(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	err := s.put(ctx, key, reader, size, contentType, http.Header{"If-None-Match": {"*"}})
+	var res *Error
+	if errors.As(err, &res) && (res.Status == http.StatusPreconditionFailed ||
+		res.Status == http.StatusConflict && res.Code == "ConditionalRequestConflict") {
+		return storage.ErrExists
+	}
+	return err
+}
+
+// put uploads content, condition is sent by the request creating object
+func (s *Storage) put(ctx context.Context, key string, reader io.Reader, size int64, contentType string,
+	condition http.Header) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+	bufSize := s.cfg.PartSize
+	if size >= 0 && size < bufSize {
+		// one more byte to detect EOF
+		bufSize = size + 1
+	}
+	buf := make([]byte, bufSize)
+	n, err := io.ReadFull(reader, buf)
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		// fits in one request
+		return s.putObject(ctx, key, buf[:n], contentType, condition)
+	case err != nil:
+		return err
+	case int64(n) < s.cfg.PartSize:
+		return errors.New("s3: content is longer than size")
+	}
+	return s.multipartUpload(ctx, key, reader, buf, contentType, condition)
+}
+
+func (s *Storage) putObject(ctx context.Context, key string, data []byte, contentType string, condition http.Header) error {
+	header := condition.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// multipartUpload uploads first part in buf and the rest of reader, upload is aborted if any part fails,
+// condition is checked when upload is completed
+func (s *Storage) multipartUpload(ctx context.Context, key string, reader io.Reader, buf []byte, contentType string,
+	condition http.Header) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, header, nil, &initiated); err != nil {
+		return err
+	}
+	err := s.uploadParts(ctx, key, initiated.UploadID, reader, buf, condition)
+	if err != nil {
+		// parts are charged until aborted
+		if resp, abortErr := s.do(context.WithoutCancel(ctx), http.MethodDelete, key,
+			url.Values{"uploadId": {initiated.UploadID}}, nil, nil); abortErr == nil {
+			_ = resp.Body.Close()
+		}
+	}
+	return err
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *Storage) uploadParts(ctx context.Context, key string, uploadID string, reader io.Reader, buf []byte,
+	condition http.Header) error {
+	var parts []completedPart
+	data := buf
+	for {
+		number := len(parts) + 1
+		resp, err := s.do(ctx, http.MethodPut, key, url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}, nil, data)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		n, err := io.ReadFull(reader, buf)
+		if n == 0 && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		data = buf[:n]
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	// error could be reported with status 200
+	var completed struct {
+		XMLName xml.Name
+		Error
+	}
+	if err = s.doXML(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, condition, body, &completed); err != nil {
+		return err
+	}
+	if completed.XMLName.Local == "Error" {
+		completed.Error.Status = http.StatusOK
+		return &completed.Error
+	}
+	return nil
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (io.ReadCloser, storage.Object, error) {
+	if !storage.ValidKey(key) {
+		return nil, storage.Object{}, storage.ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, storage.Object{}, err
+	}
+	return resp.Body, object(key, resp), nil
+}
+
+func (s *Storage) Stat(ctx context.Context, key string) (storage.Object, error) {
+	if !storage.ValidKey(key) {
+		return storage.Object{}, storage.ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	_ = resp.Body.Close()
+	return object(key, resp), nil
+}
+
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	if !storage.ValidKey(key) {
+		return storage.ErrInvalidKey
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// List sends ListObjectsV2 requests until the result is not truncated
+func (s *Storage) List(ctx context.Context, dir string) ([]storage.Object, error) {
+	if !storage.ValidKey(dir) {
+		return nil, storage.ErrInvalidKey
+	}
+	var res []storage.Object
+	query := url.Values{"list-type": {"2"}, "prefix": {dir + "/"}}
+	for {
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		// bucket itself
+		if err := s.doXML(ctx, http.MethodGet, "", query, nil, nil, &result); err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			res = append(res, storage.Object{Key: content.Key, Size: content.Size, ModTime: content.LastModified})
+		}
+		if !result.IsTruncated {
+			// keys are returned in UTF-8 binary order
+			return res, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// do sends signed request, error responses are returned as *Error or storage.ErrNotFound
+func (s *Storage) do(ctx context.Context, method string, key string, query url.Values,
+	header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.cfg.Endpoint + "/" + uriEncode(s.cfg.Bucket, true) + "/" + uriEncode(key, false))
+	if err != nil {
+		return nil, err
+	}
+	// query is encoded as it is signed
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, vals := range header {
+		req.Header[name] = vals
+	}
+	payloadHash := emptyHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	s.sign(req, payloadHash, s.now())
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusMultipleChoices {
+		return resp, nil
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	res := &Error{}
+	// HEAD responses have no body
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(res)
+	res.Status = resp.StatusCode
+	if resp.StatusCode == http.StatusNotFound && (res.Code == "" || res.Code == "NoSuchKey") {
+		return nil, storage.ErrNotFound
+	}
+	return nil, res
+}
+
+func (s *Storage) doXML(ctx context.Context, method string, key string, query url.Values,
+	header http.Header, body []byte, val any) error {
+	resp, err := s.do(ctx, method, key, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return xml.NewDecoder(resp.Body).Decode(val)
+}
+
+func object(key string, resp *http.Response) storage.Object {
+	res := storage.Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		res.ModTime = modTime
+	}
+	return res
+}
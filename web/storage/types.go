@@ -0,0 +1,48 @@
+// Package storage abstracts where uploaded files are stored,
+// keys are slash separated relative paths such as avatars/1.png
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrExists     = errors.New("storage: object already exists")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Object describes a stored file
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+type Storage interface {
+	// Put stores content of reader, size is -1 if unknown,
+	// object is not visible until reader is drained and nothing is left if reading fails
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	// Create is like Put but fails with ErrExists if object exists,
+	// the check is atomic so that concurrent writers of the same key never replace each other
+	Create(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error
+	// Get opens object, ErrNotFound is returned if it does not exist
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete removes object, it is not an error if object does not exist
+	Delete(ctx context.Context, key string) error
+	// List returns objects under dir recursively sorted by key, such as avatars for avatars/1.png,
+	// it is empty if dir does not exist
+	List(ctx context.Context, dir string) ([]Object, error)
+}
+
+// ValidKey reports whether key could be used by all storages,
+// it rejects empty, absolute and unclean paths such as ../etc/passwd
+func ValidKey(key string) bool {
+	return key != "." && fs.ValidPath(key)
+}
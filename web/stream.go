@@ -0,0 +1,62 @@
+package web
+
+import (
+	"io"
+	"net/http"
+)
+
+var (
+	_ io.Writer    = &Context{}
+	_ http.Flusher = &Context{}
+)
+
+// WriteHeader commits status and headers of response to client,
+// it only works at the first call, use Write after it to stream the body
+func (ctx *Context) WriteHeader(status int) {
+	if ctx.committed {
+		return
+	}
+	ctx.committed = true
+	ctx.RespCode = status
+	ctx.Resp.WriteHeader(status)
+}
+
+// Write switches the response to streaming mode and writes data to client,
+// status is committed with RespCode or 200 at the first call
+func (ctx *Context) Write(data []byte) (int, error) {
+	if !ctx.committed {
+		status := ctx.RespCode
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ctx.WriteHeader(status)
+	}
+	if ctx.Req.Method == http.MethodHead {
+		return len(data), nil
+	}
+	n, err := ctx.Resp.Write(data)
+	ctx.respSize += n
+	return n, err
+}
+
+// Flush sends buffered data to client, it does nothing if Resp can not flush
+func (ctx *Context) Flush() {
+	if !ctx.committed {
+		ctx.Write(nil)
+	}
+	_ = http.NewResponseController(ctx.Resp).Flush()
+}
+
+// Committed reports whether status and headers have been written to client
+func (ctx *Context) Committed() bool {
+	return ctx.committed
+}
+
+// RespSize returns the number of body bytes written in streaming mode,
+// or the length of RespData otherwise
+func (ctx *Context) RespSize() int {
+	if ctx.committed {
+		return ctx.respSize
+	}
+	return len(ctx.RespData)
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContext_Write(t *testing.T) {
+	var status, size int
+	var committed bool
+	h := NewHTTPServer(ServerWithMiddlewares(func(next Handler) Handler {
+		return func(ctx *Context) {
+			next(ctx)
+			status, size, committed = ctx.RespCode, ctx.RespSize(), ctx.Committed()
+		}
+	}))
+	h.Get("/stream", func(ctx *Context) {
+		ctx.RespCode = http.StatusCreated
+		_, _ = ctx.Write([]byte("hello "))
+		ctx.Flush()
+		// ignored after committed
+		ctx.WriteHeader(http.StatusInternalServerError)
+		ctx.RespData = []byte("ignored")
+		_, _ = ctx.Write([]byte("world"))
+	})
+	h.Get("/buffer", func(ctx *Context) {
+		ctx.RespData = []byte("buffer")
+	})
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		wantCode      int
+		wantBody      string
+		wantSize      int
+		wantCommitted bool
+	}{
+		{"stream", http.MethodGet, "/stream", http.StatusCreated, "hello world", 11, true},
+		{"stream head", http.MethodHead, "/stream", http.StatusCreated, "", 0, true},
+		{"buffer", http.MethodGet, "/buffer", http.StatusOK, "buffer", 6, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantSize, size)
+			assert.Equal(t, tc.wantCommitted, committed)
+			if tc.wantCommitted {
+				assert.Equal(t, tc.wantCode, status)
+			}
+		})
+	}
+}
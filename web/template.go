@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"html/template"
+	"maps"
+	"sync"
 )
 
 type TemplateEngine interface {
@@ -20,12 +22,47 @@ type TemplateEngine interface {
 
 var _ TemplateEngine = &GoTemplateEngine{}
 
+// GoTemplateEngine renders prebuilt templates,
+// parse T with HTTPServer.TemplateFuncs to generate urls of named routes,
+// functions set by WithTemplateFuncs override the parsed ones when rendering
 type GoTemplateEngine struct {
 	T *template.Template
+
+	once sync.Once
+	// base is cloned from T before any execution, html/template could not be cloned after executed
+	base *template.Template
+	err  error
 }
 
-func (gt *GoTemplateEngine) Render(_ context.Context, name string, data any) ([]byte, error) {
+func (gt *GoTemplateEngine) Render(ctx context.Context, name string, data any) ([]byte, error) {
+	gt.once.Do(func() {
+		gt.base, gt.err = gt.T.Clone()
+	})
+	t := gt.T
+	if funcs, ok := ctx.Value(templateFuncsKey{}).(template.FuncMap); ok {
+		if gt.err != nil {
+			return nil, gt.err
+		}
+		var err error
+		if t, err = gt.base.Clone(); err != nil {
+			return nil, err
+		}
+		t.Funcs(funcs)
+	}
 	buffer := &bytes.Buffer{}
-	err := gt.T.ExecuteTemplate(buffer, name, data)
+	err := t.ExecuteTemplate(buffer, name, data)
 	return buffer.Bytes(), err
 }
+
+type templateFuncsKey struct{}
+
+// WithTemplateFuncs returns context carrying functions for templates rendered with it,
+// such as csrf token of request, functions must be declared when parsing templates
+func WithTemplateFuncs(ctx context.Context, funcs template.FuncMap) context.Context {
+	if prev, ok := ctx.Value(templateFuncsKey{}).(template.FuncMap); ok {
+		merged := maps.Clone(prev)
+		maps.Copy(merged, funcs)
+		funcs = merged
+	}
+	return context.WithValue(ctx, templateFuncsKey{}, funcs)
+}
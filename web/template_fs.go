@@ -0,0 +1,418 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"net/http"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// StreamTemplateEngine is implemented by engines rendering into writer directly, see Context.RenderStream
+type StreamTemplateEngine interface {
+	TemplateEngine
+	RenderTo(ctx context.Context, writer io.Writer, name string, data any) error
+}
+
+var _ StreamTemplateEngine = &FSTemplateEngine{}
+
+// FSTemplateEngine loads templates of fs.FS, templates are named by path without extension,
+// files of shared directories (layouts and partials by default) are parsed into every page,
+// so a page could extend layout by defining its blocks:
+//
+//	{{/* layouts/base.gohtml */}}
+//	<html><title>{{ block "title" . }}site{{ end }}</title>{{ template "partials/nav" . }}{{ block "content" . }}{{ end }}</html>
+//
+//	{{/* users/detail.gohtml, rendered by name users/detail */}}
+//	{{ template "layouts/base" . }}
+//	{{ define "title" }}{{ .Name }}{{ end }}
+//	{{ define "content" }}<p>{{ formatTime .CreatedAt "2006-01-02" }}</p>{{ end }}
+//
+// pages are parsed separately, so blocks of different pages do not conflict
+type FSTemplateEngine struct {
+	fsys   fs.FS
+	ext    string
+	shared []string
+	funcs  template.FuncMap
+	dev    bool
+	server *HTTPServer
+
+	mutex sync.RWMutex
+	pages map[string]*templatePage
+	// stamps are sizes and modification times of parsed files in dev mode
+	stamps map[string]string
+	err    error
+}
+
+// templatePage is a page with shared templates,
+// base is cloned from t before any execution for request functions, see GoTemplateEngine
+type templatePage struct {
+	t    *template.Template
+	base *template.Template
+}
+
+type FSTemplateEngineOption func(engine *FSTemplateEngine)
+
+// NewFSTemplateEngine parses all templates of fsys and returns the first error,
+// templates are parsed at the first rendering in dev mode
+func NewFSTemplateEngine(fsys fs.FS, opts ...FSTemplateEngineOption) (*FSTemplateEngine, error) {
+	res := &FSTemplateEngine{
+		fsys:   fsys,
+		ext:    ".gohtml",
+		shared: []string{"layouts", "partials"},
+	}
+	res.funcs = res.builtinFuncs()
+	for _, opt := range opts {
+		opt(res)
+	}
+	if res.dev {
+		return res, nil
+	}
+	pages, _, err := res.parse()
+	if err != nil {
+		return nil, err
+	}
+	res.pages = pages
+	return res, nil
+}
+
+// FSTemplateEngineWithExtension sets extension of template files, default .gohtml
+func FSTemplateEngineWithExtension(ext string) FSTemplateEngineOption {
+	return func(engine *FSTemplateEngine) {
+		engine.ext = ext
+	}
+}
+
+// FSTemplateEngineWithShared sets directories of layouts and partials
+func FSTemplateEngineWithShared(dirs ...string) FSTemplateEngineOption {
+	return func(engine *FSTemplateEngine) {
+		engine.shared = dirs
+	}
+}
+
+// FSTemplateEngineWithFuncs registers functions, they override the built-in ones
+func FSTemplateEngineWithFuncs(funcs template.FuncMap) FSTemplateEngineOption {
+	return func(engine *FSTemplateEngine) {
+		maps.Copy(engine.funcs, funcs)
+	}
+}
+
+// FSTemplateEngineWithDevMode parses templates again before rendering if any file changed,
+// errors of templates are returned by rendering instead of NewFSTemplateEngine
+func FSTemplateEngineWithDevMode() FSTemplateEngineOption {
+	return func(engine *FSTemplateEngine) {
+		engine.dev = true
+	}
+}
+
+// bind is called by ServerWithTemplateEngine for urlFor
+func (e *FSTemplateEngine) bind(server *HTTPServer) {
+	e.server = server
+}
+
+func (e *FSTemplateEngine) Render(ctx context.Context, name string, data any) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := e.RenderTo(ctx, buffer, name, data); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// RenderTo executes template of name into writer,
+// functions set by WithTemplateFuncs override the registered ones
+func (e *FSTemplateEngine) RenderTo(ctx context.Context, writer io.Writer, name string, data any) error {
+	page, err := e.page(strings.TrimSuffix(name, e.ext))
+	if err != nil {
+		return err
+	}
+	t := page.t
+	if funcs, ok := ctx.Value(templateFuncsKey{}).(template.FuncMap); ok {
+		if t, err = page.base.Clone(); err != nil {
+			return err
+		}
+		t.Funcs(funcs)
+	}
+	return t.Execute(writer, data)
+}
+
+func (e *FSTemplateEngine) page(name string) (*templatePage, error) {
+	if e.dev {
+		if err := e.reload(); err != nil {
+			return nil, err
+		}
+	}
+	e.mutex.RLock()
+	page, ok := e.pages[name]
+	e.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("web: template '%s' not found", name)
+	}
+	return page, nil
+}
+
+// reload parses templates again if files are added, removed or changed
+func (e *FSTemplateEngine) reload() error {
+	stamps, err := e.stamp()
+	if err != nil {
+		return err
+	}
+	e.mutex.RLock()
+	changed := e.pages == nil && e.err == nil || !maps.Equal(stamps, e.stamps)
+	err = e.err
+	e.mutex.RUnlock()
+	if !changed {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.stamps != nil && maps.Equal(stamps, e.stamps) {
+		// parsed by another request
+		return e.err
+	}
+	pages, parsed, err := e.parse()
+	if err != nil {
+		// fixed files are parsed at the next rendering
+		e.stamps, e.err = stamps, err
+		return err
+	}
+	// files changed during parsing are parsed again at the next rendering
+	e.pages, e.stamps, e.err = pages, parsed, nil
+	return nil
+}
+
+// stamp returns size and modification time of template files
+func (e *FSTemplateEngine) stamp() (map[string]string, error) {
+	res := make(map[string]string)
+	err := e.walk(func(file string, info fs.FileInfo) error {
+		res[file] = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return res, err
+}
+
+// parse parses shared templates into base and clones base for every page,
+// stamps of parsed files are returned
+func (e *FSTemplateEngine) parse() (map[string]*templatePage, map[string]string, error) {
+	var shared, pages []string
+	stamps := make(map[string]string)
+	contents := make(map[string]string)
+	err := e.walk(func(file string, info fs.FileInfo) error {
+		data, err := fs.ReadFile(e.fsys, file)
+		if err != nil {
+			return err
+		}
+		stamps[file] = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+		contents[file] = string(data)
+		if e.isShared(file) {
+			shared = append(shared, file)
+		} else {
+			pages = append(pages, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	base := template.New("").Funcs(e.funcs)
+	for _, file := range shared {
+		if _, err = base.New(strings.TrimSuffix(file, e.ext)).Parse(contents[file]); err != nil {
+			return nil, nil, err
+		}
+	}
+	res := make(map[string]*templatePage, len(shared)+len(pages))
+	for _, file := range slices.Concat(shared, pages) {
+		name := strings.TrimSuffix(file, e.ext)
+		t, err := base.Clone()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !e.isShared(file) {
+			if t, err = t.New(name).Parse(contents[file]); err != nil {
+				return nil, nil, err
+			}
+		}
+		t = t.Lookup(name)
+		pageBase, err := t.Clone()
+		if err != nil {
+			return nil, nil, err
+		}
+		res[name] = &templatePage{t: t, base: pageBase}
+	}
+	return res, stamps, nil
+}
+
+func (e *FSTemplateEngine) walk(fn func(file string, info fs.FileInfo) error) error {
+	return fs.WalkDir(e.fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(file) != e.ext {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(file, info)
+	})
+}
+
+func (e *FSTemplateEngine) isShared(file string) bool {
+	return slices.ContainsFunc(e.shared, func(dir string) bool {
+		return strings.HasPrefix(file, strings.Trim(dir, "/")+"/")
+	})
+}
+
+// builtinFuncs are declared before parsing:
+//
+//	urlFor "user.detail" "id" 12       url of named route, see HTTPServer.TemplateFuncs
+//	csrfToken, csrfField               replaced by csrf middleware for every request
+//	formatTime .CreatedAt "2006-01-02" formatted time, RFC 3339 without layout
+//	formatNumber 1234567.5             1,234,567.5
+//	formatBytes 1536                   1.5 KiB
+//	truncate .Title 20                 at most 20 runes with ellipsis
+//	dict "user" .User "size" 2         map for passing multiple values to partials
+func (e *FSTemplateEngine) builtinFuncs() template.FuncMap {
+	return template.FuncMap{
+		"urlFor": func(name string, pairs ...any) (string, error) {
+			if e.server == nil {
+				return "", errors.New("web: urlFor needs the engine set by ServerWithTemplateEngine")
+			}
+			return e.server.templateURLFor(name, pairs...)
+		},
+		"csrfToken":    func() string { return "" },
+		"csrfField":    func() template.HTML { return "" },
+		"formatTime":   formatTime,
+		"formatNumber": formatNumber,
+		"formatBytes":  formatBytes,
+		"truncate":     truncate,
+		"dict":         dict,
+	}
+}
+
+func formatTime(t time.Time, layout ...string) string {
+	if len(layout) == 0 {
+		return t.Format(time.RFC3339)
+	}
+	return t.Format(layout[0])
+}
+
+// formatNumber groups integer part by thousands
+func formatNumber(val any) (string, error) {
+	var s string
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		if math.IsInf(v.Float(), 0) || math.IsNaN(v.Float()) {
+			return fmt.Sprint(val), nil
+		}
+		s = strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+	default:
+		return "", fmt.Errorf("web: formatNumber of %T", val)
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	integer, fraction, _ := strings.Cut(s, ".")
+	builder := strings.Builder{}
+	builder.WriteString(sign)
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteRune(c)
+	}
+	if fraction != "" {
+		builder.WriteByte('.')
+		builder.WriteString(fraction)
+	}
+	return builder.String(), nil
+}
+
+// formatBytes formats size of any integer type in binary units
+func formatBytes(size any) (string, error) {
+	var val float64
+	v := reflect.ValueOf(size)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val = float64(v.Uint())
+	default:
+		return "", fmt.Errorf("web: formatBytes of %T", size)
+	}
+	if math.Abs(val) < 1024 {
+		return strconv.FormatFloat(val, 'f', 0, 64) + " B", nil
+	}
+	unit := 0
+	for ; math.Abs(val) >= 1024 && unit < 6; unit++ {
+		val /= 1024
+	}
+	return strconv.FormatFloat(val, 'f', 1, 64) + " " + "KMGTPE"[unit-1:unit] + "iB", nil
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max(n-1, 0)]) + "…"
+}
+
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("web: dict needs key-value pairs")
+	}
+	res := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("web: dict key %v is not string", pairs[i])
+		}
+		res[key] = pairs[i+1]
+	}
+	return res, nil
+}
+
+// RenderStream renders template into response without holding the whole page,
+// output is buffered so that errors before the first flush are still responded with 500,
+// it works as Render if template engine can not stream
+func (ctx *Context) RenderStream(templateName string, data any) error {
+	engine, ok := ctx.templateEngine.(StreamTemplateEngine)
+	if !ok {
+		return ctx.Render(templateName, data)
+	}
+	if ctx.RespCode == 0 {
+		ctx.RespCode = http.StatusOK
+	}
+	writer := bufio.NewWriterSize(ctx, 32<<10)
+	err := engine.RenderTo(ctx.Req.Context(), writer, templateName, data)
+	if err == nil {
+		return writer.Flush()
+	}
+	if !ctx.committed {
+		// nothing has been sent
+		ctx.RespCode = http.StatusInternalServerError
+	}
+	return err
+}
@@ -0,0 +1,245 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newTemplateFS() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.gohtml": {Data: []byte(
+			`<title>{{ block "title" . }}site{{ end }}</title>{{ template "partials/nav" . }}<main>{{ block "content" . }}{{ end }}</main>`)},
+		"partials/nav.gohtml": {Data: []byte(`<nav><a href="{{ urlFor "user" "id" 1 }}">me</a></nav>`)},
+		"partials/card.gohtml": {Data: []byte(
+			`<div>{{ .user }} {{ truncate .bio 6 }}</div>`)},
+		"users/detail.gohtml": {Data: []byte(
+			`{{ template "layouts/base" . }}{{ define "title" }}{{ .Name }}{{ end }}` +
+				`{{ define "content" }}{{ template "partials/card" dict "user" .Name "bio" .Bio }}` +
+				`{{ formatTime .CreatedAt "2006-01-02" }} {{ formatNumber .Views }} {{ formatBytes .Size }}{{ end }}`)},
+		"home.gohtml":  {Data: []byte(`{{ template "layouts/base" . }}`)},
+		"form.gohtml":  {Data: []byte(`<form>{{ csrfField }}</form>`)},
+		"readme.md":    {Data: []byte(`{{ not a template`)},
+		"upper.gohtml": {Data: []byte(`{{ upper . }}`)},
+	}
+}
+
+func TestFSTemplateEngine_Render(t *testing.T) {
+	engine, err := NewFSTemplateEngine(newTemplateFS(), FSTemplateEngineWithFuncs(template.FuncMap{
+		"upper": strings.ToUpper,
+	}))
+	require.NoError(t, err)
+	h := NewHTTPServer(ServerWithTemplateEngine(engine))
+	h.Get("/users/:id", func(ctx *Context) {}).Name("user")
+
+	testCases := []struct {
+		name    string
+		ctx     context.Context
+		tpl     string
+		data    any
+		want    string
+		wantErr string
+	}{
+		{
+			name: "layout with blocks",
+			ctx:  context.Background(),
+			tpl:  "users/detail",
+			data: map[string]any{"Name": "tom", "Bio": "gopher since 2012", "CreatedAt": time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+				"Views": 1234567, "Size": 1536},
+			want: `<title>tom</title><nav><a href="/users/1">me</a></nav>` +
+				`<main><div>tom gophe…</div>2024-05-06 1,234,567 1.5 KiB</main>`,
+		},
+		{
+			name: "default block",
+			ctx:  context.Background(),
+			tpl:  "home.gohtml",
+			want: `<title>site</title><nav><a href="/users/1">me</a></nav><main></main>`,
+		},
+		{
+			name: "partial",
+			ctx:  context.Background(),
+			tpl:  "partials/card",
+			data: map[string]any{"user": "<b>", "bio": "go"},
+			want: `<div>&lt;b&gt; go</div>`,
+		},
+		{
+			name: "registered funcs",
+			ctx:  context.Background(),
+			tpl:  "upper",
+			data: "go",
+			want: "GO",
+		},
+		{
+			name: "request funcs",
+			ctx: WithTemplateFuncs(context.Background(), template.FuncMap{
+				"csrfField": func() template.HTML { return `<input name="csrf" value="token">` },
+			}),
+			tpl:  "form",
+			want: `<form><input name="csrf" value="token"></form>`,
+		},
+		{
+			name:    "not found",
+			ctx:     context.Background(),
+			tpl:     "readme",
+			wantErr: "web: template 'readme' not found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := engine.Render(tc.ctx, tc.tpl, tc.data)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(data))
+		})
+	}
+
+	// request funcs do not leak into other renderings
+	data, err := engine.Render(context.Background(), "form", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<form></form>", string(data))
+
+	// page is executed with funcs of each request
+	for _, token := range []string{"a", "b"} {
+		ctx := WithTemplateFuncs(context.Background(), template.FuncMap{
+			"csrfField": func() template.HTML { return template.HTML(token) },
+		})
+		data, err = engine.Render(ctx, "form", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "<form>"+token+"</form>", string(data))
+	}
+}
+
+func TestFSTemplateEngine_FailFast(t *testing.T) {
+	fsys := newTemplateFS()
+	fsys["broken.gohtml"] = &fstest.MapFile{Data: []byte(`{{ if }}`)}
+	_, err := NewFSTemplateEngine(fsys)
+	assert.ErrorContains(t, err, "broken")
+
+	// functions must be registered
+	_, err = NewFSTemplateEngine(newTemplateFS())
+	assert.ErrorContains(t, err, `function "upper" not defined`)
+
+	// urlFor without server
+	engine, err := NewFSTemplateEngine(fstest.MapFS{"a.tmpl": {Data: []byte(`{{ urlFor "user" }}`)}},
+		FSTemplateEngineWithExtension(".tmpl"))
+	require.NoError(t, err)
+	_, err = engine.Render(context.Background(), "a", nil)
+	assert.ErrorContains(t, err, "urlFor needs the engine set by ServerWithTemplateEngine")
+}
+
+func TestFSTemplateEngine_DevMode(t *testing.T) {
+	modTime := time.Now()
+	fsys := fstest.MapFS{
+		"layouts/base.gohtml": {Data: []byte(`v1 {{ block "content" . }}{{ end }}`), ModTime: modTime},
+		"page.gohtml":         {Data: []byte(`{{ template "layouts/base" . }}{{ define "content" }}page{{ end }}`), ModTime: modTime},
+	}
+	engine, err := NewFSTemplateEngine(fsys, FSTemplateEngineWithDevMode())
+	require.NoError(t, err)
+	data, err := engine.Render(context.Background(), "page", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v1 page", string(data))
+
+	// changed layout is parsed again
+	fsys["layouts/base.gohtml"] = &fstest.MapFile{Data: []byte(`v2 {{ block "content" . }}{{ end }}`), ModTime: modTime.Add(time.Second)}
+	data, err = engine.Render(context.Background(), "page", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v2 page", string(data))
+
+	// errors are reported by rendering until fixed
+	fsys["page.gohtml"] = &fstest.MapFile{Data: []byte(`{{ if }}`), ModTime: modTime.Add(time.Second)}
+	_, err = engine.Render(context.Background(), "page", nil)
+	assert.Error(t, err)
+	_, err = engine.Render(context.Background(), "page", nil)
+	assert.Error(t, err)
+	fsys["page.gohtml"] = &fstest.MapFile{Data: []byte(`fixed`), ModTime: modTime.Add(2 * time.Second)}
+	fsys["new.gohtml"] = &fstest.MapFile{Data: []byte(`new`), ModTime: modTime}
+	data, err = engine.Render(context.Background(), "page", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", string(data))
+	data, err = engine.Render(context.Background(), "new", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestContext_RenderStream(t *testing.T) {
+	engine, err := NewFSTemplateEngine(fstest.MapFS{
+		"large.gohtml": {Data: []byte(`{{ range . }}<p>{{ . }}</p>{{ end }}`)},
+		"fail.gohtml":  {Data: []byte(`<p>{{ fail }}</p>`)},
+	}, FSTemplateEngineWithFuncs(template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("failed") },
+	}))
+	require.NoError(t, err)
+	h := NewHTTPServer(ServerWithTemplateEngine(engine))
+	var renderErr error
+	h.Get("/large", func(ctx *Context) {
+		items := make([]int, 10000)
+		for i := range items {
+			items[i] = i
+		}
+		renderErr = ctx.RenderStream("large", items)
+	})
+	h.Get("/fail", func(ctx *Context) {
+		renderErr = ctx.RenderStream("fail", nil)
+	})
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/large", nil))
+	require.NoError(t, renderErr)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Body.String(), "<p>0</p><p>1</p>"))
+	assert.True(t, strings.HasSuffix(recorder.Body.String(), "<p>9999</p>"))
+	// streamed without Content-Length
+	assert.Empty(t, recorder.Header().Get("Content-Length"))
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	assert.ErrorContains(t, renderErr, "failed")
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+}
+
+func TestFormatFuncs(t *testing.T) {
+	for val, want := range map[any]string{
+		0:             "0",
+		-1234:         "-1,234",
+		uint64(1000):  "1,000",
+		1234567.25:    "1,234,567.25",
+		-0.5:          "-0.5",
+		float32(12.5): "12.5",
+	} {
+		got, err := formatNumber(val)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := formatNumber("1")
+	assert.Error(t, err)
+
+	for val, want := range map[any]string{
+		512:           "512 B",
+		int64(1024):   "1.0 KiB",
+		uint(3 << 19): "1.5 MiB",
+		2 << 30:       "2.0 GiB",
+	} {
+		got, err := formatBytes(val)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err = formatBytes(1.5)
+	assert.Error(t, err)
+	assert.Equal(t, "hello", truncate("hello", 5))
+	assert.Equal(t, "你好…", truncate("你好世界", 3))
+	assert.Equal(t, "2024-05-06T07:08:09Z", formatTime(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)))
+	_, err = dict("a")
+	assert.Error(t, err)
+}
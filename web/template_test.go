@@ -0,0 +1,67 @@
+package web
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGoTemplateEngine_WithTemplateFuncs(t *testing.T) {
+	tpl, err := template.New("hello").Funcs(template.FuncMap{
+		"user": func() string { return "" },
+	}).Parse(`hello {{ user }}`)
+	require.NoError(t, err)
+	engine := &GoTemplateEngine{T: tpl}
+
+	data, err := engine.Render(context.Background(), "hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello ", string(data))
+	ctx := WithTemplateFuncs(context.Background(), template.FuncMap{
+		"user": func() string { return "tom" },
+	})
+	data, err = engine.Render(ctx, "hello", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello tom", string(data))
+}
+
+func TestGoTemplateEngine_Concurrent(t *testing.T) {
+	tpl, err := template.New("page").Funcs(template.FuncMap{
+		"user":  func() string { return "" },
+		"greet": func(name string, times int64) string { return "" },
+	}).Parse(`{{ user }} {{ greet "hi" 2 }}`)
+	require.NoError(t, err)
+	engine := &GoTemplateEngine{T: tpl}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := "<u" + strconv.Itoa(i) + ">"
+			ctx := WithTemplateFuncs(context.Background(), template.FuncMap{
+				"user": func() string { return user },
+				"greet": func(name string, times int64) string {
+					return strings.Repeat(name, int(times))
+				},
+			})
+			// every rendering clones the unexecuted base with its own functions
+			for j := 0; j < 8; j++ {
+				data, err := engine.Render(ctx, "page", nil)
+				assert.NoError(t, err)
+				assert.Equal(t, template.HTMLEscapeString(user)+" hihi", string(data))
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx := WithTemplateFuncs(context.Background(), template.FuncMap{
+		"greet": func(name string) string { return name },
+	})
+	_, err = engine.Render(ctx, "page", nil)
+	assert.ErrorContains(t, err, "wrong number of args for greet: want 1 got 2")
+}
@@ -0,0 +1,532 @@
+// Package tus implements resumable uploads of tus protocol 1.0.0
+// with creation, expiration and termination extensions:
+//
+//	POST   /files      creates upload by Upload-Length and Upload-Metadata, Location is responded
+//	PATCH  /files/:id  appends chunk at Upload-Offset
+//	HEAD   /files/:id  queries Upload-Offset
+//	DELETE /files/:id  terminates upload
+//
+// chunks are stored as objects of storage.Storage, they are assembled into one file atomically
+// after the last chunk received, so that nodes sharing Storage, Store and Locker could serve the same upload
+package tus
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Version    = "1.0.0"
+	Extensions = "creation,expiration,termination"
+)
+
+// errChunkTooLarge is returned by reader of chunk exceeding Upload-Length
+var errChunkTooLarge = errors.New("tus: chunk exceeds upload length")
+
+// Router is implemented by web.HTTPServer and web.RouterGroup
+type Router interface {
+	Post(path string, handler web.Handler) *web.Route
+	Head(path string, handler web.Handler) *web.Route
+	Patch(path string, handler web.Handler) *web.Route
+	Delete(path string, handler web.Handler) *web.Route
+	Options(path string, handler web.Handler) *web.Route
+}
+
+// Handler serves resumable uploads
+type Handler struct {
+	storage    storage.Storage
+	store      Store
+	locker     Locker
+	maxSize    int64
+	expiration time.Duration
+	prefix     string
+	key        func(upload *Upload) string
+	onComplete func(ctx *web.Context, file web.UploadedFile)
+	now        func() time.Time
+}
+
+// NewHandler stores chunks and assembled files in st and states of uploads in store
+func NewHandler(st storage.Storage, store Store) *Handler {
+	return &Handler{
+		storage:    st,
+		store:      store,
+		locker:     newLocalLocker(),
+		expiration: 24 * time.Hour,
+		prefix:     "tus",
+		key: func(upload *Upload) string {
+			return path.Join("file", "upload", upload.ID, web.SanitizeFilename(upload.Metadata["filename"]))
+		},
+		now: time.Now,
+	}
+}
+
+// MaxSize limits Upload-Length, unlimited if 0
+func (h *Handler) MaxSize(size int64) *Handler {
+	h.maxSize = size
+	return h
+}
+
+// Expiration is the lifetime of incomplete uploads since the last chunk, default 24h
+func (h *Handler) Expiration(expiration time.Duration) *Handler {
+	h.expiration = expiration
+	return h
+}
+
+// Locker replaces the in process locker
+func (h *Handler) Locker(locker Locker) *Handler {
+	h.locker = locker
+	return h
+}
+
+// ChunkPrefix is the storage key prefix of chunks, default "tus"
+func (h *Handler) ChunkPrefix(prefix string) *Handler {
+	h.prefix = prefix
+	return h
+}
+
+// Key returns storage key of assembled file, default file/upload/<id>/<filename>
+func (h *Handler) Key(key func(upload *Upload) string) *Handler {
+	h.key = key
+	return h
+}
+
+// OnComplete is called after file assembled, Field of file is empty
+func (h *Handler) OnComplete(onComplete func(ctx *web.Context, file web.UploadedFile)) *Handler {
+	h.onComplete = onComplete
+	return h
+}
+
+// Register registers routes of uploads under prefix, such as /files
+func (h *Handler) Register(r Router, prefix string) {
+	r.Options(prefix, h.options)
+	r.Post(prefix, h.resumable(h.create))
+	r.Options(prefix+"/:id", h.options)
+	r.Head(prefix+"/:id", h.resumable(h.head))
+	r.Patch(prefix+"/:id", h.resumable(h.patch))
+	r.Delete(prefix+"/:id", h.resumable(h.delete))
+}
+
+func (h *Handler) options(ctx *web.Context) {
+	header := ctx.Resp.Header()
+	header.Set("Tus-Resumable", Version)
+	header.Set("Tus-Version", Version)
+	header.Set("Tus-Extension", Extensions)
+	if h.maxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	}
+	ctx.RespCode = http.StatusNoContent
+}
+
+// resumable rejects requests of other versions
+func (h *Handler) resumable(next web.Handler) web.Handler {
+	return func(ctx *web.Context) {
+		header := ctx.Resp.Header()
+		header.Set("Tus-Resumable", Version)
+		if ctx.Req.Header.Get("Tus-Resumable") != Version {
+			header.Set("Tus-Version", Version)
+			ctx.SetError(web.NewHTTPError(http.StatusPreconditionFailed, "unsupported tus version"))
+			return
+		}
+		next(ctx)
+	}
+}
+
+func (h *Handler) create(ctx *web.Context) {
+	size, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		ctx.SetError(web.NewHTTPError(http.StatusBadRequest, "invalid Upload-Length"))
+		return
+	}
+	if h.maxSize > 0 && size > h.maxSize {
+		ctx.SetError(web.NewHTTPError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("upload exceeds %d bytes", h.maxSize)))
+		return
+	}
+	metadata, err := parseMetadata(ctx.Req.Header.Get("Upload-Metadata"))
+	if err != nil {
+		ctx.SetError(&web.HTTPError{Status: http.StatusBadRequest, Detail: "invalid Upload-Metadata", Err: err})
+		return
+	}
+	upload := &Upload{
+		ID:        strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Size:      size,
+		Metadata:  metadata,
+		ExpiresAt: h.now().Add(h.expiration),
+	}
+	if size == 0 {
+		// nothing to wait for
+		if err = h.complete(ctx, upload); err != nil {
+			ctx.SetError(err)
+			return
+		}
+	} else if err = h.store.Save(ctx.Req.Context(), upload); err != nil {
+		ctx.SetError(err)
+		return
+	}
+	header := ctx.Resp.Header()
+	header.Set("Location", path.Join(ctx.Req.URL.Path, upload.ID))
+	header.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	ctx.RespCode = http.StatusCreated
+}
+
+func (h *Handler) head(ctx *web.Context) {
+	upload, ok := h.get(ctx)
+	if !ok {
+		return
+	}
+	header := ctx.Resp.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if len(upload.Metadata) > 0 {
+		header.Set("Upload-Metadata", formatMetadata(upload.Metadata))
+	}
+	if !upload.completed() {
+		header.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	ctx.RespCode = http.StatusOK
+}
+
+func (h *Handler) patch(ctx *web.Context) {
+	if ctx.Req.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		ctx.SetError(web.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(ctx.Req.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		ctx.SetError(web.NewHTTPError(http.StatusBadRequest, "invalid Upload-Offset"))
+		return
+	}
+	unlock, ok := h.lock(ctx)
+	if !ok {
+		return
+	}
+	defer unlock()
+	upload, ok := h.get(ctx)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		ctx.SetError(web.NewHTTPError(http.StatusConflict,
+			fmt.Sprintf("Upload-Offset %d does not match %d", offset, upload.Offset)))
+		return
+	}
+	if ctx.Req.ContentLength > upload.Size-upload.Offset {
+		ctx.SetError(web.NewHTTPError(http.StatusRequestEntityTooLarge, errChunkTooLarge.Error()))
+		return
+	}
+	if !upload.completed() {
+		if err = h.receive(ctx, upload); err != nil {
+			ctx.SetError(err)
+			return
+		}
+	}
+	if upload.Offset == upload.Size && !upload.completed() {
+		if err = h.complete(ctx, upload); err != nil {
+			// chunks are kept, the last PATCH could be retried with empty body
+			ctx.SetError(err)
+			return
+		}
+	}
+	header := ctx.Resp.Header()
+	header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if !upload.completed() {
+		header.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	ctx.RespCode = http.StatusNoContent
+}
+
+// receive stores body as a chunk, bytes received before connection broken are kept
+func (h *Handler) receive(ctx *web.Context, upload *Upload) error {
+	reader := &chunkReader{reader: ctx.Req.Body, remaining: upload.Size - upload.Offset}
+	key := h.chunkKey(upload.ID, upload.Offset)
+	err := h.storage.Put(ctx.Req.Context(), key, reader, -1, "application/octet-stream")
+	if errors.Is(err, errChunkTooLarge) {
+		return web.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if reader.read == 0 {
+		return h.storage.Delete(ctx.Req.Context(), key)
+	}
+	upload.Chunks = append(upload.Chunks, upload.Offset)
+	upload.Offset += reader.read
+	upload.ExpiresAt = h.now().Add(h.expiration)
+	return h.store.Save(ctx.Req.Context(), upload)
+}
+
+// complete assembles chunks into file, the state is kept until expired so that HEAD reports completion
+func (h *Handler) complete(ctx *web.Context, upload *Upload) error {
+	keys := make([]string, 0, len(upload.Chunks))
+	for _, offset := range upload.Chunks {
+		keys = append(keys, h.chunkKey(upload.ID, offset))
+	}
+	chunks := &chunksReader{ctx: ctx.Req.Context(), storage: h.storage, keys: keys}
+	defer func() {
+		_ = chunks.Close()
+	}()
+	reader := bufio.NewReaderSize(chunks, 512)
+	head, err := reader.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	file := web.UploadedFile{
+		Filename:    web.SanitizeFilename(upload.Metadata["filename"]),
+		Key:         h.key(upload),
+		Size:        upload.Size,
+		ContentType: http.DetectContentType(head),
+	}
+	hash := sha256.New()
+	counter := &countWriter{}
+	body := io.TeeReader(reader, io.MultiWriter(hash, counter))
+	if err = h.storage.Put(ctx.Req.Context(), file.Key, body, upload.Size, file.ContentType); err != nil {
+		return err
+	}
+	if counter.n != upload.Size {
+		// chunk lost, such as removed from storage by others
+		_ = h.storage.Delete(ctx.Req.Context(), file.Key)
+		return fmt.Errorf("tus: assembled %d bytes of upload %s, expect %d", counter.n, upload.ID, upload.Size)
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	upload.Key = file.Key
+	if err = h.store.Save(ctx.Req.Context(), upload); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = h.storage.Delete(ctx.Req.Context(), key); err != nil {
+			// removed by Cleanup after expired
+			slog.Default().WarnContext(ctx.Req.Context(), "tus: failed to delete chunk",
+				slog.String("key", key), slog.Any("error", err))
+		}
+	}
+	if h.onComplete != nil {
+		h.onComplete(ctx, file)
+	}
+	return nil
+}
+
+func (h *Handler) delete(ctx *web.Context) {
+	unlock, ok := h.lock(ctx)
+	if !ok {
+		return
+	}
+	defer unlock()
+	upload, ok := h.get(ctx)
+	if !ok {
+		return
+	}
+	if err := h.remove(ctx.Req.Context(), upload); err != nil {
+		ctx.SetError(err)
+		return
+	}
+	ctx.RespCode = http.StatusNoContent
+}
+
+// remove deletes chunks and state of upload, assembled file is kept
+func (h *Handler) remove(ctx context.Context, upload *Upload) error {
+	if !upload.completed() {
+		// chunks are listed rather than taken from state, which is empty if evicted by cache
+		chunks, err := h.storage.List(ctx, h.prefix+"/"+upload.ID)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			if err = h.storage.Delete(ctx, chunk.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return h.store.Delete(ctx, upload.ID)
+}
+
+// Cleanup removes expired uploads and returns the number of them, call it periodically
+func (h *Handler) Cleanup(ctx context.Context) (int, error) {
+	uploads, err := h.store.Expired(ctx, h.now())
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, upload := range uploads {
+		unlock, err := h.locker.Lock(ctx, upload.ID)
+		if err != nil {
+			return 0, err
+		}
+		errs = append(errs, h.remove(ctx, upload))
+		unlock()
+	}
+	return len(uploads), errors.Join(errs...)
+}
+
+// CleanupEvery calls Cleanup every interval until ctx done, it is used as a start hook:
+//
+//	web.ServerWithOnStart(func(ctx context.Context) error {
+//		go handler.CleanupEvery(cleanupCtx, time.Hour)
+//		return nil
+//	})
+func (h *Handler) CleanupEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := h.Cleanup(ctx); err != nil {
+				slog.Default().ErrorContext(ctx, "tus: failed to clean up uploads", slog.Any("error", err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Handler) lock(ctx *web.Context) (func(), bool) {
+	id, _ := ctx.PathValue("id").String()
+	unlock, err := h.locker.Lock(ctx.Req.Context(), id)
+	if err != nil {
+		ctx.SetError(err)
+		return nil, false
+	}
+	return unlock, true
+}
+
+// get finds upload of path, 404 or 410 is set if absent or expired
+func (h *Handler) get(ctx *web.Context) (*Upload, bool) {
+	id, _ := ctx.PathValue("id").String()
+	upload, err := h.store.Get(ctx.Req.Context(), id)
+	if errors.Is(err, ErrUploadNotFound) {
+		ctx.SetError(web.NewHTTPError(http.StatusNotFound, "upload not found"))
+		return nil, false
+	}
+	if err != nil {
+		ctx.SetError(err)
+		return nil, false
+	}
+	if !upload.completed() && upload.ExpiresAt.Before(h.now()) {
+		ctx.SetError(web.NewHTTPError(http.StatusGone, "upload expired"))
+		return nil, false
+	}
+	return upload, true
+}
+
+// chunkKey is ordered by offset
+func (h *Handler) chunkKey(id string, offset int64) string {
+	return fmt.Sprintf("%s/%s/%020d", h.prefix, id, offset)
+}
+
+// chunkReader fails with errChunkTooLarge if more than remaining bytes are sent,
+// other errors of reading are turned into EOF so that received bytes are stored
+type chunkReader struct {
+	reader    io.Reader
+	remaining int64
+	read      int64
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.read += int64(n)
+	if c.read > c.remaining {
+		return n, errChunkTooLarge
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		// connection broken, client resumes from the offset of HEAD
+		return n, io.EOF
+	}
+	return n, err
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// chunksReader reads chunks in order, each chunk is opened after the previous one drained
+type chunksReader struct {
+	ctx     context.Context
+	storage storage.Storage
+	keys    []string
+	current io.ReadCloser
+}
+
+func (c *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.keys) == 0 {
+				return 0, io.EOF
+			}
+			reader, _, err := c.storage.Get(c.ctx, c.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			c.current, c.keys = reader, c.keys[1:]
+		}
+		n, err := c.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			err = c.current.Close()
+			c.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *chunksReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
+
+// parseMetadata decodes Upload-Metadata: key base64(value),key
+func parseMetadata(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, nil
+	}
+	res := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("tus: empty metadata key")
+		}
+		data, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return nil, err
+		}
+		res[key] = string(data)
+	}
+	return res, nil
+}
+
+func formatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, val := range metadata {
+		if val == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(val)))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,301 @@
+package tus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/CoucouMonEcho/go-framework/cache"
+	"github.com/CoucouMonEcho/go-framework/web"
+	"github.com/CoucouMonEcho/go-framework/web/storage"
+	"github.com/CoucouMonEcho/go-framework/web/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+type testServer struct {
+	server  *web.HTTPServer
+	handler *Handler
+	storage *memory.Storage
+	store   *CacheStore
+	files   []web.UploadedFile
+}
+
+func newTestServer() *testServer {
+	res := &testServer{
+		server:  web.NewHTTPServer(),
+		storage: memory.NewStorage(),
+		store:   NewCacheStore(cache.NewBuildInMapCache(time.Hour), "tus:"),
+	}
+	res.handler = NewHandler(res.storage, res.store).MaxSize(1024).
+		OnComplete(func(ctx *web.Context, file web.UploadedFile) {
+			res.files = append(res.files, file)
+		})
+	res.handler.Register(res.server.Group("/api"), "/files")
+	return res
+}
+
+func (s *testServer) do(method string, path string, body io.Reader, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Tus-Resumable", Version)
+	for key, val := range header {
+		req.Header.Set(key, val)
+	}
+	recorder := httptest.NewRecorder()
+	s.server.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (s *testServer) create(t *testing.T, size int) string {
+	recorder := s.do(http.MethodPost, "/api/files", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(size),
+		"Upload-Metadata": "filename cmVwb3J0LnR4dA==,filetype dGV4dC9wbGFpbg==,private",
+	})
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	return recorder.Header().Get("Location")
+}
+
+func (s *testServer) patch(location string, offset int, body io.Reader) *httptest.ResponseRecorder {
+	return s.do(http.MethodPatch, location, body, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func TestHandler(t *testing.T) {
+	s := newTestServer()
+	data := []byte(strings.Repeat("hello tus\n", 30))
+
+	recorder := s.do(http.MethodOptions, "/api/files", nil, nil)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, Version, recorder.Header().Get("Tus-Version"))
+	assert.Equal(t, Extensions, recorder.Header().Get("Tus-Extension"))
+	assert.Equal(t, "1024", recorder.Header().Get("Tus-Max-Size"))
+
+	location := s.create(t, len(data))
+	assert.True(t, strings.HasPrefix(location, "/api/files/"))
+	id := strings.TrimPrefix(location, "/api/files/")
+
+	recorder = s.patch(location, 0, bytes.NewReader(data[:100]))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "100", recorder.Header().Get("Upload-Offset"))
+	assert.NotEmpty(t, recorder.Header().Get("Upload-Expires"))
+
+	// connection broken after 50 bytes, received bytes are kept
+	recorder = s.patch(location, 100, iotest.TimeoutReader(bytes.NewReader(data[100:150])))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = s.do(http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	offset, err := strconv.Atoi(recorder.Header().Get("Upload-Offset"))
+	require.NoError(t, err)
+	assert.Greater(t, offset, 100)
+	assert.Equal(t, strconv.Itoa(len(data)), recorder.Header().Get("Upload-Length"))
+	assert.Contains(t, recorder.Header().Get("Upload-Metadata"), "filename cmVwb3J0LnR4dA==")
+
+	// stale offset
+	recorder = s.patch(location, 100, bytes.NewReader(data[100:]))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = s.patch(location, offset, bytes.NewReader(data[offset:]))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, strconv.Itoa(len(data)), recorder.Header().Get("Upload-Offset"))
+
+	sum := sha256.Sum256(data)
+	key := "file/upload/" + id + "/report.txt"
+	require.Len(t, s.files, 1)
+	assert.Equal(t, web.UploadedFile{Filename: "report.txt", Key: key, Size: int64(len(data)),
+		ContentType: "text/plain; charset=utf-8", SHA256: hex.EncodeToString(sum[:])}, s.files[0])
+	reader, obj, err := s.storage.Get(context.Background(), key)
+	require.NoError(t, err)
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Equal(t, "text/plain; charset=utf-8", obj.ContentType)
+	for _, chunk := range []int{0, 100, offset} {
+		_, err = s.storage.Stat(context.Background(), s.handler.chunkKey(id, int64(chunk)))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+
+	// completed upload is still reported
+	recorder = s.do(http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, strconv.Itoa(len(data)), recorder.Header().Get("Upload-Offset"))
+	recorder = s.patch(location, len(data), bytes.NewReader([]byte("more")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	recorder = s.patch(location, len(data), http.NoBody)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Len(t, s.files, 1)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	s := newTestServer()
+	location := s.create(t, 10)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   map[string]string
+		wantCode int
+	}{
+		{
+			name:     "unsupported version",
+			method:   http.MethodPost,
+			path:     "/api/files",
+			header:   map[string]string{"Tus-Resumable": "0.2.2", "Upload-Length": "10"},
+			wantCode: http.StatusPreconditionFailed,
+		},
+		{
+			name:     "missing length",
+			method:   http.MethodPost,
+			path:     "/api/files",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "too large",
+			method:   http.MethodPost,
+			path:     "/api/files",
+			header:   map[string]string{"Upload-Length": "1025"},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "invalid metadata",
+			method:   http.MethodPost,
+			path:     "/api/files",
+			header:   map[string]string{"Upload-Length": "10", "Upload-Metadata": "filename !!!"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "not found",
+			method:   http.MethodHead,
+			path:     "/api/files/missing",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "content type",
+			method:   http.MethodPatch,
+			path:     location,
+			body:     "0123456789",
+			header:   map[string]string{"Content-Type": "application/octet-stream", "Upload-Offset": "0"},
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "missing offset",
+			method:   http.MethodPatch,
+			path:     location,
+			body:     "0123456789",
+			header:   map[string]string{"Content-Type": "application/offset+octet-stream"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "chunk too large",
+			method:   http.MethodPatch,
+			path:     location,
+			body:     "0123456789a",
+			header:   map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := s.do(tc.method, tc.path, strings.NewReader(tc.body), tc.header)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, Version, recorder.Header().Get("Tus-Resumable"))
+		})
+	}
+
+	// chunk of unknown length exceeding upload length is not stored
+	req := httptest.NewRequest(http.MethodPatch, location, strings.NewReader("0123456789a"))
+	req.ContentLength = -1
+	req.Header.Set("Tus-Resumable", Version)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	recorder := httptest.NewRecorder()
+	s.server.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	recorder = s.do(http.MethodHead, location, nil, nil)
+	assert.Equal(t, "0", recorder.Header().Get("Upload-Offset"))
+}
+
+func TestHandler_Empty(t *testing.T) {
+	s := newTestServer()
+	location := s.create(t, 0)
+	recorder := s.do(http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "0", recorder.Header().Get("Upload-Offset"))
+	require.Len(t, s.files, 1)
+	assert.Equal(t, int64(0), s.files[0].Size)
+}
+
+func TestHandler_Terminate(t *testing.T) {
+	s := newTestServer()
+	location := s.create(t, 10)
+	id := strings.TrimPrefix(location, "/api/files/")
+	recorder := s.patch(location, 0, strings.NewReader("01234"))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = s.do(http.MethodDelete, location, nil, nil)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	_, err := s.storage.Stat(context.Background(), s.handler.chunkKey(id, 0))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	recorder = s.do(http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = s.do(http.MethodDelete, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHandler_Cleanup(t *testing.T) {
+	s := newTestServer()
+	now := time.Now()
+	s.handler.now = func() time.Time {
+		return now
+	}
+	expired := s.create(t, 10)
+	expiredID := strings.TrimPrefix(expired, "/api/files/")
+	assert.Equal(t, http.StatusNoContent, s.patch(expired, 0, strings.NewReader("01234")).Code)
+	completed := s.create(t, 5)
+	assert.Equal(t, http.StatusNoContent, s.patch(completed, 0, strings.NewReader("01234")).Code)
+	// state evicted by cache, only the index is left
+	evicted := s.create(t, 10)
+	evictedID := strings.TrimPrefix(evicted, "/api/files/")
+	assert.Equal(t, http.StatusNoContent, s.patch(evicted, 0, strings.NewReader("01234")).Code)
+	require.NoError(t, s.store.cache.Del(context.Background(), "tus:"+evictedID))
+
+	now = now.Add(25 * time.Hour)
+	active := s.create(t, 10)
+
+	recorder := s.do(http.MethodHead, expired, nil, nil)
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	recorder = s.patch(expired, 5, strings.NewReader("56789"))
+	assert.Equal(t, http.StatusGone, recorder.Code)
+
+	n, err := s.handler.Cleanup(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	for _, id := range []string{expiredID, evictedID} {
+		_, err = s.storage.Stat(context.Background(), s.handler.chunkKey(id, 0))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+	// assembled file is kept
+	_, err = s.storage.Stat(context.Background(), s.files[0].Key)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodHead, expired, nil, nil).Code)
+	assert.Equal(t, http.StatusNotFound, s.do(http.MethodHead, completed, nil, nil).Code)
+	assert.Equal(t, http.StatusOK, s.do(http.MethodHead, active, nil, nil).Code)
+
+	n, err = s.handler.Cleanup(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
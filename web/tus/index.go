@@ -0,0 +1,94 @@
+package tus
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Index keeps ids and expiration of uploads for CacheStore.Expired,
+// updates must be atomic across nodes sharing the store
+type Index interface {
+	Add(ctx context.Context, id string, expiresAt time.Time) error
+	Remove(ctx context.Context, id string) error
+	// Before returns ids expiring before t with their expiration
+	Before(ctx context.Context, t time.Time) (map[string]time.Time, error)
+}
+
+var _ Index = &localIndex{}
+
+// localIndex keeps ids in process, it is only suitable for a single node
+type localIndex struct {
+	mutex sync.RWMutex
+	ids   map[string]time.Time
+}
+
+func newLocalIndex() *localIndex {
+	return &localIndex{ids: make(map[string]time.Time)}
+}
+
+func (l *localIndex) Add(_ context.Context, id string, expiresAt time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.ids[id] = expiresAt
+	return nil
+}
+
+func (l *localIndex) Remove(_ context.Context, id string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.ids, id)
+	return nil
+}
+
+func (l *localIndex) Before(_ context.Context, t time.Time) (map[string]time.Time, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	res := make(map[string]time.Time)
+	for id, expiresAt := range l.ids {
+		if expiresAt.Before(t) {
+			res[id] = expiresAt
+		}
+	}
+	return res, nil
+}
+
+var _ Index = &RedisIndex{}
+
+// RedisIndex keeps ids in a sorted set scored by expiration in milliseconds,
+// every update is a single command so that nodes never lose uploads of each other
+type RedisIndex struct {
+	client redis.Cmdable
+	key    string
+}
+
+func NewRedisIndex(client redis.Cmdable, key string) *RedisIndex {
+	return &RedisIndex{client: client, key: key}
+}
+
+func (r *RedisIndex) Add(ctx context.Context, id string, expiresAt time.Time) error {
+	return r.client.ZAdd(ctx, r.key, redis.Z{Score: float64(expiresAt.UnixMilli()), Member: id}).Err()
+}
+
+func (r *RedisIndex) Remove(ctx context.Context, id string) error {
+	return r.client.ZRem(ctx, r.key, id).Err()
+}
+
+func (r *RedisIndex) Before(ctx context.Context, t time.Time) (map[string]time.Time, error) {
+	members, err := r.client.ZRangeByScoreWithScores(ctx, r.key, &redis.ZRangeBy{
+		Min: "-inf",
+		// exclusive
+		Max: "(" + strconv.FormatInt(t.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]time.Time, len(members))
+	for _, member := range members {
+		id, _ := member.Member.(string)
+		res[id] = time.UnixMilli(int64(member.Score))
+	}
+	return res, nil
+}
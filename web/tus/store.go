@@ -0,0 +1,182 @@
+package tus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/CoucouMonEcho/go-framework/cache"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// ErrUploadNotFound is returned by Store if upload does not exist
+var ErrUploadNotFound = errors.New("tus: upload not found")
+
+// Upload is the state of a resumable upload
+type Upload struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	// Metadata is decoded Upload-Metadata, such as filename and filetype
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Chunks are offsets of received chunks in storage
+	Chunks []int64 `json:"chunks,omitempty"`
+	// Key is the storage key of assembled file, it is set after completed
+	Key       string    `json:"key,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (u *Upload) completed() bool {
+	return u.Key != ""
+}
+
+// Store keeps state of uploads, it is shared by nodes in multi-node deployments
+type Store interface {
+	Get(ctx context.Context, id string) (*Upload, error)
+	Save(ctx context.Context, upload *Upload) error
+	Delete(ctx context.Context, id string) error
+	// Expired returns uploads expired before now, they are removed by Handler.Cleanup
+	Expired(ctx context.Context, now time.Time) ([]*Upload, error)
+}
+
+var _ Store = &CacheStore{}
+
+// CacheStore keeps each upload as JSON under its own key of cache.Cache, such as cache.RedisCache,
+// ids are kept by Index for Expired, which is in process by default,
+// use RedisIndex in multi-node deployments
+type CacheStore struct {
+	cache  cache.Cache
+	prefix string
+	index  Index
+	// retention keeps state after expiration until Cleanup removes its chunks
+	retention time.Duration
+}
+
+func NewCacheStore(c cache.Cache, prefix string) *CacheStore {
+	return &CacheStore{cache: c, prefix: prefix, index: newLocalIndex(), retention: 24 * time.Hour}
+}
+
+// Index replaces the in process index
+func (s *CacheStore) Index(index Index) *CacheStore {
+	s.index = index
+	return s
+}
+
+func (s *CacheStore) Get(ctx context.Context, id string) (*Upload, error) {
+	val, err := s.cache.Get(ctx, s.prefix+id)
+	if errors.Is(err, cache.ErrKeyNotFound) || errors.Is(err, redis.Nil) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := &Upload{}
+	if err = json.Unmarshal([]byte(str(val)), res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *CacheStore) Save(ctx context.Context, upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(upload.ExpiresAt) + s.retention
+	if err = s.cache.Set(ctx, s.prefix+upload.ID, string(data), ttl); err != nil {
+		return err
+	}
+	return s.index.Add(ctx, upload.ID, upload.ExpiresAt)
+}
+
+func (s *CacheStore) Delete(ctx context.Context, id string) error {
+	if err := s.cache.Del(ctx, s.prefix+id); err != nil {
+		return err
+	}
+	return s.index.Remove(ctx, id)
+}
+
+func (s *CacheStore) Expired(ctx context.Context, now time.Time) ([]*Upload, error) {
+	expired, err := s.index.Before(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Upload
+	for id, expiresAt := range expired {
+		upload, err := s.Get(ctx, id)
+		if errors.Is(err, ErrUploadNotFound) {
+			// evicted by cache, only the index is left, chunks are listed by Handler.Cleanup
+			upload = &Upload{ID: id, ExpiresAt: expiresAt}
+		} else if err != nil {
+			return nil, err
+		}
+		res = append(res, upload)
+	}
+	return res, nil
+}
+
+// str converts value of cache, RedisCache returns string and BuildInMapCache returns what is set
+func str(val any) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// Locker serializes requests of the same upload,
+// use a distributed lock such as cache.Client of redis in multi-node deployments
+type Locker interface {
+	// Lock blocks until lock of id is held or ctx done, unlock releases it
+	Lock(ctx context.Context, id string) (unlock func(), err error)
+}
+
+var _ Locker = &localLocker{}
+
+// localLocker locks in process, mutex of id is released after the last holder
+type localLocker struct {
+	mutex sync.Mutex
+	locks map[string]*lockEntry
+}
+
+type lockEntry struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newLocalLocker() *localLocker {
+	return &localLocker{locks: make(map[string]*lockEntry)}
+}
+
+func (l *localLocker) Lock(ctx context.Context, id string) (func(), error) {
+	l.mutex.Lock()
+	entry, ok := l.locks[id]
+	if !ok {
+		entry = &lockEntry{ch: make(chan struct{}, 1)}
+		l.locks[id] = entry
+	}
+	entry.refs++
+	l.mutex.Unlock()
+
+	release := func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(l.locks, id)
+		}
+	}
+	select {
+	case entry.ch <- struct{}{}:
+		return func() {
+			<-entry.ch
+			release()
+		}, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,113 @@
+package tus
+
+import (
+	"context"
+	"errors"
+	"github.com/CoucouMonEcho/go-framework/cache"
+	"github.com/CoucouMonEcho/go-framework/cache/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCacheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewCacheStore(cache.NewBuildInMapCache(time.Hour), "tus:")
+	now := time.Now()
+
+	_, err := store.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+
+	upload := &Upload{ID: "1", Size: 10, Offset: 5, Metadata: map[string]string{"filename": "a.txt"},
+		Chunks: []int64{0}, ExpiresAt: now.Add(-time.Minute).Truncate(time.Second)}
+	require.NoError(t, store.Save(ctx, upload))
+	require.NoError(t, store.Save(ctx, &Upload{ID: "2", Size: 10, ExpiresAt: now.Add(time.Hour)}))
+	got, err := store.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, upload.Metadata, got.Metadata)
+	assert.Equal(t, upload.Chunks, got.Chunks)
+	assert.True(t, upload.ExpiresAt.Equal(got.ExpiresAt))
+
+	expired, err := store.Expired(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "1", expired[0].ID)
+
+	require.NoError(t, store.Delete(ctx, "1"))
+	_, err = store.Get(ctx, "1")
+	assert.ErrorIs(t, err, ErrUploadNotFound)
+	expired, err = store.Expired(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "2", expired[0].ID)
+}
+
+// failingCache fails reading like an unreachable redis
+type failingCache struct {
+	cache.Cache
+}
+
+func (f failingCache) Get(context.Context, string) (any, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestCacheStore_Errors(t *testing.T) {
+	ctx := context.Background()
+	store := NewCacheStore(failingCache{Cache: cache.NewBuildInMapCache(time.Hour)}, "tus:")
+	require.NoError(t, store.Save(ctx, &Upload{ID: "1", Size: 10, ExpiresAt: time.Now().Add(-time.Minute)}))
+
+	_, err := store.Get(ctx, "1")
+	assert.EqualError(t, err, "connection refused")
+	// outage is not taken as eviction
+	_, err = store.Expired(ctx, time.Now())
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestRedisIndex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	expiresAt := time.UnixMilli(1700000000123)
+	client := mocks.NewMockCmdable(ctrl)
+	client.EXPECT().ZAdd(ctx, "tus:index", redis.Z{Score: 1700000000123, Member: "1"}).
+		Return(redis.NewIntResult(1, nil))
+	client.EXPECT().ZRem(ctx, "tus:index", "1").Return(redis.NewIntResult(1, nil))
+	client.EXPECT().ZRangeByScoreWithScores(ctx, "tus:index", &redis.ZRangeBy{Min: "-inf", Max: "(1700000000124"}).
+		Return(redis.NewZSliceCmdResult([]redis.Z{{Score: 1700000000123, Member: "1"}}, nil))
+	client.EXPECT().ZRangeByScoreWithScores(ctx, "tus:index", gomock.Any()).
+		Return(redis.NewZSliceCmdResult(nil, errors.New("connection refused")))
+
+	index := NewRedisIndex(client, "tus:index")
+	require.NoError(t, index.Add(ctx, "1", expiresAt))
+	require.NoError(t, index.Remove(ctx, "1"))
+	expired, err := index.Before(ctx, expiresAt.Add(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"1": expiresAt}, expired)
+	_, err = index.Before(ctx, expiresAt)
+	assert.Error(t, err)
+}
+
+func TestLocalLocker(t *testing.T) {
+	locker := newLocalLocker()
+	unlock, err := locker.Lock(context.Background(), "1")
+	require.NoError(t, err)
+
+	// other uploads are not blocked
+	unlock2, err := locker.Lock(context.Background(), "2")
+	require.NoError(t, err)
+	unlock2()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(ctx, "1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	unlock()
+	unlock, err = locker.Lock(context.Background(), "1")
+	require.NoError(t, err)
+	unlock()
+	assert.Empty(t, locker.locks)
+}
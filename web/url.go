@@ -0,0 +1,134 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+// Route is returned by route registration for further settings
+type Route struct {
+	router  *router
+	pattern string
+	nodes   []*node
+}
+
+// Name names the route for URLFor,
+// it panics if the name has been used by another pattern
+func (r *Route) Name(name string) *Route {
+	if name == "" {
+		panic("web: empty route name")
+	}
+	if pattern, ok := r.router.names[name]; ok && pattern != r.pattern {
+		panic(fmt.Sprintf("web: route name '%s' already used by '%s'", name, pattern))
+	}
+	r.router.names[name] = r.pattern
+	for _, n := range r.nodes {
+		n.name = name
+	}
+	return r
+}
+
+// URLFor builds the url of the named route,
+// params fill path params, regular params must match their expressions,
+// "*" fills the wildcard segment, which could contain '/' if wildcard is the last segment
+func (h *HTTPServer) URLFor(name string, params map[string]string, query url.Values) (string, error) {
+	return h.router.urlFor(name, params, query)
+}
+
+// TemplateFuncs returns functions for templates, parse templates with them to use:
+//
+//	urlFor "user.detail" "id" 12 "tab" "posts"
+//
+// arguments after name are key-value pairs, keys are path params or query params otherwise
+func (h *HTTPServer) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"urlFor": h.templateURLFor,
+	}
+}
+
+func (h *HTTPServer) templateURLFor(name string, pairs ...any) (string, error) {
+	if len(pairs)%2 != 0 {
+		return "", errors.New("web: urlFor needs key-value pairs")
+	}
+	pattern, ok := h.router.names[name]
+	if !ok {
+		return "", fmt.Errorf("web: route '%s' not found", name)
+	}
+	paramNames := make(map[string]bool)
+	for _, seg := range strings.Split(pattern, "/") {
+		if key := segmentParam(seg); key != "" {
+			paramNames[key] = true
+		}
+	}
+	params := make(map[string]string)
+	query := url.Values{}
+	for i := 0; i < len(pairs); i += 2 {
+		key := fmt.Sprint(pairs[i])
+		val := fmt.Sprint(pairs[i+1])
+		if paramNames[key] {
+			params[key] = val
+		} else {
+			query.Add(key, val)
+		}
+	}
+	return h.router.urlFor(name, params, query)
+}
+
+func (r *router) urlFor(name string, params map[string]string, query url.Values) (string, error) {
+	pattern, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("web: route '%s' not found", name)
+	}
+	segs := strings.Split(pattern, "/")[1:]
+	var builder strings.Builder
+	for i, seg := range segs {
+		builder.WriteByte('/')
+		key := segmentParam(seg)
+		if key == "" {
+			builder.WriteString(seg)
+			continue
+		}
+		val, ok := params[key]
+		if !ok || val == "" {
+			return "", fmt.Errorf("web: route '%s' needs param '%s'", name, key)
+		}
+		if _, _, constraint := parseSegment(seg); constraint != nil {
+			if _, ok = constraint.match(val); !ok {
+				return "", fmt.Errorf("web: param '%s' of route '%s' does not match %s", key, name, constraint.expr)
+			}
+		}
+		if key == "*" && i == len(segs)-1 {
+			// the last wildcard matches the rest path
+			pieces := strings.Split(strings.Trim(val, "/"), "/")
+			for j, piece := range pieces {
+				pieces[j] = url.PathEscape(piece)
+			}
+			builder.WriteString(strings.Join(pieces, "/"))
+			continue
+		}
+		builder.WriteString(url.PathEscape(val))
+	}
+	if builder.Len() == 0 {
+		builder.WriteByte('/')
+	}
+	if len(query) > 0 {
+		builder.WriteString("?" + query.Encode())
+	}
+	return builder.String(), nil
+}
+
+// segmentParam returns param name of segment,
+// the name of wildcard is "*", name is empty for static segment
+func segmentParam(seg string) string {
+	typ, path, _ := parseSegment(seg)
+	switch typ {
+	case nodeTypeStatic:
+		return ""
+	case nodeTypeWildcard:
+		return path
+	}
+	return path[1:]
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestHTTPServer_URLFor(t *testing.T) {
+	h := NewHTTPServer()
+	h.Get("/", mockHandler).Name("index")
+	h.Get("/users/:id", mockHandler).Name("user.detail")
+	h.Put("/users/:id", mockHandler).Name("user.detail")
+	h.Group("/orders").Get("/:orderId([0-9]+)", mockHandler).Name("order.detail")
+	h.Get("/static/*", mockHandler).Name("static")
+	h.Any("/files/*/meta", mockHandler).Name("file.meta")
+
+	testCases := []struct {
+		name    string
+		route   string
+		params  map[string]string
+		query   url.Values
+		want    string
+		wantErr string
+	}{
+		{name: "root", route: "index", want: "/"},
+		{name: "path param", route: "user.detail", params: map[string]string{"id": "a b"}, query: url.Values{"tab": {"posts"}}, want: "/users/a%20b?tab=posts"},
+		{name: "regular", route: "order.detail", params: map[string]string{"orderId": "12"}, want: "/orders/12"},
+		{name: "regular not match", route: "order.detail", params: map[string]string{"orderId": "ab"}, wantErr: "web: param 'orderId' of route 'order.detail' does not match ([0-9]+)"},
+		{name: "last wildcard", route: "static", params: map[string]string{"*": "js/app.js"}, want: "/static/js/app.js"},
+		{name: "wildcard", route: "file.meta", params: map[string]string{"*": "a/b"}, want: "/files/a%2Fb/meta"},
+		{name: "missing param", route: "user.detail", wantErr: "web: route 'user.detail' needs param 'id'"},
+		{name: "not found", route: "none", wantErr: "web: route 'none' not found"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := h.URLFor(tc.route, tc.params, tc.query)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, res)
+		})
+	}
+
+	assert.Panics(t, func() {
+		h.Post("/users", mockHandler).Name("user.detail")
+	})
+	route, ok := h.router.route(http.MethodGet, "/users/1")
+	require.True(t, ok)
+	assert.Equal(t, "user.detail", route.node.name)
+}
+
+func TestHTTPServer_TemplateFuncs(t *testing.T) {
+	h := NewHTTPServer()
+	h.Get("/users/:id", mockHandler).Name("user.detail")
+	tpl, err := template.New("link").Funcs(h.TemplateFuncs()).
+		Parse(`<a href="{{urlFor "user.detail" "id" .ID "tab" "posts"}}">user</a>`)
+	require.NoError(t, err)
+	buffer := &bytes.Buffer{}
+	require.NoError(t, tpl.Execute(buffer, map[string]any{"ID": 12}))
+	assert.Equal(t, `<a href="/users/12?tab=posts">user</a>`, buffer.String())
+}
@@ -0,0 +1,331 @@
+package web
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes a field failed to bind or validate
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned by Bind and Validate with all failed fields
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", err.Field, err.Message))
+	}
+	return "web: invalid request " + strings.Join(msgs, "; ")
+}
+
+// regexpCache caches compiled expressions of regexp rule
+var regexpCache sync.Map
+
+// structRules caches checked rules of struct types, value is []fieldRules or error
+var structRules sync.Map
+
+// fieldRules are rules of validate tag on the field at index
+type fieldRules struct {
+	index int
+	name  string
+	rules []rule
+}
+
+type rule struct {
+	name  string
+	param string
+	// limit is parameter of min, max and len
+	limit float64
+	reg   *regexp.Regexp
+}
+
+// Validate checks exported fields of struct by validate tag,
+// nested structs and slices of structs are checked recursively,
+// rules are separated by comma and regexp must be the last rule as it may contain comma:
+//
+//	required      not zero value, not nil pointer, not empty slice or map
+//	min=n, max=n  number value, or length of string, slice and map
+//	len=n         length of string, slice and map
+//	oneof=a b c   value is one of space separated values
+//	email         valid email address
+//	regexp=expr   string matches expr entirely
+//
+// rules except required are skipped for nil pointer,
+// tags are checked when the struct type is first seen and misconfigured tag is returned as error
+func Validate(val any) error {
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs ValidationErrors
+	if err := validateStruct(v, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) error {
+	fields, err := rulesOf(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		name := prefix + field.name
+		fieldVal := v.Field(field.index)
+		for _, r := range field.rules {
+			if msg, ok := checkRule(fieldVal, r); !ok {
+				*errs = append(*errs, FieldError{Field: name, Rule: r.name, Message: msg})
+			}
+		}
+		if err = validateNested(fieldVal, name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateNested(v reflect.Value, name string, errs *ValidationErrors) error {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		return validateStruct(v, name+".", errs)
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateNested(v.Index(i), name+"["+strconv.Itoa(i)+"]", errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rulesOf returns rules of exported fields, tags are checked once for each type
+func rulesOf(typ reflect.Type) ([]fieldRules, error) {
+	if val, ok := structRules.Load(typ); ok {
+		if err, ok := val.(error); ok {
+			return nil, err
+		}
+		return val.([]fieldRules), nil
+	}
+	var res []fieldRules
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fr := fieldRules{index: i, name: fieldName(field)}
+		for _, pair := range parseRules(field.Tag.Get("validate")) {
+			r, err := newRule(field.Type, pair[0], pair[1])
+			if err != nil {
+				err = fmt.Errorf("web: invalid validate tag of %s.%s: %w", typ, field.Name, err)
+				structRules.Store(typ, err)
+				return nil, err
+			}
+			fr.rules = append(fr.rules, r)
+		}
+		res = append(res, fr)
+	}
+	structRules.Store(typ, res)
+	return res, nil
+}
+
+// newRule checks parameter of rule and whether type of field is supported
+func newRule(typ reflect.Type, name string, param string) (rule, error) {
+	res := rule{name: name, param: param}
+	if name == "required" {
+		return res, nil
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	kind := typ.Kind()
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return res, fmt.Errorf("invalid %s rule parameter %s", name, param)
+		}
+		res.limit = limit
+		if !measurable(kind) || (name == "len" && isNumber(kind)) {
+			return res, fmt.Errorf("%s rule does not support %s", name, typ)
+		}
+	case "oneof":
+	case "email", "regexp":
+		if kind != reflect.String {
+			return res, fmt.Errorf("%s rule does not support %s", name, typ)
+		}
+		if name == "regexp" {
+			reg, err := compileRegexp(param)
+			if err != nil {
+				return res, err
+			}
+			res.reg = reg
+		}
+	default:
+		return res, fmt.Errorf("unknown validate rule %s", name)
+	}
+	return res, nil
+}
+
+// parseRules returns pairs of rule name and parameter
+func parseRules(tag string) [][2]string {
+	var res [][2]string
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name != "" {
+			res = append(res, [2]string{name, param})
+		}
+	}
+	return res
+}
+
+// checkRule checks value by rule, which has been checked by newRule
+func checkRule(v reflect.Value, r rule) (string, bool) {
+	if r.name == "required" {
+		if isEmpty(v) {
+			return "is required", false
+		}
+		return "", true
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", true
+		}
+		v = v.Elem()
+	}
+	switch r.name {
+	case "min", "max":
+		size := measure(v)
+		if r.name == "min" && size < r.limit {
+			if isNumber(v.Kind()) {
+				return "must be at least " + r.param, false
+			}
+			return "length must be at least " + r.param, false
+		}
+		if r.name == "max" && size > r.limit {
+			if isNumber(v.Kind()) {
+				return "must be at most " + r.param, false
+			}
+			return "length must be at most " + r.param, false
+		}
+	case "len":
+		if measure(v) != r.limit {
+			return "length must be " + r.param, false
+		}
+	case "oneof":
+		if !slices.Contains(strings.Fields(r.param), fmt.Sprint(v.Interface())) {
+			return "must be one of [" + r.param + "]", false
+		}
+	case "email":
+		str := v.String()
+		if addr, err := mail.ParseAddress(str); err != nil || addr.Address != str {
+			return "must be a valid email", false
+		}
+	case "regexp":
+		if !r.reg.MatchString(v.String()) {
+			return "must match " + r.param, false
+		}
+	}
+	return "", true
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// measurable reports whether kind is number or has length
+func measurable(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+	return isNumber(kind)
+}
+
+// measure returns value of numbers or length of string, slice and map
+func measure(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String()))
+	}
+	return float64(v.Len())
+}
+
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if val, ok := regexpCache.Load(expr); ok {
+		return val.(*regexp.Regexp), nil
+	}
+	// match entirely
+	reg, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %s", expr)
+	}
+	regexpCache.Store(expr, reg)
+	return reg, nil
+}
+
+// fieldName returns name of field in request, tags are checked in order
+func fieldName(field reflect.StructField) string {
+	if _, name := bindSource(field); name != "" {
+		return name
+	}
+	for _, tag := range []string{"json", "xml"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
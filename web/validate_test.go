@@ -0,0 +1,122 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	type item struct {
+		SKU string `json:"sku" validate:"len=4"`
+	}
+	type order struct {
+		Email  string   `json:"email" validate:"email"`
+		Status string   `json:"status" validate:"oneof=paid unpaid"`
+		Code   string   `json:"code" validate:"regexp=^[a-z]{2,3}$"`
+		Count  int      `json:"count" validate:"min=1,max=10"`
+		Note   *string  `json:"note" validate:"max=3"`
+		Items  []item   `json:"items" validate:"required"`
+		Owner  *item    `json:"owner"`
+		Labels []string `json:"labels" validate:"max=2"`
+	}
+	note := "long note"
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr error
+	}{
+		{
+			name: "valid",
+			val: &order{Email: "tom@example.com", Status: "paid", Code: "abc", Count: 10,
+				Items: []item{{SKU: "a001"}}},
+		},
+		{
+			name: "invalid",
+			val: order{Email: "Tom <tom@example.com>", Status: "lost", Code: "abcd", Count: 0,
+				Note: &note, Items: []item{{SKU: "a1"}}, Owner: &item{SKU: "b1"}, Labels: []string{"a", "b", "c"}},
+			wantErr: ValidationErrors{
+				{Field: "email", Rule: "email", Message: "must be a valid email"},
+				{Field: "status", Rule: "oneof", Message: "must be one of [paid unpaid]"},
+				{Field: "code", Rule: "regexp", Message: "must match ^[a-z]{2,3}$"},
+				{Field: "count", Rule: "min", Message: "must be at least 1"},
+				{Field: "note", Rule: "max", Message: "length must be at most 3"},
+				{Field: "items[0].sku", Rule: "len", Message: "length must be 4"},
+				{Field: "owner.sku", Rule: "len", Message: "length must be 4"},
+				{Field: "labels", Rule: "max", Message: "length must be at most 2"},
+			},
+		},
+		{
+			name:    "required slice",
+			val:     &order{Email: "a@b.c", Status: "paid", Code: "ab", Count: 1},
+			wantErr: ValidationErrors{{Field: "items", Rule: "required", Message: "is required"}},
+		},
+		{
+			name: "not struct",
+			val:  "str",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantErr, Validate(tc.val))
+		})
+	}
+
+}
+
+func TestValidate_InvalidTag(t *testing.T) {
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name: "unknown rule",
+			val: struct {
+				Name string `validate:"unknown"`
+			}{},
+			wantErr: ".Name: unknown validate rule unknown",
+		},
+		{
+			name: "invalid parameter",
+			val: &struct {
+				Count *int `validate:"min=a"`
+			}{},
+			wantErr: "invalid min rule parameter a",
+		},
+		{
+			name: "unsupported type",
+			val: struct {
+				Count int `validate:"len=1"`
+			}{},
+			wantErr: "len rule does not support int",
+		},
+		{
+			name: "invalid regexp",
+			val: struct {
+				Code string `validate:"regexp=[a-"`
+			}{},
+			wantErr: "invalid regular expression [a-",
+		},
+		{
+			name: "nested",
+			val: struct {
+				Items []struct {
+					Created bool `validate:"email"`
+				}
+			}{Items: make([]struct {
+				Created bool `validate:"email"`
+			}, 1)},
+			wantErr: "email rule does not support bool",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// checked once and reported every time
+			for i := 0; i < 2; i++ {
+				err := Validate(tc.val)
+				assert.ErrorContains(t, err, tc.wantErr)
+				assert.NotErrorAs(t, err, new(ValidationErrors))
+			}
+		})
+	}
+}
@@ -0,0 +1,541 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// message types defined in RFC 6455
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// close codes defined in RFC 6455
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	continuationFrame = 0
+	// websocketGUID is used to compute Sec-WebSocket-Accept
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// maxControlPayload is the max payload length of control frames
+	maxControlPayload = 125
+)
+
+var errWebSocketClosed = errors.New("web: websocket connection closed")
+
+// CloseError is returned by WebSocketConn.ReadMessage when close frame received
+// or connection is closed because of protocol violation
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("web: websocket closed with code %d %s", e.Code, e.Text)
+}
+
+// WebSocketHandler handles upgraded connection,
+// connection is closed after handler returns
+type WebSocketHandler func(ctx *Context, conn *WebSocketConn)
+
+type WebSocketOption func(u *webSocketUpgrader)
+
+// WebSocketWithMaxMessageSize limits the size of a message after fragments assembled,
+// connection is closed with CloseMessageTooBig if exceeded
+func WebSocketWithMaxMessageSize(size int64) WebSocketOption {
+	return func(u *webSocketUpgrader) {
+		u.maxMessageSize = size
+	}
+}
+
+// WebSocketWithCheckOrigin replaces the default check,
+// which only allows requests without Origin or with Origin of the same host
+func WebSocketWithCheckOrigin(check func(req *http.Request) bool) WebSocketOption {
+	return func(u *webSocketUpgrader) {
+		u.checkOrigin = check
+	}
+}
+
+// WebSocketWithSubprotocols sets supported subprotocols in preference order
+func WebSocketWithSubprotocols(protocols ...string) WebSocketOption {
+	return func(u *webSocketUpgrader) {
+		u.subprotocols = protocols
+	}
+}
+
+// WebSocket registers handler on path for GET,
+// middlewares are executed before the upgrade as other routes
+func (h *HTTPServer) WebSocket(path string, handler WebSocketHandler, opts ...WebSocketOption) *Route {
+	return h.router.addRoute(http.MethodGet, path, newWebSocketUpgrader(h, opts).handle(handler))
+}
+
+func (g *RouterGroup) WebSocket(path string, handler WebSocketHandler, opts ...WebSocketOption) *Route {
+	return g.addRoute(http.MethodGet, path, newWebSocketUpgrader(g.server, opts).handle(handler))
+}
+
+type webSocketUpgrader struct {
+	server         *HTTPServer
+	maxMessageSize int64
+	checkOrigin    func(req *http.Request) bool
+	subprotocols   []string
+}
+
+func newWebSocketUpgrader(server *HTTPServer, opts []WebSocketOption) *webSocketUpgrader {
+	res := &webSocketUpgrader{
+		server:         server,
+		maxMessageSize: 1 << 20,
+		checkOrigin:    sameOrigin,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (u *webSocketUpgrader) handle(handler WebSocketHandler) Handler {
+	return func(ctx *Context) {
+		conn, err := u.upgrade(ctx)
+		if err != nil {
+			if ctx.RespCode == 0 {
+				ctx.RespCode = http.StatusBadRequest
+			}
+			ctx.RespData = []byte(err.Error())
+			return
+		}
+		// hijacked connections are not closed by http.Server.Shutdown
+		u.server.trackWebSocket(conn, true)
+		defer func() {
+			u.server.trackWebSocket(conn, false)
+			_ = conn.Close()
+		}()
+		handler(ctx, conn)
+	}
+}
+
+// upgrade validates the handshake of RFC 6455 section 4.2 and hijacks the connection
+func (u *webSocketUpgrader) upgrade(ctx *Context) (*WebSocketConn, error) {
+	req := ctx.Req
+	if !headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return nil, errors.New("web: not a websocket handshake")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Resp.Header().Set("Sec-WebSocket-Version", "13")
+		ctx.RespCode = http.StatusUpgradeRequired
+		return nil, errors.New("web: unsupported websocket version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, errors.New("web: invalid Sec-WebSocket-Key")
+	}
+	if !u.checkOrigin(req) {
+		ctx.RespCode = http.StatusForbidden
+		return nil, errors.New("web: websocket origin not allowed")
+	}
+	subprotocol := u.selectSubprotocol(req)
+
+	netConn, rw, err := http.NewResponseController(ctx.Resp).Hijack()
+	if err != nil {
+		ctx.RespCode = http.StatusInternalServerError
+		return nil, err
+	}
+	// response is taken over from now on
+	ctx.committed = true
+	ctx.RespCode = http.StatusSwitchingProtocols
+
+	// headers set by middlewares such as Set-Cookie of session are kept
+	header := ctx.Resp.Header().Clone()
+	for _, key := range []string{"Content-Length", "Content-Type", "Transfer-Encoding", "Sec-WebSocket-Protocol"} {
+		header.Del(key)
+	}
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", computeAcceptKey(key))
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	var builder strings.Builder
+	builder.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = header.Write(&builder)
+	builder.WriteString("\r\n")
+	// clear deadlines set by http.Server
+	_ = netConn.SetDeadline(time.Time{})
+	if _, err = netConn.Write([]byte(builder.String())); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	return &WebSocketConn{
+		conn:           netConn,
+		reader:         rw.Reader,
+		maxMessageSize: u.maxMessageSize,
+		subprotocol:    subprotocol,
+	}, nil
+}
+
+func (u *webSocketUpgrader) selectSubprotocol(req *http.Request) string {
+	offered := headerTokens(req.Header, "Sec-WebSocket-Protocol")
+	for _, protocol := range u.subprotocols {
+		for _, o := range offered {
+			if o == protocol {
+				return protocol
+			}
+		}
+	}
+	return ""
+}
+
+// WebSocketConn is an upgraded websocket connection,
+// it supports one concurrent reader and multiple concurrent writers
+type WebSocketConn struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	maxMessageSize int64
+	subprotocol    string
+	pongHandler    func(data []byte) error
+
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+// Subprotocol returns the negotiated subprotocol
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPongHandler sets handler called in ReadMessage when pong received,
+// it is usually used to extend read deadline
+func (c *WebSocketConn) SetPongHandler(handler func(data []byte) error) {
+	c.pongHandler = handler
+}
+
+// ReadMessage reads a complete message, fragments are assembled,
+// ping is answered and pong is passed to pong handler automatically,
+// it returns *CloseError when close frame received
+func (c *WebSocketConn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err = c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if c.pongHandler != nil {
+				if err = c.pongHandler(payload); err != nil {
+					return 0, nil, err
+				}
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected data frame in fragmented message")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		}
+		if int64(len(message))+int64(len(payload)) > c.maxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if messageType == TextMessage && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid utf8 text")
+		}
+		return messageType, message, nil
+	}
+}
+
+// WriteMessage writes data as a single frame, control frames are allowed
+func (c *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if len(data) > maxControlPayload {
+			return errors.New("web: control frame payload too long")
+		}
+	default:
+		return fmt.Errorf("web: unknown websocket message type %d", messageType)
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.closeSent {
+		return errWebSocketClosed
+	}
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// Close sends close frame with CloseNormalClosure and closes the connection
+func (c *WebSocketConn) Close() error {
+	return c.CloseWithCode(CloseNormalClosure, "")
+}
+
+// CloseWithCode sends close frame with code and text, then closes the connection
+func (c *WebSocketConn) CloseWithCode(code int, text string) error {
+	err := c.WriteMessage(CloseMessage, closePayload(code, text))
+	if errors.Is(err, errWebSocketClosed) {
+		err = nil
+	}
+	if closeErr := c.conn.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+		return closeErr
+	}
+	return err
+}
+
+func (c *WebSocketConn) handleClose(payload []byte) error {
+	res := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		res.Code = int(binary.BigEndian.Uint16(payload))
+		res.Text = string(payload[2:])
+		if !validCloseCode(res.Code) {
+			return c.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(res.Text) {
+			return c.fail(CloseInvalidFramePayloadData, "invalid utf8 close reason")
+		}
+	}
+	// echo the close code to complete closing handshake
+	code := res.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	_ = c.CloseWithCode(code, "")
+	return res
+}
+
+// fail closes the connection because of protocol violation
+func (c *WebSocketConn) fail(code int, text string) error {
+	_ = c.CloseWithCode(code, text)
+	return &CloseError{Code: code, Text: text}
+}
+
+func (c *WebSocketConn) readFrame() (bool, int, []byte, error) {
+	header := make([]byte, 2, 8)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits are not supported")
+	}
+	switch opcode {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !fin {
+			return false, 0, nil, c.fail(CloseProtocolError, "fragmented control frame")
+		}
+	default:
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved opcode")
+	}
+	// frames from client must be masked
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "frame is not masked")
+	}
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.reader, header[:2]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.reader, header[:8]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(header[:8]))
+		if length < 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	}
+	if opcode >= CloseMessage && length > maxControlPayload {
+		return false, 0, nil, c.fail(CloseProtocolError, "control frame payload too long")
+	}
+	if length > c.maxMessageSize {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes an unmasked final frame, frames from server must not be masked
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	header := make([]byte, 0, 10)
+	header = append(header, 0x80|byte(opcode))
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func closePayload(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	res := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(text) > maxControlPayload-2 {
+		// cut at the start of a character to keep text valid utf8
+		n := maxControlPayload - 2
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text = text[:n]
+	}
+	return append(res, text...)
+}
+
+// validCloseCode reports whether code could be received in close frame by RFC 6455 section 7.4,
+// 1005 and 1006 are reserved for reporting and never sent
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < CloseNormalClosure || code > 1014:
+		return false
+	}
+	return code != 1004 && code != CloseNoStatusReceived && code != CloseAbnormalClosure
+}
+
+// trackWebSocket adds or removes upgraded connection closed by Shutdown
+func (h *HTTPServer) trackWebSocket(conn *WebSocketConn, add bool) {
+	h.webSocketsMutex.Lock()
+	defer h.webSocketsMutex.Unlock()
+	if add {
+		h.webSockets[conn] = struct{}{}
+		return
+	}
+	delete(h.webSockets, conn)
+}
+
+// closeWebSockets is registered by http.Server.RegisterOnShutdown,
+// connections are closed with CloseGoingAway so that clients could reconnect to other servers
+func (h *HTTPServer) closeWebSockets() {
+	h.webSocketsMutex.Lock()
+	conns := make([]*WebSocketConn, 0, len(h.webSockets))
+	for conn := range h.webSockets {
+		conns = append(conns, conn)
+	}
+	h.webSocketsMutex.Unlock()
+	for _, conn := range conns {
+		// a blocked writer should not hold Shutdown
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_ = conn.CloseWithCode(CloseGoingAway, "server shutting down")
+	}
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// headerTokens returns comma separated tokens of header values
+func headerTokens(header http.Header, key string) []string {
+	var res []string
+	for _, val := range header.Values(key) {
+		for _, token := range strings.Split(val, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				res = append(res, token)
+			}
+		}
+	}
+	return res
+}
+
+func headerContainsToken(header http.Header, key string, token string) bool {
+	for _, t := range headerTokens(header, key) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestHTTPServer_WebSocket(t *testing.T) {
+	var mutex sync.Mutex
+	var passed []string
+	h := NewHTTPServer(ServerWithMiddlewares(func(next Handler) Handler {
+		return func(ctx *Context) {
+			mutex.Lock()
+			passed = append(passed, ctx.Req.URL.Path)
+			mutex.Unlock()
+			ctx.Resp.Header().Set("Set-Cookie", "sid=1")
+			next(ctx)
+		}
+	}))
+	h.WebSocket("/ws/:room", func(ctx *Context, conn *WebSocketConn) {
+		room, _ := ctx.PathValue("room").String()
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(typ, append([]byte(room+":"), data...)); err != nil {
+				return
+			}
+		}
+	}, WebSocketWithMaxMessageSize(16), WebSocketWithSubprotocols("chat"))
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	t.Run("echo", func(t *testing.T) {
+		conn, reader, header := dialWebSocket(t, server.URL, "/ws/golang", "chat")
+		defer conn.Close()
+		// headers set by middlewares are kept
+		assert.Equal(t, "sid=1", header.Get("Set-Cookie"))
+		writeClientFrame(t, conn, true, TextMessage, []byte("hello"))
+		fin, opcode, payload := readServerFrame(t, reader)
+		assert.True(t, fin)
+		assert.Equal(t, TextMessage, opcode)
+		assert.Equal(t, "golang:hello", string(payload))
+	})
+
+	t.Run("fragmented", func(t *testing.T) {
+		conn, reader, _ := dialWebSocket(t, server.URL, "/ws/go", "")
+		defer conn.Close()
+		writeClientFrame(t, conn, false, BinaryMessage, []byte("ab"))
+		// control frame between fragments
+		writeClientFrame(t, conn, true, PingMessage, []byte("p"))
+		writeClientFrame(t, conn, true, continuationFrame, []byte("cd"))
+		_, opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, PongMessage, opcode)
+		assert.Equal(t, "p", string(payload))
+		_, opcode, payload = readServerFrame(t, reader)
+		assert.Equal(t, BinaryMessage, opcode)
+		assert.Equal(t, "go:abcd", string(payload))
+	})
+
+	t.Run("close", func(t *testing.T) {
+		conn, reader, _ := dialWebSocket(t, server.URL, "/ws/go", "")
+		defer conn.Close()
+		writeClientFrame(t, conn, true, CloseMessage, closePayload(CloseGoingAway, "bye"))
+		_, opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, CloseMessage, opcode)
+		assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("invalid close code", func(t *testing.T) {
+		for _, code := range []int{999, CloseNoStatusReceived, CloseAbnormalClosure, 1004, 2000} {
+			conn, reader, _ := dialWebSocket(t, server.URL, "/ws/go", "")
+			writeClientFrame(t, conn, true, CloseMessage, binary.BigEndian.AppendUint16(nil, uint16(code)))
+			_, opcode, payload := readServerFrame(t, reader)
+			assert.Equal(t, CloseMessage, opcode)
+			assert.Equal(t, CloseProtocolError, int(binary.BigEndian.Uint16(payload)), code)
+			_ = conn.Close()
+		}
+	})
+
+	t.Run("too big", func(t *testing.T) {
+		conn, reader, _ := dialWebSocket(t, server.URL, "/ws/go", "")
+		defer conn.Close()
+		writeClientFrame(t, conn, false, TextMessage, []byte("0123456789"))
+		writeClientFrame(t, conn, true, continuationFrame, []byte("0123456789"))
+		_, opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, CloseMessage, opcode)
+		assert.Equal(t, CloseMessageTooBig, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("unmasked", func(t *testing.T) {
+		conn, reader, _ := dialWebSocket(t, server.URL, "/ws/go", "")
+		defer conn.Close()
+		_, err := conn.Write([]byte{0x81, 0x01, 'a'})
+		require.NoError(t, err)
+		_, opcode, payload := readServerFrame(t, reader)
+		assert.Equal(t, CloseMessage, opcode)
+		assert.Equal(t, CloseProtocolError, int(binary.BigEndian.Uint16(payload)))
+	})
+
+	t.Run("bad handshake", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/ws/go")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("bad version", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/ws/go", nil)
+		require.NoError(t, err)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "8")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+		assert.Equal(t, "13", resp.Header.Get("Sec-WebSocket-Version"))
+	})
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Contains(t, passed, "/ws/golang")
+}
+
+func TestHTTPServer_WebSocketShutdown(t *testing.T) {
+	h := NewHTTPServer()
+	closed := make(chan error, 1)
+	h.Group("/api").WebSocket("/ws", func(ctx *Context, conn *WebSocketConn) {
+		_, _, err := conn.ReadMessage()
+		closed <- err
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = h.Serve(listener)
+	}()
+
+	conn, reader, _ := dialWebSocket(t, "http://"+listener.Addr().String(), "/api/ws", "")
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, h.Shutdown(ctx))
+	_, opcode, payload := readServerFrame(t, reader)
+	assert.Equal(t, CloseMessage, opcode)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	assert.Error(t, <-closed)
+}
+
+func TestClosePayload(t *testing.T) {
+	// 122 bytes and a 3 bytes character exceed 123 bytes of close reason
+	payload := closePayload(CloseNormalClosure, strings.Repeat("a", 122)+"好")
+	assert.Len(t, payload, 124)
+	assert.True(t, utf8.Valid(payload[2:]))
+	assert.Nil(t, closePayload(CloseNoStatusReceived, "ignored"))
+}
+
+func TestComputeAcceptKey(t *testing.T) {
+	// example from RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", computeAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func dialWebSocket(t *testing.T, serverURL string, path string, protocol string) (net.Conn, *bufio.Reader, http.Header) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(time.Second)))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req := "GET " + path + " HTTP/1.1\r\nHost: example.com\r\n" +
+		"Connection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + key + "\r\n"
+	if protocol != "" {
+		req += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	_, err = conn.Write([]byte(req + "\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, computeAcceptKey(key), resp.Header.Get("Sec-WebSocket-Accept"))
+	require.Equal(t, protocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+	return conn, reader, resp.Header
+}
+
+func writeClientFrame(t *testing.T, conn net.Conn, fin bool, opcode int, payload []byte) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func readServerFrame(t *testing.T, reader *bufio.Reader) (bool, int, []byte) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+	require.NoError(t, err)
+	require.Zero(t, header[1]&0x80, "server frame must not be masked")
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		_, err = io.ReadFull(reader, header)
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(header))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+	return header[0]&0x80 != 0, int(header[0] & 0x0f), payload
+}